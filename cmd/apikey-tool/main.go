@@ -0,0 +1,246 @@
+/*
+ API key tool, used to generate HMAC key at install time, migrate plaintext API key file and generate API keys
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+func main() {
+	os.Exit(RealMain(os.Args[1:], os.Stdout))
+}
+
+func RealMain(args []string, out io.Writer) int {
+
+	// Init log output
+	log.SetOutput(out)
+
+	if len(args) < 1 {
+		log.Printf("usage: apikey-tool hmac-key|migrate|generate|signing-secret [options]")
+		return 1
+	}
+
+	switch args[0] {
+	case "hmac-key":
+		return hmacKey(args[1:])
+	case "migrate":
+		return migrate(args[1:])
+	case "generate":
+		return generate(args[1:], out)
+	case "signing-secret":
+		return signingSecret(args[1:], out)
+	default:
+		log.Printf("no such command: " + args[0])
+		return 1
+	}
+}
+
+// hmacKey writes a new HMAC key file readable by owner only, an existing file is kept since changing it
+// invalidates every hashed API key
+func hmacKey(args []string) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("hmac-key", flag.ContinueOnError)
+	outPath := flags.String("out", "", "Output HMAC key file path")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *outPath == "" {
+		log.Printf("hmac-key needs -out")
+		return 1
+	}
+
+	encodedKey, err := apikey.GenerateHMACKey()
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	file, err := os.OpenFile(*outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Printf("create HMAC key file failed: " + err.Error())
+		return 1
+	}
+	_, err = file.WriteString(encodedKey + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("write HMAC key file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("generated HMAC key in %s", *outPath)
+	return 0
+}
+
+// migrate converts plaintext API key file {"client": "API key"} to hashed format.
+// Clients keep using the same API keys.
+func migrate(args []string) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	inPath := flags.String("in", "", "Input plaintext API key file path")
+	outPath := flags.String("out", "", "Output hashed API key file path, can be same as input")
+	hmacKeyPath := flags.String("hmackey", "", "Optional HMAC key file path, use hmac-sha256 instead of sha256")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *inPath == "" || *outPath == "" {
+		log.Printf("migrate needs -in and -out")
+		return 1
+	}
+
+	hmacKey, err := readHMACKey(*hmacKeyPath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	byteValue, err := ioutil.ReadFile(*inPath)
+	if err != nil {
+		log.Printf("read API key file failed: " + err.Error())
+		return 1
+	}
+
+	keyFile, err := apikey.ParsePlaintextKeyFile(byteValue, hmacKey)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	if err := utils.WriteJsonFileAtomic(*outPath, keyFile); err != nil {
+		log.Printf("write API key file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("migrated %d API keys to %s", len(keyFile.Keys), *outPath)
+	return 0
+}
+
+// generate adds a new API key of client to hashed API key file, and prints the key once
+func generate(args []string, out io.Writer) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	filePath := flags.String("file", "", "Hashed API key file path")
+	client := flags.String("client", "", "Client name of API key")
+	tenantName := flags.String("tenant", "", "Optional tenant of client, should be a [TENANT <name>] section in config")
+	hmacKeyPath := flags.String("hmackey", "", "Optional HMAC key file path, use hmac-sha256 instead of sha256")
+	requireSigning := flags.Bool("require-signing", false, "Only accept signed requests of API key, needs -hmackey")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *client == "" {
+		log.Printf("generate needs -file and -client")
+		return 1
+	}
+
+	hmacKey, err := readHMACKey(*hmacKeyPath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	if *requireSigning && hmacKey == nil {
+		log.Printf("generate with -require-signing needs -hmackey")
+		return 1
+	}
+
+	keyFile := apikey.KeyFile{Keys: map[string]apikey.Record{}}
+	if byteValue, err := ioutil.ReadFile(*filePath); err == nil {
+		// Plaintext file would lose its keys when written in hashed format
+		plaintext, err := apikey.IsPlaintextKeyFile(byteValue)
+		if err != nil {
+			log.Printf(err.Error())
+			return 1
+		}
+		if plaintext {
+			log.Printf("API key file is plaintext format, migrate it first")
+			return 1
+		}
+		keyFile, err = apikey.ParseKeyFile(byteValue)
+		if err != nil {
+			log.Printf(err.Error())
+			return 1
+		}
+	}
+
+	apiKey, keyID, err := apikey.GenerateKey()
+	if err != nil {
+		log.Printf("generate API key failed: " + err.Error())
+		return 1
+	}
+	keyFile.Keys[keyID] = apikey.Record{Client: *client, Tenant: *tenantName, Hash: apikey.HashKey(apiKey, hmacKey), RequireSigning: *requireSigning}
+
+	if err := utils.WriteJsonFileAtomic(*filePath, keyFile); err != nil {
+		log.Printf("write API key file failed: " + err.Error())
+		return 1
+	}
+
+	fmt.Fprintln(out, apiKey)
+
+	// Signing secret can be derived when HMAC key given
+	if hmacKey != nil {
+		fmt.Fprintln(out, "signing secret: "+apikey.DeriveSigningSecret(hmacKey, keyID, keyFile.Keys[keyID].Hash))
+	}
+	return 0
+}
+
+// signingSecret prints request signing secret of key id, which is derived from HMAC key and hash of the key
+func signingSecret(args []string, out io.Writer) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("signing-secret", flag.ContinueOnError)
+	filePath := flags.String("file", "", "Hashed API key file path")
+	keyID := flags.String("keyid", "", "Key id of API key")
+	hmacKeyPath := flags.String("hmackey", "", "HMAC key file path")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *keyID == "" || *hmacKeyPath == "" {
+		log.Printf("signing-secret needs -file, -keyid and -hmackey")
+		return 1
+	}
+
+	hmacKey, err := readHMACKey(*hmacKeyPath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	store, err := apikey.NewStore(*filePath, hmacKey)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	secret, err := store.SigningSecret(*keyID)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	fmt.Fprintln(out, secret)
+	return 0
+}
+
+func readHMACKey(filePath string) ([]byte, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	return apikey.ReadHMACKeyFile(filePath)
+}
@@ -0,0 +1,145 @@
+/*
+Keyset tool, used to generate JWT signing keys at install time and rotate them
+*/
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+func main() {
+	os.Exit(RealMain(os.Args[1:], os.Stdout))
+}
+
+func RealMain(args []string, out io.Writer) int {
+
+	// Init log output
+	log.SetOutput(out)
+
+	if len(args) < 1 {
+		log.Printf("usage: keyset-tool generate|activate [options]")
+		return 1
+	}
+
+	switch args[0] {
+	case "generate":
+		return generate(args[1:])
+	case "activate":
+		return activate(args[1:])
+	default:
+		log.Printf("no such command: " + args[0])
+		return 1
+	}
+}
+
+// generate adds a new key to keyset file, the file is created if not exists and its first key is active
+func generate(args []string) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	filePath := flags.String("file", "", "Keyset file path")
+	kid := flags.String("kid", "", "Kid of new key")
+	alg := flags.String("alg", "ES256", "Alg of new key, HS256/HS384/HS512, RS*/PS*, ES256/ES384/ES512 or EdDSA")
+	setActive := flags.Bool("activate", false, "Set new key active, only after all replicas trust it")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *kid == "" {
+		log.Printf("generate needs -file and -kid")
+		return 1
+	}
+
+	file, err := keyset.ReadKeySetFile(*filePath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	for _, entry := range file.Keys {
+		if entry.Kid == *kid {
+			log.Printf("kid " + *kid + " already in keyset")
+			return 1
+		}
+	}
+
+	entry, err := keyset.GenerateKeyEntry(*kid, *alg, filepath.Dir(*filePath))
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	file.Keys = append(file.Keys, entry)
+	if file.ActiveKid == "" || *setActive {
+		file.ActiveKid = *kid
+	}
+
+	if err := utils.WriteJsonFileAtomic(*filePath, file); err != nil {
+		log.Printf("write keyset file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("generated %s key %s in %s, active kid is %s", *alg, *kid, *filePath, file.ActiveKid)
+	return 0
+}
+
+// activate sets active kid of keyset file, the key should be trusted by all replicas before
+func activate(args []string) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("activate", flag.ContinueOnError)
+	filePath := flags.String("file", "", "Keyset file path")
+	kid := flags.String("kid", "", "Kid of key to sign new tokens")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *kid == "" {
+		log.Printf("activate needs -file and -kid")
+		return 1
+	}
+
+	file, err := keyset.ReadKeySetFile(*filePath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	found := false
+	for _, entry := range file.Keys {
+		if entry.Kid == *kid {
+			found = true
+		}
+	}
+	if !found {
+		log.Printf("kid " + *kid + " not in keyset")
+		return 1
+	}
+
+	file.ActiveKid = *kid
+
+	// Check the keyset still loads, e.g. key of kid can sign
+	if err := utils.WriteJsonFileAtomic(*filePath+".new", file); err != nil {
+		log.Printf("write keyset file failed: " + err.Error())
+		return 1
+	}
+	if _, err := keyset.LoadKeySet(*filePath + ".new"); err != nil {
+		os.Remove(*filePath + ".new")
+		log.Printf("keyset with active kid " + *kid + " is invalid: " + err.Error())
+		return 1
+	}
+	if err := os.Rename(*filePath+".new", *filePath); err != nil {
+		log.Printf("write keyset file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("active kid of %s is %s", *filePath, *kid)
+	return 0
+}
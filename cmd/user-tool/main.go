@@ -0,0 +1,171 @@
+/*
+User tool, used to create accounts of local user file at install time and set their passwords
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+func main() {
+	os.Exit(RealMain(os.Args[1:], os.Stdin, os.Stdout))
+}
+
+func RealMain(args []string, in io.Reader, out io.Writer) int {
+
+	// Init log output
+	log.SetOutput(out)
+
+	if len(args) < 1 {
+		log.Printf("usage: user-tool add|password [options], password is read from stdin")
+		return 1
+	}
+
+	switch args[0] {
+	case "add":
+		return add(args[1:], in)
+	case "password":
+		return password(args[1:], in)
+	default:
+		log.Printf("no such command: " + args[0])
+		return 1
+	}
+}
+
+// add creates account with role in user file, the file is created if not exists
+func add(args []string, in io.Reader) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	filePath := flags.String("file", "", "User file path")
+	account := flags.String("account", "", "Account name")
+	role := flags.String("role", auth.DefaultRole, "Role of account")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *account == "" || *role == "" {
+		log.Printf("add needs -file, -account and -role")
+		return 1
+	}
+
+	users, err := readUserFile(*filePath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	if _, ok := users[*account]; ok {
+		log.Printf("account " + *account + " already in user file")
+		return 1
+	}
+
+	passwordHash, err := readPasswordHash(*account, in)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	users[*account] = auth.UserRecord{PasswordHash: passwordHash, Role: *role}
+
+	if err := utils.WriteJsonFileAtomic(*filePath, users); err != nil {
+		log.Printf("write user file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("added account %s of role %s to %s", *account, *role, *filePath)
+	return 0
+}
+
+// password replaces password hash of existing account in user file
+func password(args []string, in io.Reader) int {
+
+	// Define cli inputs
+	flags := flag.NewFlagSet("password", flag.ContinueOnError)
+	filePath := flags.String("file", "", "User file path")
+	account := flags.String("account", "", "Account name")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if *filePath == "" || *account == "" {
+		log.Printf("password needs -file and -account")
+		return 1
+	}
+
+	users, err := readUserFile(*filePath)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+
+	user, ok := users[*account]
+	if !ok {
+		log.Printf("account " + *account + " not in user file")
+		return 1
+	}
+
+	user.PasswordHash, err = readPasswordHash(*account, in)
+	if err != nil {
+		log.Printf(err.Error())
+		return 1
+	}
+	users[*account] = user
+
+	if err := utils.WriteJsonFileAtomic(*filePath, users); err != nil {
+		log.Printf("write user file failed: " + err.Error())
+		return 1
+	}
+
+	log.Printf("set password of account %s in %s", *account, *filePath)
+	return 0
+}
+
+// readUserFile returns accounts of user file, or no accounts if the file not exists
+func readUserFile(filePath string) (map[string]auth.UserRecord, error) {
+
+	users := map[string]auth.UserRecord{}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(byteValue, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// readPasswordHash reads password of account from first line of in, and returns its argon2id hash
+func readPasswordHash(account string, in io.Reader) (string, error) {
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", auth.ErrPasswordTooShort
+	}
+	if err := (auth.PasswordPolicy{}).Check(account, password); err != nil {
+		return "", err
+	}
+
+	return auth.HashPassword(password)
+}
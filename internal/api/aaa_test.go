@@ -0,0 +1,312 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+func TestLogin(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	tests := []struct {
+		name       string
+		client     string
+		body       interface{}
+		wantStatus int
+	}{
+		{"correct password", "web", LoginReceiveBody{Account: "alice", Password: testPassword}, http.StatusOK},
+		{"wrong password", "web", LoginReceiveBody{Account: "alice", Password: "wrong"}, http.StatusBadRequest},
+		{"unknown account", "web", LoginReceiveBody{Account: "carol", Password: testPassword}, http.StatusBadRequest},
+		{"malformed body", "web", "alice", http.StatusBadRequest},
+		{"no API key", "", LoginReceiveBody{Account: "alice", Password: testPassword}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.call(http.MethodPost, "/api/v1/login", tt.client, "", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			var loginSucceed LoginSucceed
+			decodeBody(t, w, &loginSucceed)
+			if (loginSucceed.Token != "") != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("token = %q, want token only on success", loginSucceed.Token)
+			}
+		})
+	}
+
+	// Failures are audited with account tried, success with account logged in
+	events := ts.auditEvents(audit.EventLogin)
+	var outcomes []string
+	for _, event := range events {
+		outcomes = append(outcomes, event.Actor+" "+event.Outcome)
+	}
+	want := "alice success,alice failure,carol failure"
+	if strings.Join(outcomes, ",") != want {
+		t.Errorf("login audit events = %v, want %s", outcomes, want)
+	}
+}
+
+func TestLoginTokenIsAccepted(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	loginSucceed := ts.login("web", "alice")
+	if loginSucceed.RefreshToken == "" {
+		t.Error("login returned no refresh token")
+	}
+
+	w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", loginSucceed.Token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("getServiceInfo status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var meSucceed MeSucceed
+	decodeBody(t, ts.call(http.MethodGet, "/api/v1/me", "", loginSucceed.Token, nil), &meSucceed)
+	if meSucceed.Account != "alice" || meSucceed.Role != "Member" {
+		t.Errorf("me = %+v, want alice of role Member", meSucceed)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"TOKEN": {"Leeway_Seconds": "30"}})
+
+	keySet, err := keyset.LoadKeySet(filepath.Join(ts.dir, "jwt_keyset.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey := keySet.SigningKey()
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(change func(claims *Claims)) Claims {
+		claims := Claims{Account: "alice", Role: "Member", StandardClaims: jwt.StandardClaims{
+			Issuer: "CXWEO", Subject: "alice", Audience: "CXWEO-API", Id: "test-jti",
+			IssuedAt: now.Unix(), NotBefore: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix(),
+		}}
+		if change != nil {
+			change(&claims)
+		}
+		return claims
+	}
+	sign := func(change func(claims *Claims)) string {
+		return signTestToken(t, signingKey.Method, "test-1", signingKey.SignKey, claims(change))
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      string // empty if token is accepted
+	}{
+		{"valid token", "Bearer " + sign(nil), ""},
+		{"expired within leeway", "Bearer " + sign(func(c *Claims) { c.ExpiresAt = now.Add(-10 * time.Second).Unix() }), ""},
+		{"no authorization", "", TokenErrBearerFormat},
+		{"not bearer", "Token " + sign(nil), TokenErrBearerFormat},
+		{"malformed token", "Bearer not.a.token", TokenErrMalformed},
+		{"alg none", "Bearer " + signTestToken(t, jwt.SigningMethodNone, "test-1", jwt.UnsafeAllowNoneSignatureType, claims(nil)), TokenErrAlgorithmNotAllowed},
+		{"alg not of keyset", "Bearer " + signTestToken(t, jwt.SigningMethodHS256, "test-1", []byte("0123456789abcdef0123456789abcdef"), claims(nil)), TokenErrAlgorithmNotAllowed},
+		{"unknown kid", "Bearer " + signTestToken(t, signingKey.Method, "test-2", signingKey.SignKey, claims(nil)), TokenErrUnknownKey},
+		{"signed by other key", "Bearer " + signTestToken(t, signingKey.Method, "test-1", otherKey, claims(nil)), TokenErrSignatureInvalid},
+		{"expired", "Bearer " + sign(func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }), TokenErrExpired},
+		{"not yet valid", "Bearer " + sign(func(c *Claims) { c.NotBefore = now.Add(time.Minute).Unix() }), TokenErrNotYetValid},
+		{"missing jti", "Bearer " + sign(func(c *Claims) { c.Id = "" }), TokenErrMissingClaim},
+		{"other issuer", "Bearer " + sign(func(c *Claims) { c.Issuer = "JWT" }), TokenErrInvalidIssuer},
+		{"other audience", "Bearer " + sign(func(c *Claims) { c.Audience = "alice" }), TokenErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.newRequest(http.MethodGet, "/api/v1/getServiceInfo", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := ts.serve(req)
+
+			if tt.wantCode == "" {
+				if w.Code != http.StatusOK {
+					t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+				}
+				return
+			}
+
+			var authFailedResp AuthFailedResp
+			decodeBody(t, w, &authFailedResp)
+			if w.Code != http.StatusUnauthorized || authFailedResp.Code != tt.wantCode {
+				t.Errorf("status = %d, code = %q, want %d with %q", w.Code, authFailedResp.Code, http.StatusUnauthorized, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+
+	ts := newTestServer(t, nil,
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "mobile", Scopes: []string{"login"}},
+	)
+
+	first := ts.login("web", "alice")
+
+	refresh := func(client, refreshToken string) *httptest.ResponseRecorder {
+		return ts.call(http.MethodPost, "/api/v1/token/refresh", client, "", RefreshReceiveBody{RefreshToken: refreshToken})
+	}
+
+	// Refresh token is only accepted from the client it was issued to
+	if w := refresh("mobile", first.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh from another client status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w := refresh("web", first.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var second LoginSucceed
+	decodeBody(t, w, &second)
+	if second.Token == "" || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh returned %+v, want a new token pair", second)
+	}
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", second.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("refreshed token status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// Reuse of rotated token revokes the family, so the token rotated from it is rejected too
+	if w := refresh("web", first.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := refresh("web", second.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of revoked family status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	events := ts.auditEvents(audit.EventTokenRevocation)
+	if len(events) != 1 || events[0].Actor != "alice" || events[0].Reason != "refresh token reused" {
+		t.Errorf("token revocation audit events = %+v, want one of reused refresh token of alice", events)
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	keyID := apikey.KeyID(ts.apiKeys["web"])
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+	}{
+		{"issued key", ts.apiKeys["web"], http.StatusOK},
+		{"key id with wrong secret", "ak_" + keyID + ".wrong", http.StatusUnauthorized},
+		{"unknown key", "ak_0123456789abcdef.secret", http.StatusUnauthorized},
+		{"hash of key", "hmac-sha256:" + keyID, http.StatusUnauthorized},
+		{"no key", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "alice", Password: testPassword})
+			req.Header.Set("X-API-Key", tt.apiKey)
+
+			if w := ts.serve(req); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	// Key id of accepted key is audited, never the key
+	events := ts.auditEvents(audit.EventAPIKeyUse)
+	if len(events) != 5 || events[0].Outcome != audit.OutcomeSuccess || events[0].Target != keyID {
+		t.Fatalf("API key audit events = %+v, want success of key %s and 4 failures", events, keyID)
+	}
+	for _, event := range events[1:] {
+		if event.Outcome != audit.OutcomeFailure {
+			t.Errorf("API key audit event = %+v, want failure", event)
+		}
+	}
+}
+
+func TestAPIKeyRestrictions(t *testing.T) {
+
+	past := time.Now().Add(-time.Hour)
+
+	// httptest requests come from 192.0.2.1
+	ts := newTestServer(t, nil,
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "other-scope", Scopes: []string{"service:read"}},
+		apikey.Record{Client: "routes", Scopes: []string{"login"}, Routes: []string{"POST /api/v1/token/refresh"}},
+		apikey.Record{Client: "in-cidr", Scopes: []string{"login"}, AllowedCIDRs: []string{"192.0.2.0/24"}},
+		apikey.Record{Client: "out-of-cidr", Scopes: []string{"login"}, AllowedCIDRs: []string{"198.51.100.0/24"}},
+		apikey.Record{Client: "expired", Scopes: []string{"login"}, ExpiresAt: &past},
+		apikey.Record{Client: "disabled", Scopes: []string{"login"}, Disabled: true},
+	)
+
+	tests := []struct {
+		client     string
+		wantStatus int
+	}{
+		{"web", http.StatusOK},
+		{"other-scope", http.StatusForbidden},
+		{"routes", http.StatusForbidden},
+		{"in-cidr", http.StatusOK},
+		{"out-of-cidr", http.StatusForbidden},
+		{"expired", http.StatusUnauthorized},
+		{"disabled", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.client, func(t *testing.T) {
+			w := ts.call(http.MethodPost, "/api/v1/login", tt.client, "", LoginReceiveBody{Account: "alice", Password: testPassword})
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"LOGIN LOCKOUT": {"Account_Max_Failures": "2", "IP_Max_Failures": "0"}})
+
+	login := func(account, password string) *httptest.ResponseRecorder {
+		return ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: account, Password: password})
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := login("alice", "wrong"); w.Code != http.StatusBadRequest {
+			t.Fatalf("failure %d status = %d, want %d", i+1, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Locked account is rejected even with correct password
+	w := login("alice", testPassword)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login of locked account status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("Retry-After = %q, want seconds until lockout ends", retryAfter)
+	}
+
+	// IP lockout is disabled, other accounts from the same IP can login
+	if w := login("admin", testPassword); w.Code != http.StatusOK {
+		t.Errorf("login of other account status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
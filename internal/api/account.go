@@ -0,0 +1,438 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+)
+
+// Account receive and response struct
+
+type RegisterReceiveBody struct {
+	Account  string `json:"Account" example:"account" format:"string"`
+	Password string `json:"Password" example:"password" format:"string"`
+}
+
+type ChangePasswordReceiveBody struct {
+	OldPassword string `json:"OldPassword" example:"old password" format:"string"`
+	NewPassword string `json:"NewPassword" example:"new password" format:"string"`
+}
+
+type RequestPasswordResetReceiveBody struct {
+	Account string `json:"Account" example:"account" format:"string"`
+}
+
+type ResetPasswordReceiveBody struct {
+	Token       string `json:"Token" example:"reset token" format:"string"`
+	NewPassword string `json:"NewPassword" example:"new password" format:"string"`
+}
+
+type SetRegistrationReceiveBody struct {
+	Enabled bool `json:"Enabled" example:"false"`
+}
+
+type AccountSucceed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+type AccountFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// @Summary Register account.
+// @Description register account of default role, only when registration is enabled
+// @Param X-API-Key header string true "Insert your api key" default(<Add api key here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body RegisterReceiveBody true "Account and Password"
+// @Tags Account
+// @version 1.0
+// @Success 200 {object} AccountSucceed
+// @Failure 400 {object} AccountFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} AccountFailed
+// @Failure 409 {object} AccountFailed
+// @Failure 500 {object} AccountFailed
+// @Router /api/v1/accounts/register [post]
+func Register(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch client
+	client := c.MustGet("client").(string)
+
+	// Fetch body received
+	var receiveBody = RegisterReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Client " + client + " bad request: " + err.Error()
+		c.JSON(http.StatusBadRequest, accountFailed)
+		logger.Warn("Client " + client + " register bad request: " + err.Error())
+		return
+	}
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	// Register account
+	user, err := accounts.Register(receiveBody.Account, receiveBody.Password)
+
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Register account " + receiveBody.Account + " failed: " + err.Error()
+		c.JSON(accountErrorStatus(err), accountFailed)
+		logger.Warn("Client " + client + " register account " + receiveBody.Account + " from " + c.ClientIP() + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeFailure, Target: receiveBody.Account, Reason: "register: " + err.Error()})
+		return
+	}
+
+	var accountSucceed = AccountSucceed{}
+	accountSucceed.Message = "Account " + user.Account + " registered."
+	c.JSON(http.StatusOK, accountSucceed)
+
+	logger.Info("Client " + client + " registered account " + user.Account + " with role " + user.Role + " from " + c.ClientIP())
+	auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeSuccess, Target: user.Account, Reason: "registered with role " + user.Role})
+	return
+}
+
+// @Summary Change password of current account.
+// @Description change password with old password, tokens of account are revoked after changed
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body ChangePasswordReceiveBody true "Old and new password"
+// @Tags Account
+// @version 1.0
+// @Success 200 {object} AccountSucceed
+// @Failure 400 {object} AccountFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 429 {object} AccountFailed
+// @Failure 500 {object} AccountFailed
+// @Router /api/v1/accounts/password [put]
+func ChangePassword(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch account
+	account := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = ChangePasswordReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Account " + account + " bad request: " + err.Error()
+		c.JSON(http.StatusBadRequest, accountFailed)
+		logger.Warn("Account " + account + " change password bad request: " + err.Error())
+		return
+	}
+
+	// Fetch login limiter, wrong old passwords count as login failures
+	loginLimiter := c.MustGet("LoginLimiter").(*auth.LoginLimiter)
+
+	// Check whether account or client IP is locked
+	clientIP := c.ClientIP()
+	if retryAfter := loginLimiter.Check(account, clientIP, time.Now()); retryAfter > 0 {
+		retryAfterSeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Account " + account + " is temporarily locked, retry after " + retryAfterSeconds + " seconds."
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusTooManyRequests, accountFailed)
+		logger.Warn("Account " + account + " try to change password while locked from " + clientIP)
+		return
+	}
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	// Change password
+	err = accounts.ChangePassword(account, receiveBody.OldPassword, receiveBody.NewPassword)
+
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Account " + account + " change password failed: " + err.Error()
+		c.JSON(accountErrorStatus(err), accountFailed)
+		logger.Warn("Account " + account + " change password from " + clientIP + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeFailure, Target: account, Reason: "change password: " + err.Error()})
+
+		if err == auth.ErrInvalidCredentials {
+			loginLimiter.Failure(account, clientIP, time.Now())
+		}
+		return
+	}
+
+	// Tokens issued with old password are revoked
+	if err := revokeAccountTokens(c, account); err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Account " + account + " password changed, but revoking tokens issued before failed, please connect admin."
+		c.JSON(http.StatusInternalServerError, accountFailed)
+		auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeSuccess, Target: account, Reason: "password changed"})
+		return
+	}
+
+	var accountSucceed = AccountSucceed{}
+	accountSucceed.Message = "Account " + account + " password changed, please login again."
+	c.JSON(http.StatusOK, accountSucceed)
+
+	logger.Info("Account " + account + " changed password from " + clientIP)
+	auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeSuccess, Target: account, Reason: "password changed"})
+	return
+}
+
+// @Summary Request password reset.
+// @Description send one-time reset token to account with notifier, the response is the same whether account exists or not
+// @Param X-API-Key header string true "Insert your api key" default(<Add api key here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body RequestPasswordResetReceiveBody true "Account"
+// @Tags Account
+// @version 1.0
+// @Success 200 {object} AccountSucceed
+// @Failure 400 {object} AccountFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 429 {object} AccountFailed
+// @Failure 500 {object} AccountFailed
+// @Router /api/v1/accounts/password/reset/request [post]
+func RequestPasswordReset(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch client
+	client := c.MustGet("client").(string)
+
+	// Fetch body received
+	var receiveBody = RequestPasswordResetReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || receiveBody.Account == "" {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Client " + client + " bad request: account is required"
+		c.JSON(http.StatusBadRequest, accountFailed)
+		logger.Warn("Client " + client + " request password reset bad request")
+		return
+	}
+
+	// Fetch reset limiter, every request counts whether account exists or not
+	resetLimiter := c.MustGet("ResetLimiter").(*auth.LoginLimiter)
+
+	// Check whether account or client IP requested too many resets
+	clientIP := c.ClientIP()
+	if retryAfter := resetLimiter.Check(receiveBody.Account, clientIP, time.Now()); retryAfter > 0 {
+		retryAfterSeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Too many password reset requests, retry after " + retryAfterSeconds + " seconds."
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusTooManyRequests, accountFailed)
+		logger.Warn("Client " + client + " request password reset of account " + receiveBody.Account + " from " + clientIP + " rate limited")
+		return
+	}
+	resetLimiter.Failure(receiveBody.Account, clientIP, time.Now())
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	// Create reset token
+	send, err := accounts.RequestReset(receiveBody.Account, time.Now())
+
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Request password reset failed."
+		c.JSON(accountErrorStatus(err), accountFailed)
+		logger.Warn("Client " + client + " request password reset of account " + receiveBody.Account + " failed: " + err.Error())
+		return
+	}
+
+	var accountSucceed = AccountSucceed{}
+	accountSucceed.Message = "If account " + receiveBody.Account + " exists, a reset token is sent."
+	c.JSON(http.StatusOK, accountSucceed)
+
+	logger.Info("Client " + client + " requested password reset of account " + receiveBody.Account + " from " + clientIP)
+
+	// Send reset token after response, so timing of notifier does not tell whether account exists
+	go func() {
+		if err := send(); err != nil {
+			logger.Warn("Send password reset of account " + receiveBody.Account + " failed: " + err.Error())
+		}
+	}()
+	return
+}
+
+// @Summary Reset password with reset token.
+// @Description set new password with one-time reset token, tokens of account are revoked after reset
+// @Param X-API-Key header string true "Insert your api key" default(<Add api key here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body ResetPasswordReceiveBody true "Reset token and new password"
+// @Tags Account
+// @version 1.0
+// @Success 200 {object} AccountSucceed
+// @Failure 400 {object} AccountFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 500 {object} AccountFailed
+// @Router /api/v1/accounts/password/reset [post]
+func ResetPassword(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch client
+	client := c.MustGet("client").(string)
+
+	// Fetch body received
+	var receiveBody = ResetPasswordReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || receiveBody.Token == "" {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Client " + client + " bad request: reset token is required"
+		c.JSON(http.StatusBadRequest, accountFailed)
+		logger.Warn("Client " + client + " reset password bad request")
+		return
+	}
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	// Reset password
+	account, err := accounts.ResetPassword(receiveBody.Token, receiveBody.NewPassword, time.Now())
+
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Reset password failed: " + err.Error()
+		c.JSON(accountErrorStatus(err), accountFailed)
+		logger.Warn("Client " + client + " reset password of account " + account + " from " + c.ClientIP() + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeFailure, Target: account, Reason: "reset password: " + err.Error()})
+		return
+	}
+
+	// Tokens issued with old password are revoked
+	if err := revokeAccountTokens(c, account); err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "Account " + account + " password reset, but revoking tokens issued before failed, please connect admin."
+		c.JSON(http.StatusInternalServerError, accountFailed)
+		auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeSuccess, Target: account, Reason: "password reset"})
+		return
+	}
+
+	var accountSucceed = AccountSucceed{}
+	accountSucceed.Message = "Account " + account + " password reset, please login again."
+	c.JSON(http.StatusOK, accountSucceed)
+
+	logger.Info("Client " + client + " reset password of account " + account + " from " + c.ClientIP())
+	auditLog(c, audit.Event{Type: audit.EventAccountChange, Outcome: audit.OutcomeSuccess, Target: account, Reason: "password reset"})
+	return
+}
+
+// @Summary Turn registration on or off.
+// @Description turn registration on or off until restart, admin only
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body SetRegistrationReceiveBody true "Enabled"
+// @Tags Account
+// @version 1.0
+// @Success 200 {object} AccountSucceed
+// @Failure 400 {object} AccountFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Router /api/v1/admin/registration [put]
+func SetRegistration(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = SetRegistrationReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil {
+		var accountFailed = AccountFailed{}
+		accountFailed.Message = "bad request: " + err.Error()
+		c.JSON(http.StatusBadRequest, accountFailed)
+		logger.Warn("Admin " + admin + " set registration bad request: " + err.Error())
+		return
+	}
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	accounts.SetRegistrationEnabled(receiveBody.Enabled)
+
+	var accountSucceed = AccountSucceed{}
+	accountSucceed.Message = "Registration enabled: " + strconv.FormatBool(receiveBody.Enabled)
+	c.JSON(http.StatusOK, accountSucceed)
+
+	auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeSuccess, Target: "registration", Reason: "set enabled to " + strconv.FormatBool(receiveBody.Enabled)})
+	return
+}
+
+// revokeAccountTokens revokes access and refresh tokens of account issued until now, and writes audit log of the result.
+// Refresh tokens and sessions are removed even when access tokens can not be revoked, and the error is returned.
+func revokeAccountTokens(c *gin.Context, account string) error {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch refresh store
+	refreshStore := c.MustGet("RefreshStore").(tokenstore.RefreshStore)
+	refreshStore.RevokeAccount(account)
+
+	// Remove sessions of opaque tokens, deleteAccountSessions is in revocation.go
+	if err := deleteAccountSessions(c, account); err != nil {
+		logger.Warn("Delete sessions of account " + account + " failed: " + err.Error())
+	}
+
+	// Fetch revocation store
+	revocationStore := c.MustGet("RevocationStore").(tokenstore.RevocationStore)
+
+	now := time.Now()
+	if err := revocationStore.RevokeAccount(account, now, now.Add(revocationTTL(c))); err != nil {
+		logger.Warn("Revoke tokens of account " + account + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeFailure, Target: "account " + account, Reason: err.Error()})
+		return err
+	}
+
+	auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeSuccess, Target: "account " + account, Reason: "password changed or reset"})
+
+	return nil
+}
+
+// accountErrorStatus returns http status of account error
+func accountErrorStatus(err error) int {
+
+	switch err {
+	case auth.ErrRegistrationDisabled:
+		return http.StatusForbidden
+	case auth.ErrAccountExists:
+		return http.StatusConflict
+	case auth.ErrAccountNotFound:
+		return http.StatusNotFound
+	case auth.ErrAccountsNotSupported:
+		return http.StatusNotImplemented
+	case auth.ErrInvalidCredentials, auth.ErrAccountNameInvalid, auth.ErrInvalidResetToken, auth.ErrPasswordNotChanged,
+		auth.ErrPasswordTooShort, auth.ErrPasswordTooLong, auth.ErrPasswordNeedsUpper, auth.ErrPasswordNeedsLower,
+		auth.ErrPasswordNeedsDigit, auth.ErrPasswordNeedsSymbol, auth.ErrPasswordHasAccount:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/notify"
+)
+
+// New password used by account tests
+const testNewPassword = "N3w-passw0rd-5678"
+
+// resetToken waits for reset message of account in notifier file, which is sent after response, and returns its token
+func (ts *testServer) resetToken(account string) string {
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if file, err := os.Open(filepath.Join(ts.dir, "notify.log")); err == nil {
+			var body string
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var message notify.Message
+				if err := json.Unmarshal(scanner.Bytes(), &message); err == nil && message.Recipient == account {
+					body = message.Body
+				}
+			}
+			file.Close()
+
+			if body != "" {
+				return body[strings.LastIndex(body, " ")+1:]
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ts.t.Fatalf("no reset message of account %s in notifier file", account)
+	return ""
+}
+
+func TestRegister(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	register := func(account, password string) int {
+		return ts.call(http.MethodPost, "/api/v1/accounts/register", "web", "", RegisterReceiveBody{Account: account, Password: password}).Code
+	}
+
+	// Registration is off by default
+	if status := register("carol", testPassword); status != http.StatusForbidden {
+		t.Errorf("register while disabled status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	adminToken := ts.login("web", "admin").Token
+	if w := ts.call(http.MethodPut, "/api/v1/admin/registration", "", ts.login("web", "alice").Token, SetRegistrationReceiveBody{Enabled: true}); w.Code != http.StatusForbidden {
+		t.Errorf("set registration by member status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := ts.call(http.MethodPut, "/api/v1/admin/registration", "", adminToken, SetRegistrationReceiveBody{Enabled: true}); w.Code != http.StatusOK {
+		t.Fatalf("set registration status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		account    string
+		password   string
+		wantStatus int
+	}{
+		{"new account", "carol", testPassword, http.StatusOK},
+		{"existing account", "alice", testPassword, http.StatusConflict},
+		{"short password", "dave", "Sh0rt!", http.StatusBadRequest},
+		{"password contains account", "erin", "erin-Passw0rd-1234", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := register(tt.account, tt.password); status != tt.wantStatus {
+				t.Errorf("register status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+
+	// Registered account has default role
+	var meSucceed MeSucceed
+	decodeBody(t, ts.call(http.MethodGet, "/api/v1/me", "", ts.login("web", "carol").Token, nil), &meSucceed)
+	if meSucceed.Account != "carol" || meSucceed.Role != "Member" {
+		t.Errorf("me of registered account = %+v, want carol of role Member", meSucceed)
+	}
+
+	if events := ts.auditEvents("admin_action"); len(events) != 1 || events[0].Target != "registration" {
+		t.Errorf("admin_action events = %+v, want one of registration", events)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	loginSucceed := ts.login("web", "alice")
+	changePassword := func(oldPassword, newPassword string) *httptest.ResponseRecorder {
+		return ts.call(http.MethodPut, "/api/v1/accounts/password", "", loginSucceed.Token, ChangePasswordReceiveBody{OldPassword: oldPassword, NewPassword: newPassword})
+	}
+
+	tests := []struct {
+		name        string
+		oldPassword string
+		newPassword string
+		wantStatus  int
+	}{
+		{"wrong old password", "wrong", testNewPassword, http.StatusBadRequest},
+		{"same password", testPassword, testPassword, http.StatusBadRequest},
+		{"weak new password", testPassword, "short", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := changePassword(tt.oldPassword, tt.newPassword); w.Code != tt.wantStatus {
+				t.Errorf("change password status = %d, body = %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+
+	if w := changePassword(testPassword, testNewPassword); w.Code != http.StatusOK {
+		t.Fatalf("change password status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// Tokens issued before are revoked, and only new password works
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", loginSucceed.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("token issued before change status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/token/refresh", "web", "", RefreshReceiveBody{RefreshToken: loginSucceed.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token issued before change status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: "alice", Password: testPassword}); w.Code != http.StatusBadRequest {
+		t.Errorf("login with old password status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: "alice", Password: testNewPassword}); w.Code != http.StatusOK {
+		t.Errorf("login with new password status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	events := ts.auditEvents("account_change")
+	if len(events) != 4 || events[3].Outcome != "success" || events[3].Target != "alice" {
+		t.Errorf("account_change events = %+v, want three failures and a success of alice", events)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	before := ts.login("web", "alice")
+
+	// Response is the same whether account exists or not
+	for _, account := range []string{"alice", "nobody"} {
+		w := ts.call(http.MethodPost, "/api/v1/accounts/password/reset/request", "web", "", RequestPasswordResetReceiveBody{Account: account})
+		if w.Code != http.StatusOK {
+			t.Fatalf("request reset of %s status = %d, body = %s", account, w.Code, w.Body.String())
+		}
+	}
+	token := ts.resetToken("alice")
+
+	resetPassword := func(token, newPassword string) int {
+		return ts.call(http.MethodPost, "/api/v1/accounts/password/reset", "web", "", ResetPasswordReceiveBody{Token: token, NewPassword: newPassword}).Code
+	}
+
+	if status := resetPassword("wrong-token", testNewPassword); status != http.StatusBadRequest {
+		t.Errorf("reset with wrong token status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := resetPassword(token, testNewPassword); status != http.StatusOK {
+		t.Fatalf("reset status = %d, want %d", status, http.StatusOK)
+	}
+
+	// Token is one-time
+	if status := resetPassword(token, "An0ther-passw0rd-9"); status != http.StatusBadRequest {
+		t.Errorf("reset with used token status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", before.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("token issued before reset status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: "alice", Password: testNewPassword}); w.Code != http.StatusOK {
+		t.Errorf("login with new password status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestChangePasswordRevocationFailed(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"TOKEN": {"Revocation_Backend": "file"}})
+
+	token := ts.login("web", "alice").Token
+
+	// Revocation file can not be written any more
+	if err := os.RemoveAll(filepath.Join(ts.dir, "revocation")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ts.call(http.MethodPut, "/api/v1/accounts/password", "", token, ChangePasswordReceiveBody{OldPassword: testPassword, NewPassword: testNewPassword})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("change password status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	// Password is changed, and logged once
+	if events := ts.auditEvents("account_change"); len(events) != 1 || events[0].Outcome != "success" {
+		t.Errorf("account_change events = %+v, want one success", events)
+	}
+	if events := ts.auditEvents("token_revocation"); len(events) != 1 || events[0].Outcome != "failure" {
+		t.Errorf("token_revocation events = %+v, want one failure", events)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: "alice", Password: testNewPassword}); w.Code != http.StatusOK {
+		t.Errorf("login with new password status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
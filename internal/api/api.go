@@ -2,6 +2,7 @@ package api
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/sirupsen/logrus"
 
@@ -11,33 +12,65 @@ import (
 	"github.com/swaggo/gin-swagger/swaggerFiles" // swagger embed files
 
 	apiDocs "github.com/cxweoth/gin-api-server-template/api/docs"
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
 	"github.com/cxweoth/gin-api-server-template/internal/conf"
-	"github.com/cxweoth/gin-api-server-template/internal/utils"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/mtls"
+	"github.com/cxweoth/gin-api-server-template/internal/oidc"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
 )
 
-// This function is used to setup cors, and setup allowed methods and headers
-func CorsConfig() cors.Config {
+// This function is used to setup cors, and setup allowed methods and headers.
+// Credentialed requests, e.g. with session cookie, are only allowed from allowed origins, and all origins are allowed without credentials if none configured.
+func CorsConfig(allowedOrigins []string) cors.Config {
 	corsConf := cors.DefaultConfig()
-	corsConf.AllowAllOrigins = true
-	corsConf.AllowCredentials = true
+	if len(allowedOrigins) > 0 {
+		corsConf.AllowOrigins = allowedOrigins
+		corsConf.AllowCredentials = true
+	} else {
+		corsConf.AllowAllOrigins = true
+		corsConf.AllowCredentials = false
+	}
 	corsConf.AllowMethods = []string{"GET", "POST", "DELETE", "OPTIONS", "PUT"}
 	corsConf.AllowHeaders = []string{"Authorization", "Content-Type", "Upgrade", "Origin",
-		"Connection", "Accept-Encoding", "Accept-Language", "Host", "Access-Control-Request-Method", "Access-Control-Request-Headers", "X-API-Key", "Access-Control-Allow-Origin"}
+		"Connection", "Accept-Encoding", "Accept-Language", "Host", "Access-Control-Request-Method", "Access-Control-Request-Headers", "X-API-Key", "Access-Control-Allow-Origin",
+		"X-API-Key-ID", "X-Timestamp", "X-Nonce", "X-Signature", CSRFHeader, RequestIDHeader}
+	corsConf.ExposeHeaders = []string{RequestIDHeader}
 	return corsConf
 }
 
 // APIMiddleware will add middleware to the context
-func APIMiddleware(cfg conf.IConf, logger *logrus.Entry, jwtSecret []byte) gin.HandlerFunc {
+func APIMiddleware(cfg conf.IConf, logger *logrus.Entry, keySet *keyset.KeySet, apiKeyStore *apikey.Store, authenticator auth.Authenticator, policy *auth.Policy, loginLimiter *auth.LoginLimiter, resetLimiter *auth.LoginLimiter, mfa *auth.MFA, refreshStore tokenstore.RefreshStore, revocationStore tokenstore.RevocationStore, externalIssuers *oidc.Verifier, clientMap *mtls.ClientMap, nonceStore apikey.NonceStore, tokenOptions *TokenOptions, accounts *auth.Accounts, auditLogger audit.Logger, tenants *tenant.Tenants) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		apiCfg := cfg.APICfg()
 		apiServiceName := apiCfg.APIServiceName
-		apiKeyFilePath := apiCfg.APIKeyFilePath
 
 		c.Set("Logger", logger)
-		c.Set("JwtSecret", jwtSecret)
+		c.Set("AuditLogger", auditLogger)
+		c.Set("KeySet", keySet)
+		c.Set("TokenOptions", tokenOptions)
+		c.Set("SessionConf", cfg.SessionCfg())
 		c.Set("APIServiceName", apiServiceName)
-		c.Set("APIkeyFilePath", apiKeyFilePath)
+		c.Set("APIKeyStore", apiKeyStore)
+		c.Set("NonceStore", nonceStore)
+		c.Set("SignatureMaxSkew", apiCfg.SignatureMaxSkew)
+		c.Set("SignedBodyMaxBytes", apiCfg.SignedBodyMaxBytes)
+		c.Set("Authenticator", authenticator)
+		c.Set("Accounts", accounts)
+		c.Set("Policy", policy)
+		c.Set("LoginLimiter", loginLimiter)
+		c.Set("ResetLimiter", resetLimiter)
+		c.Set("MFA", mfa)
+		c.Set("RefreshStore", refreshStore)
+		c.Set("RevocationStore", revocationStore)
+		c.Set("ExternalIssuers", externalIssuers)
+		c.Set("ClientAuth", cfg.TLSCfg().ClientAuth)
+		c.Set("ClientMap", clientMap)
+		c.Set("Tenants", tenants)
 
 		c.Next()
 	}
@@ -64,18 +97,155 @@ func SetupServer(cfg conf.IConf, logger *logrus.Entry) (*gin.Engine, error) {
 
 	// Init server
 	server := gin.Default()
-	server.Use(cors.New(CorsConfig()))
 
-	// Generate JWT secret which is used to generate token
-	jwtSecret := utils.GenerateRandomBytes(32)
+	// Only trust X-Forwarded-For from configured proxies, client IP is used in API key CIDR restrictions and lockout.
+	// gin v1.7 only applies TrustedProxies in engine.Run, so client IP is resolved by ResolveClientIP in clientip.go for both http and https.
+	trustedCIDRs, err := ParseTrustedProxies(apiCfg.TrustedProxies)
+	if err != nil {
+		logger.Warn("Init trusted proxies failed: " + err.Error())
+		return nil, errors.New("Init trusted proxies failed: " + err.Error())
+	}
+	server.ForwardedByClientIP = false
+	server.Use(ResolveClientIP(trustedCIDRs))
+
+	// Check cors config before use, cors.New panics on invalid config
+	corsConf := CorsConfig(cfg.CORSCfg().AllowedOrigins)
+	if err := corsConf.Validate(); err != nil {
+		logger.Warn("Init cors failed: " + err.Error())
+		return nil, errors.New("Init cors failed: " + err.Error())
+	}
+	server.Use(cors.New(corsConf))
+
+	// Init audit log of security events, which has its own rotation and retention
+	auditLogger, err := audit.MakeLogger(cfg)
+	if err != nil {
+		logger.Warn("Init audit log failed: " + err.Error())
+		return nil, errors.New("Init audit log failed: " + err.Error())
+	}
+
+	// Set request id of each request, it is returned in X-Request-ID and written to audit log. RequestID is in audit.go
+	server.Use(RequestID)
+
+	// Load JWT keyset which is used to sign and verify token
+	keySet, err := keyset.LoadKeySet(cfg.TokenCfg().KeysetFilePath)
+	if err != nil {
+		logger.Warn("Load jwt keyset failed: " + err.Error())
+		return nil, errors.New("Load jwt keyset failed: " + err.Error())
+	}
+
+	// Init token options which are claims of issued tokens and rules of validation
+	tokenOptions, err := MakeTokenOptions(cfg, keySet)
+	if err != nil {
+		logger.Warn("Init token options failed: " + err.Error())
+		return nil, errors.New("Init token options failed: " + err.Error())
+	}
+	if tokenOptions.Audience == "" {
+		logger.Warn("[TOKEN] Audience is not set, aud of tokens is not validated")
+	}
+
+	// Read HMAC key of API key hashes if configured
+	var apiKeyHMACKey []byte
+	if apiCfg.APIKeyHMACKeyFilePath != "" {
+		apiKeyHMACKey, err = apikey.ReadHMACKeyFile(apiCfg.APIKeyHMACKeyFilePath)
+		if err != nil {
+			logger.Warn("Load API key HMAC key failed: " + err.Error())
+			return nil, errors.New("Load API key HMAC key failed: " + err.Error())
+		}
+	}
+
+	// Load API keys to memory, and reload them when API key file changes
+	apiKeyStore, err := apikey.NewStore(apiCfg.APIKeyFilePath, apiKeyHMACKey)
+	if err != nil {
+		logger.Warn("Load API key file failed: " + err.Error())
+		return nil, errors.New("Load API key file failed: " + err.Error())
+	}
+	if apiKeyStore.IsPlaintext() {
+		logger.Warn("API key file is plaintext format, API keys can not be created, rotated or revoked until it is migrated with cmd/apikey-tool migrate")
+	}
+	go apiKeyStore.Watch(apiCfg.APIKeyPollInterval, logger, func(err error) {
+		event := audit.Event{Type: audit.EventConfigReload, Outcome: audit.OutcomeSuccess, Actor: "system", Target: "API key file"}
+		if err != nil {
+			event.Outcome = audit.OutcomeFailure
+			event.Reason = err.Error()
+		}
+		if err := auditLogger.Log(event); err != nil {
+			logger.Warn("Write audit log of " + event.Type + " failed: " + err.Error())
+		}
+	}, make(chan struct{}))
+
+	// Init nonce store which rejects replayed signed requests
+	nonceStore := apikey.NewMemoryNonceStore()
+
+	// Init authenticator which is used to verify account and password
+	authenticator, err := auth.MakeAuthenticator(cfg)
+	if err != nil {
+		logger.Warn("Init authenticator failed: " + err.Error())
+		return nil, errors.New("Init authenticator failed: " + err.Error())
+	}
+
+	// Init accounts which registers accounts and changes passwords in authenticator backend
+	accounts, err := auth.MakeAccounts(cfg, authenticator)
+	if err != nil {
+		logger.Warn("Init accounts failed: " + err.Error())
+		return nil, errors.New("Init accounts failed: " + err.Error())
+	}
+
+	// Load role to permissions policy which is used in RequireRole and RequirePermission
+	policy, err := auth.LoadPolicy(cfg.AuthCfg().PolicyFilePath)
+	if err != nil {
+		logger.Warn("Load policy failed: " + err.Error())
+		return nil, errors.New("Load policy failed: " + err.Error())
+	}
+
+	// Init login limiter which locks account and client IP after failures
+	loginLimiter := auth.MakeLoginLimiter(cfg)
+
+	// Init reset limiter which limits password reset requests of account and client IP with the same policy, apart from login failures
+	resetLimiter := auth.MakeLoginLimiter(cfg)
+
+	// Init TOTP second factor of accounts
+	mfa, err := auth.MakeMFA(cfg)
+	if err != nil {
+		logger.Warn("Init mfa failed: " + err.Error())
+		return nil, errors.New("Init mfa failed: " + err.Error())
+	}
+
+	// Init refresh token store
+	refreshStore := tokenstore.NewMemoryRefreshStore(cfg.TokenCfg().RefreshTokenTTL)
+
+	// Init revocation store which is checked in AuthRequired
+	revocationStore, err := tokenstore.MakeRevocationStore(cfg)
+	if err != nil {
+		logger.Warn("Init revocation store failed: " + err.Error())
+		return nil, errors.New("Init revocation store failed: " + err.Error())
+	}
 
-	if jwtSecret == nil {
-		logger.Fatal("Generate jwt secret failed")
-		return nil, errors.New("Generate jwt secret failed")
+	// Load trusted external issuers if configured, their tokens are accepted in AuthRequired
+	var externalIssuers *oidc.Verifier
+	if externalIssuersFilePath := cfg.TokenCfg().ExternalIssuersFilePath; externalIssuersFilePath != "" {
+		externalIssuers, err = oidc.LoadVerifier(externalIssuersFilePath)
+		if err != nil {
+			logger.Warn("Load external issuers failed: " + err.Error())
+			return nil, errors.New("Load external issuers failed: " + err.Error())
+		}
+	}
+
+	// Load client certificate to client map if client certificate auth is enabled, loadClientMap is in mtls.go
+	clientMap, err := loadClientMap(cfg)
+	if err != nil {
+		logger.Warn("Load client map failed: " + err.Error())
+		return nil, errors.New("Load client map failed: " + err.Error())
+	}
+
+	// Load tenants, the empty tenant of clients without tenant always exists
+	tenants, err := tenant.MakeTenants(cfg)
+	if err != nil {
+		logger.Warn("Load tenants failed: " + err.Error())
+		return nil, errors.New("Load tenants failed: " + err.Error())
 	}
 
 	// Setup middleware
-	server.Use(APIMiddleware(cfg, logger, jwtSecret))
+	server.Use(APIMiddleware(cfg, logger, keySet, apiKeyStore, authenticator, policy, loginLimiter, resetLimiter, mfa, refreshStore, revocationStore, externalIssuers, clientMap, nonceStore, tokenOptions, accounts, auditLogger, tenants))
 
 	// Setup max memory can be used in each request
 	server.MaxMultipartMemory = 32 << 20 // 32MiB
@@ -90,25 +260,80 @@ func SetupServer(cfg conf.IConf, logger *logrus.Entry) (*gin.Engine, error) {
 		server.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
+	// Public keys for other services to verify token, GetJWKS is in jwks.go
+	server.GET("/.well-known/jwks.json", GetJWKS)
+
+	// OAuth2 token endpoint for machine clients, which authenticate with API key, IssueOAuthToken is in oauth.go
+	server.POST("/oauth/token", IssueOAuthToken)
+
+	// Token introspection for clients, which authenticate as in token endpoint, IntrospectToken is in introspect.go
+	server.POST("/oauth/introspect", IntrospectToken)
+
 	// API Key authorized group
 	apiKeyAuthorized := server.Group("/")
 
-	// ValludateAPIKey is in aaa.go file
-	apiKeyAuthorized.Use(ValidateAPIKey)
+	// ValidateClient is in mtls.go file, it checks client certificate or API key with ValidateAPIKey in aaa.go
+	apiKeyAuthorized.Use(ValidateClient)
 	{
 		// Login, PulsarLogin are in aaa.go
 		// Use them to generate JWT
-		apiKeyAuthorized.POST("/api/v1/login", Login)
+		apiKeyAuthorized.POST("/api/v1/login", RequireScope("login"), Login)
+		// LoginMFA is in mfa.go, finish login of account with TOTP
+		apiKeyAuthorized.POST("/api/v1/login/mfa", RequireScope("login"), LoginMFA)
+		apiKeyAuthorized.POST("/api/v1/token/refresh", RequireScope("login"), RefreshToken)
+
+		// Register, RequestPasswordReset, ResetPassword are in account.go
+		apiKeyAuthorized.POST("/api/v1/accounts/register", RequireScope("login"), Register)
+		apiKeyAuthorized.POST("/api/v1/accounts/password/reset/request", RequireScope("login"), RequestPasswordReset)
+		apiKeyAuthorized.POST("/api/v1/accounts/password/reset", RequireScope("login"), ResetPassword)
 	}
 
 	// JWT authorized group
 	tokenAuthorized := server.Group("/")
-	// AuthRequired is in aaa.go file
-	tokenAuthorized.Use(AuthRequired)
+	// ValidatePresentedClient is in binding.go file, it checks client presented with token for bound tokens. AuthRequired is in aaa.go file
+	tokenAuthorized.Use(ValidatePresentedClient, AuthRequired)
+	{
+		// GetServiceInfo is in apiServiceInfo.go, RequirePermission is in rbac.go
+		tokenAuthorized.GET("/api/v1/getServiceInfo", RequirePermission("service:read"), GetServiceInfo)
+
+		// Me is in introspect.go
+		tokenAuthorized.GET("/api/v1/me", Me)
+
+		// Logout is in revocation.go
+		tokenAuthorized.POST("/api/v1/logout", Logout)
+
+		// EnrollTOTP, ConfirmTOTP, DisableTOTP are in mfa.go, credentials of account can not be changed by impersonation or client credentials token.
+		// DenyImpersonation is in impersonation.go, RequireAccount is in rbac.go
+		tokenAuthorized.POST("/api/v1/mfa/totp/enroll", RequireAccount(), DenyImpersonation(), EnrollTOTP)
+		tokenAuthorized.POST("/api/v1/mfa/totp/confirm", RequireAccount(), DenyImpersonation(), ConfirmTOTP)
+		tokenAuthorized.DELETE("/api/v1/mfa/totp", RequireAccount(), DenyImpersonation(), DisableTOTP)
+
+		// ChangePassword is in account.go
+		tokenAuthorized.PUT("/api/v1/accounts/password", RequireAccount(), DenyImpersonation(), ChangePassword)
+	}
+
+	// Admin group, RequireRole is in rbac.go file
+	adminAuthorized := server.Group("/")
+	adminAuthorized.Use(ValidatePresentedClient, AuthRequired, RequireRole("Admin"))
+	if cfg.MFACfg().RequiredByAdmin {
+		// RequireMFA is in mfa.go
+		adminAuthorized.Use(RequireMFA())
+	}
 	{
-		// UploadComponent, DownloadComponent are in fileTransmission.go
-		tokenAuthorized.GET("/api/v1/getServiceInfo", GetServiceInfo)
+		// RevokeTokens is in revocation.go
+		adminAuthorized.POST("/api/v1/admin/tokens/revoke", RequirePermission("tokens:revoke"), RevokeTokens)
+
+		// ListAPIKeys, CreateAPIKey, RotateAPIKey, RevokeAPIKey are in apikeyAdmin.go
+		adminAuthorized.GET("/api/v1/admin/apikeys", RequirePermission("apikeys:manage"), ListAPIKeys)
+		adminAuthorized.POST("/api/v1/admin/apikeys", RequirePermission("apikeys:manage"), CreateAPIKey)
+		adminAuthorized.POST("/api/v1/admin/apikeys/:keyId/rotate", RequirePermission("apikeys:manage"), RotateAPIKey)
+		adminAuthorized.DELETE("/api/v1/admin/apikeys/:keyId", RequirePermission("apikeys:manage"), RevokeAPIKey)
+
+		// SetRegistration is in account.go
+		adminAuthorized.PUT("/api/v1/admin/registration", RequirePermission("accounts:manage"), SetRegistration)
 
+		// Impersonate is in impersonation.go
+		adminAuthorized.POST("/api/v1/admin/impersonate", RequirePermission("accounts:impersonate"), Impersonate)
 	}
 
 	return server, nil
@@ -123,11 +348,29 @@ func RunServer(cfg conf.IConf, logger *logrus.Entry) error {
 	// Setup server
 	server, err := SetupServer(cfg, logger)
 	if err != nil {
-		return errors.New("API server setup failed")
+		return errors.New("API server setup failed: " + err.Error())
 	}
 
-	// Run server
-	server.Run(":" + apiCfg.APIPort)
+	httpServer := &http.Server{
+		Addr:    ":" + apiCfg.APIPort,
+		Handler: server,
+	}
+
+	// Run server, https server verifies client certificates if client certificate auth is enabled
+	if apiCfg.APIProtocol == "https" {
+		tlsConfig, err := MakeTLSConfig(cfg)
+		if err != nil {
+			return errors.New("API server tls setup failed: " + err.Error())
+		}
+		httpServer.TLSConfig = tlsConfig
+
+		tlsConf := cfg.TLSCfg()
+		err = httpServer.ListenAndServeTLS(tlsConf.CertFilePath, tlsConf.KeyFilePath)
+		logger.Warn("API server stopped: " + err.Error())
+		return errors.New("API server stopped: " + err.Error())
+	}
 
-	return errors.New("API server shutdown")
+	err = httpServer.ListenAndServe()
+	logger.Warn("API server stopped: " + err.Error())
+	return errors.New("API server stopped: " + err.Error())
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
 )
 
 // Service list response struct
@@ -28,6 +30,7 @@ type ServiceInfoFailedResp struct {
 // @Success 200 {object} ServiceInfoSuccessResp "Get service info by GET method with token"
 // @Failure 400 {object} ServiceInfoFailedResp
 // @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
 // @Failure 500 {object} ServiceInfoFailedResp
 // @Router /api/v1/getServiceInfo [get]
 func GetServiceInfo(c *gin.Context) {
@@ -44,8 +47,11 @@ func GetServiceInfo(c *gin.Context) {
 	// Init struct to fetch service list
 	var serviceInfoSucceed ServiceInfoSuccessResp
 
-	// Set service name
-	serviceInfoSucceed.ServiceName = apiServiceName
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	// Set service name, tenant may override it
+	serviceInfoSucceed.ServiceName = tenants.ServiceName(c.GetString("tenant"), apiServiceName)
 
 	// Succeed and return service list
 	c.JSON(http.StatusOK, serviceInfoSucceed)
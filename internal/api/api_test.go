@@ -0,0 +1,368 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// Password of accounts in user file of test server
+const testPassword = "Passw0rd-1234"
+
+// testConfig is sections of config.ini, tests override or add keys with newTestServer
+type testConfig map[string]map[string]string
+
+// defaultTestConfig returns config of test server, all paths are relative to its temp dir
+func defaultTestConfig() testConfig {
+	return testConfig{
+		"API SERVER": {
+			"Service_Name":              "CXWEO",
+			"Protocol":                  "http",
+			"Host":                      "127.0.0.1",
+			"Port":                      "8000",
+			"Mode":                      "Release",
+			"APIKey_File_Path":          "apikey.json",
+			"APIKey_HMAC_Key_File_Path": "apikey_hmac.key",
+		},
+		"TLS": {
+			"Client_Auth": "apikey",
+		},
+		"AUTH": {
+			"Backend":          "local",
+			"User_File_Path":   "users.json",
+			"Policy_File_Path": "policy.json",
+		},
+		"TOKEN": {
+			"Keyset_File_Path":                "jwt_keyset.json",
+			"Access_Token_TTL_Minutes":        "20",
+			"Issuer":                          "CXWEO",
+			"Audience":                        "CXWEO-API",
+			"Refresh_Token_TTL_Hours":         "168",
+			"Impersonation_Token_TTL_Minutes": "15",
+			"Revocation_Backend":              "memory",
+			"Revocation_File_Path":            "revocation/revocation.json",
+			"Session_File_Path":               "sessions.json",
+		},
+		"MFA": {
+			"File_Path": "mfa.json",
+		},
+		"SESSION": {
+			"Cookie_Name":      "cxweo_session",
+			"CSRF_Cookie_Name": "cxweo_csrf",
+			"Same_Site":        "Strict",
+		},
+		"ACCOUNT": {
+			"Notifier_File_Path": "notify.log",
+		},
+		"AUDIT": {
+			"Log_Path":       "audit.log",
+			"Rotation_Hours": "24",
+			"Retention_Days": "90",
+		},
+		"FILE STORED PATH": {
+			"Info_Debug_Log_Path": "InfoDebug.log",
+			"Warn_Panic_Log_Path": "WarnPanic.log",
+		},
+	}
+}
+
+// write writes config as ini file, sections and keys are sorted so the file is stable
+func (cfg testConfig) write(t *testing.T, filePath string) {
+
+	var sections []string
+	for section := range cfg {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	var b strings.Builder
+	for _, section := range sections {
+		var keys []string
+		for key := range cfg[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("[" + section + "]\n")
+		for _, key := range keys {
+			b.WriteString(key + " = \"" + cfg[section][key] + "\"\n")
+		}
+		b.WriteString("\n")
+	}
+
+	if err := ioutil.WriteFile(filePath, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syncBuffer is log output of test server, API key file watcher logs from its own goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// testServer is API server set up with files in a temp dir
+type testServer struct {
+	t       *testing.T
+	dir     string
+	engine  *gin.Engine
+	cfg     *conf.Conf
+	logs    *syncBuffer
+	hmacKey []byte
+	apiKeys map[string]string // raw API key of each client
+	keyIDs  map[string]string // key id of each client
+}
+
+// newTestServer sets up API server with default test config and overrides, see prepareTestServer
+func newTestServer(t *testing.T, overrides testConfig, records ...apikey.Record) *testServer {
+
+	ts := prepareTestServer(t, records...)
+	ts.start(overrides)
+
+	return ts
+}
+
+// prepareTestServer writes files of API server in a temp dir which is the working directory until test ends,
+// tests can write more files before start. Accounts are alice (Member) and admin (Admin) with testPassword.
+// Each record gets a new API key, without records there is one client "web" with login scope.
+func prepareTestServer(t *testing.T, records ...apikey.Record) *testServer {
+
+	dir := t.TempDir()
+
+	// Config paths are relative to working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	gin.DefaultWriter = ioutil.Discard
+
+	ts := &testServer{t: t, dir: dir, logs: &syncBuffer{}, apiKeys: map[string]string{}, keyIDs: map[string]string{}}
+
+	// JWT keyset
+	entry, err := keyset.GenerateKeyEntry("test-1", "ES256", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeJSON("jwt_keyset.json", keyset.KeySetFile{ActiveKid: "test-1", Keys: []keyset.KeyEntry{entry}})
+
+	// Accounts, bcrypt with min cost keeps tests fast
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeJSON("users.json", map[string]auth.UserRecord{
+		"alice": {PasswordHash: string(passwordHash), Role: "Member"},
+		"admin": {PasswordHash: string(passwordHash), Role: "Admin"},
+	})
+
+	ts.writeJSON("policy.json", map[string]map[string][]string{
+		"roles": {"Admin": {"*"}, "Operator": {"service:read"}, "Member": {"service:read"}},
+	})
+
+	// API keys, hashed with HMAC key
+	hmacKey, err := apikey.GenerateHMACKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile("apikey_hmac.key", hmacKey)
+	ts.hmacKey, err = apikey.ReadHMACKeyFile(filepath.Join(dir, "apikey_hmac.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) == 0 {
+		records = []apikey.Record{{Client: "web", Scopes: []string{"login"}}}
+	}
+	keyFile := apikey.KeyFile{Keys: map[string]apikey.Record{}}
+	for _, record := range records {
+		rawKey, keyID, err := apikey.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Hash = apikey.HashKey(rawKey, ts.hmacKey)
+		keyFile.Keys[keyID] = record
+		ts.apiKeys[record.Client] = rawKey
+		ts.keyIDs[record.Client] = keyID
+	}
+	ts.writeJSON("apikey.json", keyFile)
+
+	return ts
+}
+
+// start sets up API server with default test config and overrides
+func (ts *testServer) start(overrides testConfig) {
+
+	t := ts.t
+
+	// Config
+	cfg := defaultTestConfig()
+	for section, keys := range overrides {
+		if cfg[section] == nil {
+			cfg[section] = map[string]string{}
+		}
+		for key, value := range keys {
+			cfg[section][key] = value
+		}
+	}
+	cfg.write(t, filepath.Join(ts.dir, "config.ini"))
+
+	ts.cfg = &conf.Conf{}
+	if err := ts.cfg.Load(filepath.Join(ts.dir, "config.ini")); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logrus.New()
+	log.Out = ts.logs
+	log.Level = logrus.DebugLevel
+
+	engine, err := SetupServer(ts.cfg, logrus.NewEntry(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.engine = engine
+}
+
+func (ts *testServer) writeFile(name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(ts.dir, name), []byte(content), 0600); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testServer) writeJSON(name string, v interface{}) {
+	if err := utils.WriteJsonFileAtomic(filepath.Join(ts.dir, name), v); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// newRequest returns request with body marshalled to json, no body if nil
+func (ts *testServer) newRequest(method, target string, body interface{}) *http.Request {
+
+	var reader io.Reader
+	if body != nil {
+		byteValue, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(byteValue)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req
+}
+
+func (ts *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+
+	w := httptest.NewRecorder()
+	ts.engine.ServeHTTP(w, req)
+
+	return w
+}
+
+// call sends request with API key of client if not empty, and bearer token if not empty
+func (ts *testServer) call(method, target, client, token string, body interface{}) *httptest.ResponseRecorder {
+
+	req := ts.newRequest(method, target, body)
+	if client != "" {
+		req.Header.Set("X-API-Key", ts.apiKeys[client])
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return ts.serve(req)
+}
+
+// login logs account in with API key of client and returns token pair
+func (ts *testServer) login(client, account string) LoginSucceed {
+
+	w := ts.call(http.MethodPost, "/api/v1/login", client, "", LoginReceiveBody{Account: account, Password: testPassword})
+	if w.Code != http.StatusOK {
+		ts.t.Fatalf("login %s status = %d, body = %s", account, w.Code, w.Body.String())
+	}
+
+	var loginSucceed LoginSucceed
+	decodeBody(ts.t, w, &loginSucceed)
+
+	return loginSucceed
+}
+
+// auditEvents returns events of type written to audit log
+func (ts *testServer) auditEvents(eventType string) []audit.Event {
+
+	file, err := os.Open(filepath.Join(ts.dir, "audit.log"))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			ts.t.Fatal(err)
+		}
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return events
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode body %s failed: %v", w.Body.String(), err)
+	}
+}
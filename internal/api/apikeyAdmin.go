@@ -0,0 +1,372 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+)
+
+// API key admin receive and response struct
+
+type CreateAPIKeyReceiveBody struct {
+	Client         string     `json:"Client" example:"Partner1" format:"string"`
+	Tenant         string     `json:"Tenant" example:"BusinessUnit1" format:"string"` // tenant of admin if empty
+	Scopes         []string   `json:"Scopes" example:"login"`
+	Routes         []string   `json:"Routes" example:"POST /api/v1/login"`
+	NotBefore      *time.Time `json:"NotBefore" example:"2021-08-01T00:00:00Z" format:"date-time"`
+	ExpiresAt      *time.Time `json:"ExpiresAt" example:"2022-08-01T00:00:00Z" format:"date-time"`
+	AllowedCIDRs   []string   `json:"AllowedCIDRs" example:"10.0.0.0/8"`
+	RequireSigning bool       `json:"RequireSigning" example:"false"`
+}
+
+type RotateAPIKeyReceiveBody struct {
+	OverlapSeconds int `json:"OverlapSeconds" example:"3600"`
+}
+
+type APIKeyInfo struct {
+	KeyID          string     `json:"keyId" example:"1f2e3d4c5b6a7980" format:"string"`
+	Client         string     `json:"client" example:"Partner1" format:"string"`
+	Tenant         string     `json:"tenant,omitempty" example:"BusinessUnit1" format:"string"`
+	Scopes         []string   `json:"scopes" example:"login"`
+	Routes         []string   `json:"routes" example:"POST /api/v1/login"`
+	NotBefore      *time.Time `json:"notBefore" format:"date-time"`
+	ExpiresAt      *time.Time `json:"expiresAt" format:"date-time"`
+	AllowedCIDRs   []string   `json:"allowedCidrs" example:"10.0.0.0/8"`
+	RequireSigning bool       `json:"requireSigning" example:"false"`
+	Disabled       bool       `json:"disabled" example:"false"`
+}
+
+type APIKeyListSucceed struct {
+	Keys []APIKeyInfo `json:"keys"`
+}
+
+type APIKeyCreatedSucceed struct {
+	KeyID         string `json:"keyId" example:"1f2e3d4c5b6a7980" format:"string"`
+	Client        string `json:"client" example:"Partner1" format:"string"`
+	APIKey        string `json:"apiKey" example:"ak_1f2e3d4c5b6a7980.secret" format:"string"`
+	SigningSecret string `json:"signingSecret,omitempty" example:"request signing secret" format:"string"` // only when API key HMAC key is configured
+}
+
+type APIKeyAdminSucceed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+type APIKeyAdminFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// managesTenant checks whether admin can manage API keys of tenant, admin of a tenant only manages keys of its own tenant
+func managesTenant(c *gin.Context, tenantName string) bool {
+
+	adminTenant := c.GetString("tenant")
+
+	return adminTenant == "" || adminTenant == tenantName
+}
+
+// managesKey checks whether API key exists and admin can manage it, key of another tenant is treated as not found
+func managesKey(c *gin.Context, apiKeyStore *apikey.Store, keyID string) bool {
+
+	record, ok := apiKeyStore.LookupID(keyID)
+
+	return ok && managesTenant(c, record.Tenant)
+}
+
+// @Summary List API keys.
+// @Description list API keys with metadata, secrets are never returned, admin only. Admin of a tenant only lists keys of its tenant
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Produce  json
+// @Tags API Key Admin
+// @version 1.0
+// @Success 200 {object} APIKeyListSucceed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Router /api/v1/admin/apikeys [get]
+func ListAPIKeys(c *gin.Context) {
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	var listSucceed = APIKeyListSucceed{Keys: []APIKeyInfo{}}
+	for keyID, record := range apiKeyStore.List() {
+		if !managesTenant(c, record.Tenant) {
+			continue
+		}
+		listSucceed.Keys = append(listSucceed.Keys, APIKeyInfo{
+			KeyID:          keyID,
+			Client:         record.Client,
+			Tenant:         record.Tenant,
+			Scopes:         record.Scopes,
+			Routes:         record.Routes,
+			NotBefore:      record.NotBefore,
+			ExpiresAt:      record.ExpiresAt,
+			AllowedCIDRs:   record.AllowedCIDRs,
+			RequireSigning: record.RequireSigning,
+			Disabled:       record.Disabled,
+		})
+	}
+
+	// Keep order stable
+	sort.Slice(listSucceed.Keys, func(i, j int) bool {
+		if listSucceed.Keys[i].Client != listSucceed.Keys[j].Client {
+			return listSucceed.Keys[i].Client < listSucceed.Keys[j].Client
+		}
+		return listSucceed.Keys[i].KeyID < listSucceed.Keys[j].KeyID
+	})
+
+	c.JSON(http.StatusOK, listSucceed)
+	return
+}
+
+// @Summary Create API key.
+// @Description create API key of client, the API key is only returned once, admin only. Admin of a tenant only creates keys of its tenant
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body CreateAPIKeyReceiveBody true "Client and restrictions of API key"
+// @Tags API Key Admin
+// @version 1.0
+// @Success 200 {object} APIKeyCreatedSucceed
+// @Failure 400 {object} APIKeyAdminFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 409 {object} APIKeyAdminFailed
+// @Failure 500 {object} APIKeyAdminFailed
+// @Router /api/v1/admin/apikeys [post]
+func CreateAPIKey(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = CreateAPIKeyReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || receiveBody.Client == "" {
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "bad request: Client is required"
+		c.JSON(http.StatusBadRequest, adminFailed)
+		logger.Warn("Admin " + admin + " create API key bad request")
+		return
+	}
+
+	// Key is of tenant of admin if not given
+	if receiveBody.Tenant == "" {
+		receiveBody.Tenant = c.GetString("tenant")
+	}
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	if !tenants.Exists(receiveBody.Tenant) || !managesTenant(c, receiveBody.Tenant) {
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "bad request: can not create API key of tenant " + receiveBody.Tenant
+		c.JSON(http.StatusBadRequest, adminFailed)
+		logger.Warn("Admin " + admin + " of tenant " + c.GetString("tenant") + " create API key of tenant " + receiveBody.Tenant + " bad request")
+		auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeFailure, Target: "client " + receiveBody.Client, Reason: "create API key of tenant " + receiveBody.Tenant + ": not allowed"})
+		return
+	}
+
+	record := apikey.Record{
+		Client:         receiveBody.Client,
+		Tenant:         receiveBody.Tenant,
+		Scopes:         receiveBody.Scopes,
+		Routes:         receiveBody.Routes,
+		NotBefore:      receiveBody.NotBefore,
+		ExpiresAt:      receiveBody.ExpiresAt,
+		AllowedCIDRs:   receiveBody.AllowedCIDRs,
+		RequireSigning: receiveBody.RequireSigning,
+	}
+
+	// Malformed restrictions are bad request, not store failure
+	if err := record.ValidateRestrictions(); err != nil {
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "bad request: " + err.Error()
+		c.JSON(http.StatusBadRequest, adminFailed)
+		logger.Warn("Admin " + admin + " create API key of client " + receiveBody.Client + " bad request: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeFailure, Target: "client " + receiveBody.Client, Reason: "create API key: " + err.Error()})
+		return
+	}
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Create API key and persist to API key file
+	apiKey, keyID, err := apiKeyStore.Create(record)
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == apikey.ErrPlaintextKeyFile {
+			status = http.StatusConflict
+		}
+
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "create API key of client " + receiveBody.Client + " failed: " + err.Error()
+		c.JSON(status, adminFailed)
+		logger.Warn("Admin " + admin + " create API key of client " + receiveBody.Client + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeFailure, Target: "client " + receiveBody.Client, Reason: "create API key: " + err.Error()})
+		return
+	}
+
+	var createdSucceed = APIKeyCreatedSucceed{}
+	createdSucceed.KeyID = keyID
+	createdSucceed.Client = receiveBody.Client
+	createdSucceed.APIKey = apiKey
+	createdSucceed.SigningSecret, _ = apiKeyStore.SigningSecret(keyID)
+	c.JSON(http.StatusOK, createdSucceed)
+
+	auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeSuccess, Target: keyID, Reason: "created API key of client " + receiveBody.Client})
+	return
+}
+
+// @Summary Rotate API key.
+// @Description create a new API key with same metadata, the old key keeps working for overlap seconds, admin only
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param keyId path string true "Key id"
+// @Param Body body RotateAPIKeyReceiveBody false "Overlap of old key, 0 if no body"
+// @Tags API Key Admin
+// @version 1.0
+// @Success 200 {object} APIKeyCreatedSucceed
+// @Failure 400 {object} APIKeyAdminFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 404 {object} APIKeyAdminFailed
+// @Failure 409 {object} APIKeyAdminFailed
+// @Failure 500 {object} APIKeyAdminFailed
+// @Router /api/v1/admin/apikeys/{keyId}/rotate [post]
+func RotateAPIKey(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch key id
+	keyID := c.Param("keyId")
+
+	// Fetch body received, body is optional and overlap is 0 without it
+	var receiveBody = RotateAPIKeyReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil || receiveBody.OverlapSeconds < 0 {
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "bad request: OverlapSeconds should not be negative"
+		c.JSON(http.StatusBadRequest, adminFailed)
+		logger.Warn("Admin " + admin + " rotate API key " + keyID + " bad request")
+		return
+	}
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Rotate API key and persist to API key file, key of another tenant is not found
+	var apiKey, newKeyID string
+	if managesKey(c, apiKeyStore, keyID) {
+		apiKey, newKeyID, err = apiKeyStore.Rotate(keyID, time.Duration(receiveBody.OverlapSeconds)*time.Second)
+	} else {
+		err = apikey.ErrKeyNotFound
+	}
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == apikey.ErrKeyNotFound {
+			status = http.StatusNotFound
+		}
+		if err == apikey.ErrPlaintextKeyFile || err == apikey.ErrRotateDisabledKey {
+			status = http.StatusConflict
+		}
+
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "rotate API key " + keyID + " failed: " + err.Error()
+		c.JSON(status, adminFailed)
+		logger.Warn("Admin " + admin + " rotate API key " + keyID + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeFailure, Target: keyID, Reason: "rotate API key: " + err.Error()})
+		return
+	}
+
+	client := apiKeyStore.List()[newKeyID].Client
+
+	var createdSucceed = APIKeyCreatedSucceed{}
+	createdSucceed.KeyID = newKeyID
+	createdSucceed.Client = client
+	createdSucceed.APIKey = apiKey
+	createdSucceed.SigningSecret, _ = apiKeyStore.SigningSecret(newKeyID)
+	c.JSON(http.StatusOK, createdSucceed)
+
+	auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeSuccess, Target: keyID, Reason: "rotated API key to " + newKeyID + " of client " + client})
+	return
+}
+
+// @Summary Revoke API key.
+// @Description disable API key immediately, admin only
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Produce  json
+// @Param keyId path string true "Key id"
+// @Tags API Key Admin
+// @version 1.0
+// @Success 200 {object} APIKeyAdminSucceed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 404 {object} APIKeyAdminFailed
+// @Failure 409 {object} APIKeyAdminFailed
+// @Failure 500 {object} APIKeyAdminFailed
+// @Router /api/v1/admin/apikeys/{keyId} [delete]
+func RevokeAPIKey(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch key id
+	keyID := c.Param("keyId")
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Revoke API key and persist to API key file, key of another tenant is not found
+	err := apikey.ErrKeyNotFound
+	if managesKey(c, apiKeyStore, keyID) {
+		err = apiKeyStore.Revoke(keyID)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == apikey.ErrKeyNotFound {
+			status = http.StatusNotFound
+		}
+		if err == apikey.ErrPlaintextKeyFile {
+			status = http.StatusConflict
+		}
+
+		var adminFailed = APIKeyAdminFailed{}
+		adminFailed.Message = "revoke API key " + keyID + " failed: " + err.Error()
+		c.JSON(status, adminFailed)
+		logger.Warn("Admin " + admin + " revoke API key " + keyID + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeFailure, Target: keyID, Reason: "revoke API key: " + err.Error()})
+		return
+	}
+
+	var adminSucceed = APIKeyAdminSucceed{}
+	adminSucceed.Message = "revoke API key " + keyID + " succeed."
+	c.JSON(http.StatusOK, adminSucceed)
+
+	auditLog(c, audit.Event{Type: audit.EventAdminAction, Outcome: audit.OutcomeSuccess, Target: keyID, Reason: "revoked API key"})
+	return
+}
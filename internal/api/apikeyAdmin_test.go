@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyAdmin(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	adminToken := ts.login("web", "admin").Token
+
+	loginWith := func(apiKey string) int {
+		req := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "alice", Password: testPassword})
+		req.Header.Set("X-API-Key", apiKey)
+		return ts.serve(req).Code
+	}
+
+	// Create
+	w := ts.call(http.MethodPost, "/api/v1/admin/apikeys", "", adminToken, CreateAPIKeyReceiveBody{Client: "Partner1", Scopes: []string{"login"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var created APIKeyCreatedSucceed
+	decodeBody(t, w, &created)
+	if created.Client != "Partner1" || !strings.HasPrefix(created.APIKey, "ak_"+created.KeyID+".") {
+		t.Fatalf("created = %+v, want key of Partner1", created)
+	}
+	if status := loginWith(created.APIKey); status != http.StatusOK {
+		t.Errorf("login with created key status = %d, want %d", status, http.StatusOK)
+	}
+
+	// List has metadata of keys, never the secrets
+	w = ts.call(http.MethodGet, "/api/v1/admin/apikeys", "", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), created.APIKey) || strings.Contains(w.Body.String(), "hmac-sha256:") {
+		t.Errorf("list = %s, want no keys or hashes", w.Body.String())
+	}
+	var list APIKeyListSucceed
+	decodeBody(t, w, &list)
+	if len(list.Keys) != 2 || list.Keys[0].Client != "Partner1" || list.Keys[1].Client != "web" {
+		t.Errorf("list = %+v, want keys of Partner1 and web", list.Keys)
+	}
+
+	// Rotate with overlap, both keys work until overlap ends
+	w = ts.call(http.MethodPost, "/api/v1/admin/apikeys/"+created.KeyID+"/rotate", "", adminToken, RotateAPIKeyReceiveBody{OverlapSeconds: 3600})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var rotated APIKeyCreatedSucceed
+	decodeBody(t, w, &rotated)
+	if rotated.Client != "Partner1" || rotated.KeyID == created.KeyID {
+		t.Fatalf("rotated = %+v, want new key of Partner1", rotated)
+	}
+	if status := loginWith(created.APIKey); status != http.StatusOK {
+		t.Errorf("login with old key in overlap status = %d, want %d", status, http.StatusOK)
+	}
+	if status := loginWith(rotated.APIKey); status != http.StatusOK {
+		t.Errorf("login with rotated key status = %d, want %d", status, http.StatusOK)
+	}
+
+	// Rotate without body, old key stops working now
+	w = ts.call(http.MethodPost, "/api/v1/admin/apikeys/"+rotated.KeyID+"/rotate", "", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate without body status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if status := loginWith(rotated.APIKey); status != http.StatusUnauthorized {
+		t.Errorf("login with key rotated without overlap status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Revoke
+	if w := ts.call(http.MethodDelete, "/api/v1/admin/apikeys/"+created.KeyID, "", adminToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if status := loginWith(created.APIKey); status != http.StatusUnauthorized {
+		t.Errorf("login with revoked key status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       interface{}
+		wantStatus int
+	}{
+		{"create without client", http.MethodPost, "/api/v1/admin/apikeys", CreateAPIKeyReceiveBody{}, http.StatusBadRequest},
+		{"create with malformed cidr", http.MethodPost, "/api/v1/admin/apikeys", CreateAPIKeyReceiveBody{Client: "Partner2", AllowedCIDRs: []string{"10.0.0.1"}}, http.StatusBadRequest},
+		{"create of unknown tenant", http.MethodPost, "/api/v1/admin/apikeys", CreateAPIKeyReceiveBody{Client: "Partner2", Tenant: "missing"}, http.StatusBadRequest},
+		{"rotate with negative overlap", http.MethodPost, "/api/v1/admin/apikeys/" + rotated.KeyID + "/rotate", RotateAPIKeyReceiveBody{OverlapSeconds: -1}, http.StatusBadRequest},
+		{"rotate unknown key", http.MethodPost, "/api/v1/admin/apikeys/missing/rotate", nil, http.StatusNotFound},
+		{"rotate revoked key", http.MethodPost, "/api/v1/admin/apikeys/" + created.KeyID + "/rotate", nil, http.StatusConflict},
+		{"revoke unknown key", http.MethodDelete, "/api/v1/admin/apikeys/missing", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := ts.call(tt.method, tt.target, "", adminToken, tt.body); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// Header of request id, it is returned in response and written to audit log
+const RequestIDHeader = "X-Request-ID"
+
+// Request id from client is only reused in this format, so it can not forge audit log lines
+var requestIDFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID sets request id of request to context and response, request id from client is reused if valid
+func RequestID(c *gin.Context) {
+
+	requestID := c.GetHeader(RequestIDHeader)
+	if !requestIDFormat.MatchString(requestID) {
+		requestID = hex.EncodeToString(utils.GenerateRandomBytes(16))
+	}
+
+	c.Set("requestID", requestID)
+	c.Header(RequestIDHeader, requestID)
+
+	c.Next()
+}
+
+// auditLog writes security event to audit log, and fills who, where and which request from context.
+// Failure of audit log does not fail request, but is logged.
+func auditLog(c *gin.Context, event audit.Event) {
+
+	// Fetch audit logger
+	auditLogger := c.MustGet("AuditLogger").(audit.Logger)
+
+	event.Time = time.Now()
+	if event.Client == "" {
+		event.Client = c.GetString("client")
+	}
+	if event.Tenant == "" {
+		event.Tenant = c.GetString("tenant")
+	}
+	// With impersonation token, actor is the real account and account is the effective one
+	if actor := c.GetString("actor"); actor != "" && event.Subject == "" {
+		event.Subject = c.GetString("account")
+	}
+	if event.Actor == "" {
+		event.Actor = c.GetString("actor")
+	}
+	if event.Actor == "" {
+		event.Actor = c.GetString("account")
+	}
+	if event.Actor == "" {
+		event.Actor = event.Client
+	}
+	event.IP = c.ClientIP()
+	event.RequestID = c.GetString("requestID")
+	if event.Action == "" {
+		event.Action = c.Request.Method + " " + c.Request.URL.Path
+	}
+
+	if err := auditLogger.Log(event); err != nil {
+		// Fetch logger
+		logger := c.MustGet("Logger").(*logrus.Entry)
+
+		logger.Warn("Write audit log of " + event.Type + " failed: " + err.Error())
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool // request id of client is reused
+	}{
+		{"request id of client", "req-2021.08_01", true},
+		{"no request id", "", false},
+		{"request id with space", "req 1", false},
+		{"request id with newline", "req-1\n{\"type\":\"login\"}", false},
+		{"too long request id", strings.Repeat("a", 65), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "alice", Password: testPassword})
+			req.Header.Set("X-API-Key", ts.apiKeys["web"])
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			w := ts.serve(req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if tt.wantSame && requestID != tt.requestID {
+				t.Errorf("response request id = %q, want %q", requestID, tt.requestID)
+			}
+			if !tt.wantSame && !generated.MatchString(requestID) {
+				t.Errorf("response request id = %q, want generated one", requestID)
+			}
+
+			// Events of request carry the same request id
+			events := ts.auditEvents("login")
+			if len(events) == 0 || events[len(events)-1].RequestID != requestID {
+				t.Errorf("login events = %+v, want last one of request id %q", events, requestID)
+			}
+		})
+	}
+}
+
+func TestAuditLogContext(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	token := ts.login("web", "alice").Token
+	ts.call(http.MethodGet, "/api/v1/admin/apikeys", "", token, nil)
+
+	// Who, where and which request are filled from context
+	logins := ts.auditEvents("login")
+	if len(logins) != 1 {
+		t.Fatalf("login events = %+v, want one", logins)
+	}
+	if event := logins[0]; event.Outcome != "success" || event.Actor != "alice" || event.Client != "web" || event.IP != "192.0.2.1" || event.Action != "POST /api/v1/login" {
+		t.Errorf("login event = %+v, want success of alice with web from 192.0.2.1", event)
+	}
+
+	denials := ts.auditEvents("access_denied")
+	if len(denials) != 1 {
+		t.Fatalf("access_denied events = %+v, want one", denials)
+	}
+	if event := denials[0]; event.Outcome != "failure" || event.Actor != "alice" || event.Action != "GET /api/v1/admin/apikeys" || event.Time.IsZero() {
+		t.Errorf("access_denied event = %+v, want failure of alice on GET /api/v1/admin/apikeys", event)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/mtls"
+)
+
+// Confirmation claim of RFC 7800, token is bound to client certificate by X5tS256 of RFC 8705, or to API key client by Client
+type Confirmation struct {
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	Client  string `json:"client,omitempty"`
+}
+
+// confirmationOf returns confirmation of client which requests token, nil if binding is disabled.
+// Client certificate is preferred over API key client.
+func confirmationOf(c *gin.Context, client string) *Confirmation {
+
+	// Fetch token options
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	if !tokenOptions.BindToClient {
+		return nil
+	}
+
+	if thumbprint := c.GetString("clientCertThumbprint"); thumbprint != "" {
+		return &Confirmation{X5tS256: thumbprint}
+	}
+
+	if client != "" {
+		return &Confirmation{Client: client}
+	}
+
+	return nil
+}
+
+// ValidatePresentedClient checks client certificate, API key or signed request presented with token by ValidateClient, which sets client to context.
+// So a bound token is compared with the client already validated, not with a raw header. Request without client credentials is only checked by token.
+func ValidatePresentedClient(c *gin.Context) {
+
+	// Fetch client auth mode
+	clientAuth := c.MustGet("ClientAuth").(string)
+
+	presented := c.GetHeader("X-API-Key") != "" || c.GetHeader(apikey.HeaderSignature) != ""
+
+	// Client certificate is only a client credential when client auth mode accepts it, verifiedClientCert is in mtls.go
+	if clientAuth != mtls.ClientAuthAPIKey && verifiedClientCert(c.Request) != nil {
+		presented = true
+	}
+
+	if !presented {
+		c.Next()
+		return
+	}
+
+	// Route restrictions of client are for the routes it calls itself, checkClientRecord only checks validity and source of client presented with token
+	c.Set("clientWithToken", true)
+
+	// ValidateClient is in mtls.go
+	ValidateClient(c)
+}
+
+// checkClientRecord checks restrictions of API key or client certificate record on request
+func checkClientRecord(c *gin.Context, record apikey.Record) error {
+
+	if c.GetBool("clientWithToken") {
+		return record.CheckUsable(time.Now(), c.ClientIP())
+	}
+
+	return record.Check(time.Now(), c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+}
+
+// checkConfirmation checks bound token is presented with client certificate of the same thumbprint, or API key of the same client.
+// Client is the one validated by ValidatePresentedClient. Token without confirmation is not bound.
+func checkConfirmation(c *gin.Context, cnf *Confirmation) error {
+
+	if cnf == nil {
+		return nil
+	}
+
+	if cnf.X5tS256 != "" {
+		if c.GetString("clientCertThumbprint") != cnf.X5tS256 {
+			return &TokenError{Code: TokenErrBindingMismatch, Message: "token is not presented with bound client certificate"}
+		}
+
+		return nil
+	}
+
+	if c.GetString("apiKeyID") == "" || c.GetString("client") != cnf.Client {
+		return &TokenError{Code: TokenErrBindingMismatch, Message: "token is not presented with API key of bound client"}
+	}
+
+	return nil
+}
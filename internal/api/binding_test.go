@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/mtls"
+)
+
+// confirmationOfToken returns cnf claim of token without verifying it
+func confirmationOfToken(t *testing.T, token string) *Confirmation {
+
+	claims := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.Cnf
+}
+
+func TestBindToAPIKeyClient(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"TOKEN": {"Bind_To_Client": "true"}},
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "other", Scopes: []string{"login"}},
+	)
+
+	token := ts.login("web", "alice").Token
+	if cnf := confirmationOfToken(t, token); cnf == nil || cnf.Client != "web" || cnf.X5tS256 != "" {
+		t.Fatalf("token cnf = %+v, want client web", cnf)
+	}
+
+	tests := []struct {
+		name       string
+		req        func() *http.Request
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			"API key of bound client",
+			func() *http.Request {
+				req := ts.newRequest(http.MethodGet, "/api/v1/getServiceInfo", nil)
+				req.Header.Set("X-API-Key", ts.apiKeys["web"])
+				return req
+			},
+			http.StatusOK, "",
+		},
+		{
+			"signed request of bound client",
+			func() *http.Request {
+				return ts.signedRequest("web", http.MethodGet, "/api/v1/getServiceInfo", nil, time.Now(), "nonce-bound-00001")
+			},
+			http.StatusOK, "",
+		},
+		{
+			"no API key",
+			func() *http.Request {
+				return ts.newRequest(http.MethodGet, "/api/v1/getServiceInfo", nil)
+			},
+			http.StatusUnauthorized, TokenErrBindingMismatch,
+		},
+		{
+			"API key of other client",
+			func() *http.Request {
+				req := ts.newRequest(http.MethodGet, "/api/v1/getServiceInfo", nil)
+				req.Header.Set("X-API-Key", ts.apiKeys["other"])
+				return req
+			},
+			http.StatusUnauthorized, TokenErrBindingMismatch,
+		},
+		{
+			"unknown API key",
+			func() *http.Request {
+				req := ts.newRequest(http.MethodGet, "/api/v1/getServiceInfo", nil)
+				req.Header.Set("X-API-Key", "ak_unknown")
+				return req
+			},
+			http.StatusUnauthorized, "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req()
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := ts.serve(req)
+
+			var authFailedResp AuthFailedResp
+			if w.Code != http.StatusOK {
+				decodeBody(t, w, &authFailedResp)
+			}
+			if w.Code != tt.wantStatus || authFailedResp.Code != tt.wantCode {
+				t.Errorf("status = %d, body = %s, want %d with %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	// Refreshed token is bound too
+	w := ts.call(http.MethodPost, "/api/v1/token/refresh", "web", "", RefreshReceiveBody{RefreshToken: ts.login("web", "alice").RefreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var refreshed LoginSucceed
+	decodeBody(t, w, &refreshed)
+	if cnf := confirmationOfToken(t, refreshed.Token); cnf == nil || cnf.Client != "web" {
+		t.Errorf("refreshed token cnf = %+v, want client web", cnf)
+	}
+}
+
+func TestBindToClientCert(t *testing.T) {
+
+	ts := newMTLSTestServer(t, mtls.ClientAuthBoth, testConfig{"TOKEN": {"Bind_To_Client": "true"}})
+
+	partnerCert, _ := newTestClientCert(t, "partner.client.local")
+	readerCert, _ := newTestClientCert(t, "reader.client.local")
+
+	// withCert returns request with client certificate verified in TLS handshake, no certificate if nil
+	withCert := func(method, target string, cert *x509.Certificate, body interface{}) *http.Request {
+		req := ts.newRequest(method, target, body)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return req
+	}
+
+	w := ts.serve(withCert(http.MethodPost, "/api/v1/login", partnerCert, LoginReceiveBody{Account: "alice", Password: testPassword}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var loginSucceed LoginSucceed
+	decodeBody(t, w, &loginSucceed)
+	if cnf := confirmationOfToken(t, loginSucceed.Token); cnf == nil || cnf.X5tS256 != mtls.Thumbprint(partnerCert) {
+		t.Fatalf("token cnf = %+v, want thumbprint of partner certificate", cnf)
+	}
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		client     string
+		wantStatus int
+	}{
+		{"bound certificate", partnerCert, "", http.StatusOK},
+		{"other mapped certificate", readerCert, "", http.StatusUnauthorized},
+		{"API key instead of certificate", nil, "web", http.StatusUnauthorized},
+		{"no client credentials", nil, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withCert(http.MethodGet, "/api/v1/getServiceInfo", tt.cert, nil)
+			req.Header.Set("Authorization", "Bearer "+loginSucceed.Token)
+			if tt.client != "" {
+				req.Header.Set("X-API-Key", ts.apiKeys[tt.client])
+			}
+
+			if w := ts.serve(req); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, body = %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUnboundToken(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	token := ts.login("web", "alice").Token
+	if cnf := confirmationOfToken(t, token); cnf != nil {
+		t.Fatalf("token cnf = %+v, want none when binding is disabled", cnf)
+	}
+
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", token, nil); w.Code != http.StatusOK {
+		t.Errorf("unbound token without API key status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTenantRateLimitWithClient(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"TENANT limited": {"Requests_Per_Minute": "3"}},
+		apikey.Record{Client: "web", Tenant: "limited", Scopes: []string{"login"}},
+	)
+
+	// Login is the first request, each request with token and API key is counted once
+	token := ts.login("web", "alice").Token
+	for i := 0; i < 2; i++ {
+		if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "web", token, nil); w.Code != http.StatusOK {
+			t.Fatalf("request %d with token and API key status = %d, body = %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "web", token, nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over limit status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseTrustedProxies parses proxy IPs or CIDRs of [API SERVER] Trusted_Proxies, a single IP is a /32 or /128 CIDR
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+
+	trustedCIDRs := []*net.IPNet{}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.New("trusted proxy " + proxy + " is not an IP or CIDR")
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.New("trusted proxy " + proxy + " is not an IP or CIDR")
+		}
+		trustedCIDRs = append(trustedCIDRs, cidr)
+	}
+
+	return trustedCIDRs, nil
+}
+
+// ResolveClientIP returns middleware which replaces remote address of request from trusted proxy with client IP in X-Forwarded-For,
+// so c.ClientIP() is the client whether server runs by gin or by http.Server. Engine should not forward by client IP itself.
+// X-Forwarded-For is read from right to left, and the first IP which is not a trusted proxy is the client.
+func ResolveClientIP(trustedCIDRs []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		remoteIP, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+		if err != nil || !isTrustedProxy(trustedCIDRs, net.ParseIP(remoteIP)) {
+			c.Next()
+			return
+		}
+
+		forwardedFor := strings.Split(strings.Join(c.Request.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwardedFor) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(forwardedFor[i]))
+			if ip == nil {
+				// Malformed hop, the remaining hops can not be trusted
+				break
+			}
+			if !isTrustedProxy(trustedCIDRs, ip) {
+				c.Request.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+				break
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func isTrustedProxy(trustedCIDRs []*net.IPNet, ip net.IP) bool {
+
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range trustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+)
+
+// Impersonate receive and response struct
+
+type ImpersonateReceiveBody struct {
+	Account string `json:"Account" example:"account" format:"string"`
+	Reason  string `json:"Reason" example:"reproduce ticket 1234" format:"string"` // written to audit log
+}
+
+type ImpersonateSucceed struct {
+	Token     string `json:"token" example:"eyJhbGciOiJFUzI1NiIsImtpZCI6ImVzLTIwMjEtMDgiLCJ0eXAiOiJKV1QifQ..." format:"string"`
+	Account   string `json:"account" example:"account" format:"string"`
+	ExpiresIn int64  `json:"expires_in" example:"900"`
+}
+
+type ImpersonateFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// @Summary Mint impersonation token of account.
+// @Description issue short-lived token to act as account without its password, the token has act claim of admin and no refresh token, admin only
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body ImpersonateReceiveBody true "Account and Reason"
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} ImpersonateSucceed
+// @Failure 400 {object} ImpersonateFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 404 {object} ImpersonateFailed
+// @Failure 500 {object} ImpersonateFailed
+// @Router /api/v1/admin/impersonate [post]
+func Impersonate(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = ImpersonateReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || receiveBody.Account == "" || receiveBody.Reason == "" {
+		var impersonateFailed = ImpersonateFailed{}
+		impersonateFailed.Message = "bad request: Account and Reason are required"
+		c.JSON(http.StatusBadRequest, impersonateFailed)
+		logger.Warn("Admin " + admin + " impersonate bad request")
+		return
+	}
+
+	if receiveBody.Account == admin {
+		var impersonateFailed = ImpersonateFailed{}
+		impersonateFailed.Message = "can not impersonate yourself"
+		c.JSON(http.StatusBadRequest, impersonateFailed)
+		logger.Warn("Admin " + admin + " try to impersonate itself")
+		return
+	}
+
+	// Fetch accounts
+	accounts := c.MustGet("Accounts").(*auth.Accounts)
+
+	// Find role of account
+	user, err := accounts.Lookup(receiveBody.Account)
+	if err != nil {
+		var impersonateFailed = ImpersonateFailed{}
+		impersonateFailed.Message = "impersonate account " + receiveBody.Account + " failed: " + err.Error()
+		c.JSON(accountErrorStatus(err), impersonateFailed)
+		logger.Warn("Admin " + admin + " impersonate account " + receiveBody.Account + " failed: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventImpersonation, Outcome: audit.OutcomeFailure, Subject: receiveBody.Account, Reason: err.Error()})
+		return
+	}
+
+	// Admin accounts can not be impersonated, otherwise the act of one admin is hidden behind another
+	if user.Role == "Admin" {
+		var forbiddenResp = ForbiddenResp{}
+		forbiddenResp.ErrorString = "admin account can not be impersonated"
+		forbiddenResp.Required = "role not Admin"
+		c.JSON(http.StatusForbidden, forbiddenResp)
+		auditLog(c, audit.Event{Type: audit.EventImpersonation, Outcome: audit.OutcomeFailure, Subject: user.Account, Reason: "admin account can not be impersonated"})
+		return
+	}
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	// Account is impersonated in tenant of admin, so its role should be allowed there
+	tenantName := c.GetString("tenant")
+	if !tenants.AllowsRole(tenantName, user.Role) {
+		var forbiddenResp = ForbiddenResp{}
+		forbiddenResp.ErrorString = tenant.ErrRoleNotAllowed.Error()
+		forbiddenResp.Required = "tenant " + tenantName
+		c.JSON(http.StatusForbidden, forbiddenResp)
+		logger.Warn("Admin " + admin + " impersonate account " + user.Account + " of role " + user.Role + " not allowed in tenant " + tenantName)
+		auditLog(c, audit.Event{Type: audit.EventImpersonation, Outcome: audit.OutcomeFailure, Subject: user.Account, Reason: tenant.ErrRoleNotAllowed.Error()})
+		return
+	}
+
+	// Fetch jwt keyset and token options
+	keySet := c.MustGet("KeySet").(*keyset.KeySet)
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	// Generate token of account with act of admin, authentication methods are of admin
+	amr := c.GetStringSlice("amr")
+	token, err := GenerateToken(keySet, tokenOptions, Claims{Account: user.Account, Role: user.Role, AMR: amr, ClientID: c.GetString("client"), Tenant: tenantName, Act: &Actor{Subject: admin}, Cnf: confirmationOf(c, c.GetString("client"))}, tokenOptions.ImpersonationTokenTTL)
+	if err != nil {
+		var impersonateFailed = ImpersonateFailed{}
+		impersonateFailed.Message = "impersonate account " + user.Account + " generate token failed."
+		c.JSON(http.StatusInternalServerError, impersonateFailed)
+		logger.Warn("Admin " + admin + " impersonate account " + user.Account + " generate token failed: " + err.Error())
+		return
+	}
+
+	var impersonateSucceed = ImpersonateSucceed{}
+	impersonateSucceed.Token = token
+	impersonateSucceed.Account = user.Account
+	impersonateSucceed.ExpiresIn = int64(tokenOptions.ImpersonationTokenTTL / time.Second)
+	c.JSON(http.StatusOK, impersonateSucceed)
+
+	auditLog(c, audit.Event{Type: audit.EventImpersonation, Outcome: audit.OutcomeSuccess, Subject: user.Account, Reason: "token minted: " + receiveBody.Reason})
+	return
+}
+
+// DenyImpersonation returns middleware to reject impersonation token, e.g. on routes which change credentials of account.
+// It should be used after AuthRequired.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if c.GetString("actor") != "" {
+			denyAccess(c, "no impersonation")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+)
+
+func TestImpersonate(t *testing.T) {
+
+	// Second admin account "ops" with the same password as admin
+	ts := prepareTestServer(t)
+	byteValue, err := ioutil.ReadFile(filepath.Join(ts.dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users map[string]auth.UserRecord
+	if err := json.Unmarshal(byteValue, &users); err != nil {
+		t.Fatal(err)
+	}
+	users["ops"] = users["admin"]
+	ts.writeJSON("users.json", users)
+	ts.start(nil)
+
+	adminToken := ts.login("web", "admin").Token
+
+	tests := []struct {
+		name       string
+		token      string
+		body       ImpersonateReceiveBody
+		wantStatus int
+	}{
+		{"member", ts.login("web", "alice").Token, ImpersonateReceiveBody{Account: "alice", Reason: "ticket 1234"}, http.StatusForbidden},
+		{"no reason", adminToken, ImpersonateReceiveBody{Account: "alice"}, http.StatusBadRequest},
+		{"unknown account", adminToken, ImpersonateReceiveBody{Account: "carol", Reason: "ticket 1234"}, http.StatusNotFound},
+		{"yourself", adminToken, ImpersonateReceiveBody{Account: "admin", Reason: "ticket 1234"}, http.StatusBadRequest},
+		{"other admin account", adminToken, ImpersonateReceiveBody{Account: "ops", Reason: "ticket 1234"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := ts.call(http.MethodPost, "/api/v1/admin/impersonate", "", tt.token, tt.body); w.Code != tt.wantStatus {
+				t.Errorf("impersonate status = %d, body = %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+
+	w := ts.call(http.MethodPost, "/api/v1/admin/impersonate", "", adminToken, ImpersonateReceiveBody{Account: "alice", Reason: "ticket 1234"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("impersonate status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var impersonateSucceed ImpersonateSucceed
+	decodeBody(t, w, &impersonateSucceed)
+	if impersonateSucceed.Account != "alice" || impersonateSucceed.ExpiresIn != 15*60 {
+		t.Errorf("impersonate = %+v, want token of alice which expires in 15 minutes", impersonateSucceed)
+	}
+	token := impersonateSucceed.Token
+
+	claims := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Account != "alice" || claims.Role != "Member" || claims.Act == nil || claims.Act.Subject != "admin" {
+		t.Errorf("impersonation token claims = %+v, want alice acted by admin", claims)
+	}
+
+	// Both identities are exposed, account is the effective one
+	var meSucceed MeSucceed
+	decodeBody(t, ts.call(http.MethodGet, "/api/v1/me", "", token, nil), &meSucceed)
+	if meSucceed.Account != "alice" || meSucceed.Role != "Member" || meSucceed.Actor != "admin" {
+		t.Errorf("me with impersonation token = %+v, want alice acted by admin", meSucceed)
+	}
+
+	// Credentials can not be changed with impersonation token
+	if w := ts.call(http.MethodPut, "/api/v1/accounts/password", "", token, ChangePasswordReceiveBody{OldPassword: testPassword, NewPassword: testNewPassword}); w.Code != http.StatusForbidden {
+		t.Errorf("change password with impersonation token status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Minting and every request with the token are logged with both identities
+	events := ts.auditEvents("impersonation")
+	var minted, requests, failed int
+	for _, event := range events {
+		if event.Actor != "admin" {
+			continue
+		}
+		switch {
+		case event.Subject == "alice" && event.Outcome == "success" && event.Reason == "token minted: ticket 1234":
+			minted++
+		case event.Subject == "alice" && event.Target == claims.Id && event.Outcome == "success":
+			requests++
+		case event.Subject == "alice" && event.Target == claims.Id && event.Outcome == "failure":
+			failed++
+		}
+	}
+	if minted != 1 || requests != 1 || failed != 1 {
+		t.Errorf("impersonation events = %+v, want one minted, one request succeed and one failed", events)
+	}
+
+	// Revoking tokens of account revokes impersonation token too
+	if w := ts.call(http.MethodPost, "/api/v1/admin/tokens/revoke", "", adminToken, RevokeTokensReceiveBody{Account: "alice"}); w.Code != http.StatusOK {
+		t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := ts.call(http.MethodGet, "/api/v1/me", "", token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked impersonation token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+)
+
+// Introspection response struct of RFC 7662, with role, amr, act and revocation state of this server
+
+type IntrospectSucceed struct {
+	Active    bool          `json:"active" example:"true"`
+	Revoked   bool          `json:"revoked" example:"false"`
+	Scope     string        `json:"scope,omitempty" example:"service:read" format:"string"`
+	ClientID  string        `json:"client_id,omitempty" example:"Service1" format:"string"`
+	Username  string        `json:"username,omitempty" example:"account" format:"string"`
+	Tenant    string        `json:"tenant,omitempty" example:"BusinessUnit1" format:"string"`
+	TokenType string        `json:"token_type,omitempty" example:"Bearer" format:"string"`
+	Exp       int64         `json:"exp,omitempty" example:"1627030327"`
+	Iat       int64         `json:"iat,omitempty" example:"1627029127"`
+	Nbf       int64         `json:"nbf,omitempty" example:"1627029127"`
+	Sub       string        `json:"sub,omitempty" example:"account" format:"string"`
+	Aud       string        `json:"aud,omitempty" example:"CXWEO-API" format:"string"`
+	Iss       string        `json:"iss,omitempty" example:"CXWEO" format:"string"`
+	Jti       string        `json:"jti,omitempty" example:"account1627029127-1a2b3c4d5e6f7a8b" format:"string"`
+	Role      string        `json:"role,omitempty" example:"Member" format:"string"`
+	AMR       []string      `json:"amr,omitempty" example:"pwd"`
+	Act       *Actor        `json:"act,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
+}
+
+// @Summary Introspect token.
+// @Description RFC 7662 introspection, client authenticates as in /oauth/token and its API key needs scope introspect. Token which is not valid is inactive without other fields, except revoked
+// @Param Authorization header string false "Basic base64(client_id:client_secret)"
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param token formData string true "token to introspect"
+// @Param token_type_hint formData string false "access_token"
+// @Param client_id formData string false "client of API key, if not in Authorization header"
+// @Param client_secret formData string false "API key, if not in Authorization header"
+// @Tags OAuth
+// @version 1.0
+// @Success 200 {object} IntrospectSucceed
+// @Failure 400 {object} OAuthFailed
+// @Failure 401 {object} OAuthFailed
+// @Failure 403 {object} OAuthFailed
+// @Router /oauth/introspect [post]
+func IntrospectToken(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Introspection response must not be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	// Read client credentials from HTTP Basic or form, oauthClientCredentials is in oauth.go
+	clientID, clientSecret, basicAuth, ok := oauthClientCredentials(c)
+	if !ok {
+		oauthFailed(c, http.StatusBadRequest, OAuthErrInvalidRequest, "malformed client credentials")
+		logger.Warn("OAuth introspection request from " + c.ClientIP() + " bad request: malformed client credentials")
+		return
+	}
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Authenticate client with API key, and the key must belong to client
+	keyID, record, ok := apiKeyStore.Lookup(clientSecret)
+	if !ok || clientID == "" || record.Client != clientID {
+		if basicAuth {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthFailed(c, http.StatusUnauthorized, OAuthErrInvalidClient, "client authentication failed")
+		logger.Warn("OAuth introspection request of client " + clientID + " from " + c.ClientIP() + " rejected: client authentication failed")
+		auditLog(c, audit.Event{Type: audit.EventAPIKeyUse, Outcome: audit.OutcomeFailure, Client: clientID, Reason: "introspection client authentication failed"})
+		return
+	}
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	// Check restrictions, scope and tenant of API key
+	err := record.Check(time.Now(), c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+	if err == nil && !record.HasScope("introspect") {
+		err = apikey.ErrScopeNotAllowed
+	}
+	if err == nil && record.RequireSigning {
+		err = apikey.ErrSigningRequired
+	}
+	if err == nil {
+		err = tenants.Check(record.Tenant, "", time.Now())
+	}
+	if err != nil {
+		status, errorCode := http.StatusUnauthorized, OAuthErrInvalidClient
+		if err == apikey.ErrSourceNotAllowed || err == apikey.ErrRouteNotAllowed || err == apikey.ErrScopeNotAllowed || err == apikey.ErrSigningRequired || err == tenant.ErrUnknownTenant {
+			status, errorCode = http.StatusForbidden, OAuthErrUnauthorizedClient
+		}
+		if err == tenant.ErrRateLimited {
+			status, errorCode = http.StatusTooManyRequests, OAuthErrUnauthorizedClient
+		}
+		oauthFailed(c, status, errorCode, err.Error())
+		logger.Warn("OAuth introspection request of client " + clientID + " API-Key " + keyID + " from " + c.ClientIP() + " rejected: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventAPIKeyUse, Outcome: audit.OutcomeFailure, Client: clientID, Target: keyID, Reason: "introspection: " + err.Error()})
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthFailed(c, http.StatusBadRequest, OAuthErrInvalidRequest, "token is required")
+		logger.Warn("OAuth introspection request of client " + clientID + " bad request: token is required")
+		return
+	}
+
+	// Token which can not be parsed, is not an access token, or is of another tenant, is inactive
+	var introspectSucceed = IntrospectSucceed{}
+	claims, err := parseAnyToken(c, token)
+	if err != nil || claims.TokenUse != "" || claims.Tenant != record.Tenant {
+		c.JSON(http.StatusOK, introspectSucceed)
+		logger.Info("OAuth introspection request of client " + clientID + " succeed, token is inactive")
+		return
+	}
+
+	// Fetch revocation store
+	revocationStore := c.MustGet("RevocationStore").(tokenstore.RevocationStore)
+
+	if isRevoked(revocationStore, claims) {
+		introspectSucceed.Revoked = true
+		c.JSON(http.StatusOK, introspectSucceed)
+		logger.Info("OAuth introspection request of client " + clientID + " succeed, token " + claims.Id + " is revoked")
+		return
+	}
+
+	introspectSucceed.Active = true
+	introspectSucceed.Scope = claims.Scope
+	introspectSucceed.ClientID = claims.ClientID
+	introspectSucceed.Username = claims.Account
+	introspectSucceed.Tenant = claims.Tenant
+	introspectSucceed.TokenType = "Bearer"
+	introspectSucceed.Exp = claims.ExpiresAt
+	introspectSucceed.Iat = claims.IssuedAt
+	introspectSucceed.Nbf = claims.NotBefore
+	introspectSucceed.Sub = claims.Subject
+	introspectSucceed.Aud = claims.Audience
+	introspectSucceed.Iss = claims.Issuer
+	introspectSucceed.Jti = claims.Id
+	introspectSucceed.Role = claims.Role
+	introspectSucceed.AMR = claims.AMR
+	introspectSucceed.Act = claims.Act
+	introspectSucceed.Cnf = claims.Cnf
+	c.JSON(http.StatusOK, introspectSucceed)
+
+	logger.Info("OAuth introspection request of client " + clientID + " succeed, token " + claims.Id + " is active")
+	return
+}
+
+// Me response struct
+
+type MeSucceed struct {
+	Account     string    `json:"account,omitempty" example:"account" format:"string"`
+	Role        string    `json:"role,omitempty" example:"Member" format:"string"`
+	Permissions []string  `json:"permissions" example:"service:read"`
+	Scopes      []string  `json:"scopes,omitempty" example:"service:read"`
+	AMR         []string  `json:"amr,omitempty" example:"pwd"`
+	Client      string    `json:"client,omitempty" example:"Service1" format:"string"` // API key client which requested token
+	Actor       string    `json:"actor,omitempty" example:"admin" format:"string"`     // real account of impersonation token
+	Tenant      string    `json:"tenant,omitempty" example:"BusinessUnit1" format:"string"`
+	Issuer      string    `json:"issuer" example:"CXWEO" format:"string"`
+	ExpiresAt   time.Time `json:"expires_at" example:"2021-07-23T08:58:47Z"`
+}
+
+// @Summary Return identity of current token.
+// @Description account, role, permissions, token expiry, API key client and tenant of current token
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Produce  json
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} MeSucceed
+// @Failure 401 {object} AuthFailedResp
+// @Router /api/v1/me [get]
+func Me(c *gin.Context) {
+
+	// Fetch policy
+	policy := c.MustGet("Policy").(*auth.Policy)
+
+	role := c.GetString("role")
+	scopes := c.GetStringSlice("scopes")
+
+	// Permissions of role, and scopes of client credentials token which pass RequirePermission of the same name
+	permissions := policy.Permissions(role)
+	for _, scope := range scopes {
+		if !containsString(permissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	var meSucceed = MeSucceed{}
+	meSucceed.Account = c.GetString("account")
+	meSucceed.Role = role
+	meSucceed.Permissions = permissions
+	meSucceed.Scopes = scopes
+	meSucceed.AMR = c.GetStringSlice("amr")
+	meSucceed.Client = c.GetString("client")
+	meSucceed.Tenant = c.GetString("tenant")
+	meSucceed.Actor = c.GetString("actor")
+	meSucceed.Issuer = c.GetString("issuer")
+	meSucceed.ExpiresAt = c.GetTime("tokenExpiresAt").UTC()
+	c.JSON(http.StatusOK, meSucceed)
+	return
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+)
+
+func TestIntrospectToken(t *testing.T) {
+
+	ts := newTestServer(t, nil,
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "rs", Scopes: []string{"introspect"}},
+	)
+
+	// introspect sends token with basic auth of client
+	introspect := func(client, secret, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(client, secret)
+		return ts.serve(req)
+	}
+
+	active := ts.login("web", "alice")
+	revoked := ts.login("web", "alice")
+	if w := ts.call(http.MethodPost, "/api/v1/logout", "", revoked.Token, LogoutReceiveBody{}); w.Code != http.StatusOK {
+		t.Fatalf("logout status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	t.Run("active token", func(t *testing.T) {
+		w := introspect("rs", ts.apiKeys["rs"], active.Token)
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("introspect status = %d, Cache-Control = %q, body = %s", w.Code, w.Header().Get("Cache-Control"), w.Body.String())
+		}
+		var introspectSucceed IntrospectSucceed
+		decodeBody(t, w, &introspectSucceed)
+		if !introspectSucceed.Active || introspectSucceed.Revoked || introspectSucceed.Username != "alice" || introspectSucceed.Role != "Member" ||
+			introspectSucceed.ClientID != "web" || introspectSucceed.Jti != jtiOf(t, active.Token) || introspectSucceed.Iss != "CXWEO" || introspectSucceed.Exp == 0 {
+			t.Errorf("introspect = %+v, want active token of alice", introspectSucceed)
+		}
+	})
+
+	inactiveTests := []struct {
+		name        string
+		token       string
+		wantRevoked bool
+	}{
+		{"revoked token", revoked.Token, true},
+		{"refresh token", active.RefreshToken, false},
+		{"malformed token", "not.a.token", false},
+	}
+	for _, tt := range inactiveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := introspect("rs", ts.apiKeys["rs"], tt.token)
+			if w.Code != http.StatusOK {
+				t.Fatalf("introspect status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var introspectSucceed IntrospectSucceed
+			decodeBody(t, w, &introspectSucceed)
+			if introspectSucceed.Active || introspectSucceed.Revoked != tt.wantRevoked || introspectSucceed.Username != "" {
+				t.Errorf("introspect = %+v, want inactive with revoked %v and no claims", introspectSucceed, tt.wantRevoked)
+			}
+		})
+	}
+
+	clientTests := []struct {
+		name       string
+		client     string
+		secret     string
+		token      string
+		wantStatus int
+		wantError  string
+	}{
+		{"wrong secret", "rs", ts.apiKeys["web"], active.Token, http.StatusUnauthorized, OAuthErrInvalidClient},
+		{"key of other client", "web", ts.apiKeys["rs"], active.Token, http.StatusUnauthorized, OAuthErrInvalidClient},
+		{"key without introspect scope", "web", ts.apiKeys["web"], active.Token, http.StatusForbidden, OAuthErrUnauthorizedClient},
+		{"no token", "rs", ts.apiKeys["rs"], "", http.StatusBadRequest, OAuthErrInvalidRequest},
+	}
+	for _, tt := range clientTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := introspect(tt.client, tt.secret, tt.token)
+			var oauthFailedResp OAuthFailed
+			decodeBody(t, w, &oauthFailedResp)
+			if w.Code != tt.wantStatus || oauthFailedResp.Error != tt.wantError {
+				t.Errorf("introspect status = %d, body = %s, want %d with %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestMe(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	loginSucceed := ts.login("web", "admin")
+
+	w := ts.call(http.MethodGet, "/api/v1/me", "", loginSucceed.Token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("me status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var meSucceed MeSucceed
+	decodeBody(t, w, &meSucceed)
+	if meSucceed.Account != "admin" || meSucceed.Role != "Admin" || meSucceed.Client != "web" || meSucceed.Issuer != "CXWEO" || meSucceed.Actor != "" {
+		t.Errorf("me = %+v, want admin of role Admin with client web", meSucceed)
+	}
+	if len(meSucceed.Permissions) != 1 || meSucceed.Permissions[0] != "*" {
+		t.Errorf("me permissions = %v, want [*]", meSucceed.Permissions)
+	}
+	if len(meSucceed.AMR) != 1 || meSucceed.AMR[0] != "pwd" {
+		t.Errorf("me amr = %v, want [pwd]", meSucceed.AMR)
+	}
+	if meSucceed.ExpiresAt.IsZero() {
+		t.Error("me has no token expiry")
+	}
+
+	if w := ts.call(http.MethodGet, "/api/v1/me", "", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("me without token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+// @Summary Get public keys to verify token.
+// @Description get public signing keys in JWKS format, HMAC keys are never published
+// @Produce  json
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} keyset.JWKSet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+
+	// Fetch jwt keyset
+	keySet := c.MustGet("KeySet").(*keyset.KeySet)
+
+	// Public keys can be cached by verifiers for a while
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keySet.JWKS())
+	return
+}
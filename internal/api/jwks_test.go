@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+func TestGetJWKS(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	w := ts.call(http.MethodGet, "/.well-known/jwks.json", "", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("jwks status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var jwks keyset.JWKSet
+	decodeBody(t, w, &jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "test-1" {
+		t.Fatalf("jwks = %+v, want public key of test-1 only", jwks)
+	}
+	if strings.Contains(w.Body.String(), `"d"`) {
+		t.Fatal("jwks publishes private key")
+	}
+
+	// Other services verify tokens with the published key
+	publicKey, err := jwks.Keys[0].PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := ts.login("web", "alice").Token
+	if _, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	}); err != nil {
+		t.Errorf("token verified with published key error = %v", err)
+	}
+}
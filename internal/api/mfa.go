@@ -0,0 +1,424 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+)
+
+// RequireMFA returns middleware to check whether token is issued after TOTP verified, should be used after AuthRequired
+func RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		amr, _ := c.Get("amr")
+		methods, _ := amr.([]string)
+
+		for _, method := range methods {
+			if method == "otp" {
+				c.Next()
+				return
+			}
+		}
+
+		denyAccess(c, "amr otp")
+	}
+}
+
+// Login MFA receive struct
+
+type LoginMFAReceiveBody struct {
+	MFAToken string `json:"MFAToken" example:"mfa pending token" format:"string"`
+	Code     string `json:"Code" example:"123456" format:"string"` // TOTP code or recovery code
+}
+
+// @Summary Finish login of account with TOTP and return token.
+// @Description verify TOTP code or recovery code with mfa_token returned by login, and get token
+// @Param X-API-Key header string true "Insert your api key" default(<Add api key here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body LoginMFAReceiveBody true "MFA token and code"
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} LoginSucceed
+// @Failure 400 {object} LoginFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 429 {object} LoginFailed
+// @Failure 500 {object} LoginFailed
+// @Router /api/v1/login/mfa [post]
+func LoginMFA(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch client
+	client := c.MustGet("client").(string)
+
+	// Fetch body received
+	var receiveBody = LoginMFAReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || receiveBody.MFAToken == "" || receiveBody.Code == "" {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Client " + client + " bad request: mfa token and code are required"
+		c.JSON(http.StatusBadRequest, loginFailed)
+		logger.Warn("Client " + client + " login mfa bad request")
+		return
+	}
+
+	// Fetch jwt keyset and token options
+	keySet := c.MustGet("KeySet").(*keyset.KeySet)
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	// Fetch revocation store
+	revocationStore := c.MustGet("RevocationStore").(tokenstore.RevocationStore)
+
+	// Parse mfa pending token, it can only be used once
+	claims, err := ParseToken(keySet, tokenOptions, receiveBody.MFAToken)
+	if err == nil && claims.TokenUse != TokenUseMFAPending {
+		err = errors.New("token use is not " + TokenUseMFAPending)
+	}
+	if err == nil && claims.ClientID != client {
+		err = errors.New("mfa token is issued to client " + claims.ClientID)
+	}
+	if err == nil && claims.Tenant != c.GetString("tenant") {
+		err = tenant.ErrTenantMismatch
+	}
+	if err == nil && revocationStore.IsRevoked(claims.Id, claims.Account, issuedAtOf(claims)) {
+		err = errors.New("mfa token is already used")
+	}
+	if err != nil {
+		var authFailedResp = AuthFailedResp{}
+		authFailedResp.ErrorString = "mfa token is invalid"
+		c.JSON(http.StatusUnauthorized, authFailedResp)
+		logger.Warn("Client " + client + " login mfa with invalid mfa token: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Reason: "mfa token is invalid"})
+		return
+	}
+
+	account := claims.Account
+
+	// Fetch login limiter
+	loginLimiter := c.MustGet("LoginLimiter").(*auth.LoginLimiter)
+
+	// Check whether account or client IP is locked
+	clientIP := c.ClientIP()
+	if retryAfter := loginLimiter.Check(account, clientIP, time.Now()); retryAfter > 0 {
+		retryAfterSeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " is temporarily locked, retry after " + retryAfterSeconds + " seconds."
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusTooManyRequests, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of locked account " + account + " from " + clientIP)
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Actor: account, Reason: "account or client IP is locked"})
+		return
+	}
+
+	// Fetch mfa
+	mfa := c.MustGet("MFA").(*auth.MFA)
+
+	// Verify TOTP code or recovery code
+	usedRecoveryCode, err := mfa.Verify(account, receiveBody.Code, time.Now())
+
+	if err != nil {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " mfa verification failed."
+		c.JSON(http.StatusBadRequest, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of account " + account + ", but verification failed and error: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Actor: account, Reason: "mfa verification failed"})
+
+		// Record failure, and log lockout
+		accountLockout, ipLockout := loginLimiter.Failure(account, clientIP, time.Now())
+		if accountLockout > 0 {
+			logger.Warn("Account " + account + " locked for " + accountLockout.String() + " after too many login failures, last from " + clientIP)
+		}
+		if ipLockout > 0 {
+			logger.Warn("Client IP " + clientIP + " locked for " + ipLockout.String() + " after too many login failures")
+		}
+		return
+	}
+
+	if usedRecoveryCode {
+		logger.Warn("Account " + account + " login with recovery code, " + strconv.Itoa(mfa.RemainingRecoveryCodes(account)) + " recovery codes left")
+	}
+
+	// Revoke used mfa token, no token is issued if it can not be burned
+	if err := revocationStore.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " revoke mfa token failed."
+		c.JSON(http.StatusInternalServerError, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of account " + account + " revoke mfa token failed: " + err.Error())
+		return
+	}
+
+	// Clear failures of account
+	loginLimiter.Success(account)
+
+	// Generate token
+	amr := []string{"pwd", "otp"}
+	token, err := GenerateToken(keySet, tokenOptions, Claims{Account: account, Role: claims.Role, AMR: amr, ClientID: client, Tenant: claims.Tenant, Cnf: confirmationOf(c, client)}, accessTokenTTL(c, claims.Tenant))
+
+	if err != nil {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " generate token failed."
+		c.JSON(http.StatusInternalServerError, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of account " + account + " generate token failed: " + err.Error())
+		return
+	}
+
+	// Fetch refresh store
+	refreshStore := c.MustGet("RefreshStore").(tokenstore.RefreshStore)
+
+	// Issue refresh token in a new token family
+	refreshToken, err := refreshStore.Issue(tokenstore.RefreshRecord{Account: account, Role: claims.Role, AMR: amr, Client: client, Tenant: claims.Tenant})
+
+	if err != nil {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " generate refresh token failed."
+		c.JSON(http.StatusInternalServerError, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of account " + account + " generate refresh token failed: " + err.Error())
+		return
+	}
+
+	// Succeed and return token, respondTokenPair is in session.go
+	if err := respondTokenPair(c, token, refreshToken); err != nil {
+		var loginFailed = LoginFailed{}
+		loginFailed.Message = "Account " + account + " generate csrf token failed."
+		c.JSON(http.StatusInternalServerError, loginFailed)
+		logger.Warn("Client " + client + " try to login mfa of account " + account + " generate csrf token failed: " + err.Error())
+		return
+	}
+
+	logger.Info("Client " + client + " try to login mfa of account " + account + " and already return token")
+	auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeSuccess, Actor: account, Reason: "mfa verified"})
+	return
+}
+
+// TOTP receive and response struct
+
+type TOTPEnrollSucceed struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP" format:"string"`
+	URI    string `json:"otpauth_uri" example:"otpauth://totp/CXWEO:account?issuer=CXWEO&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP" format:"string"`
+}
+
+type TOTPCodeReceiveBody struct {
+	Code string `json:"Code" example:"123456" format:"string"`
+}
+
+type TOTPConfirmSucceed struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"abcd-efgh"`
+}
+
+type TOTPSucceed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+type TOTPFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// @Summary Enroll TOTP of current account.
+// @Description create a new TOTP secret, it is enabled after confirmed with a code
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Produce  json
+// @Tags MFA
+// @version 1.0
+// @Success 200 {object} TOTPEnrollSucceed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 409 {object} TOTPFailed
+// @Failure 500 {object} TOTPFailed
+// @Router /api/v1/mfa/totp/enroll [post]
+func EnrollTOTP(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch account
+	account := c.MustGet("account").(string)
+
+	// Fetch mfa
+	mfa := c.MustGet("MFA").(*auth.MFA)
+
+	secret, uri, err := mfa.Enroll(account)
+
+	if err == auth.ErrMFAAlreadyEnabled {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " TOTP is already enabled, disable it first."
+		c.JSON(http.StatusConflict, totpFailed)
+		logger.Warn("Account " + account + " enroll TOTP failed: " + err.Error())
+		return
+	}
+	if err != nil {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " enroll TOTP failed."
+		c.JSON(http.StatusInternalServerError, totpFailed)
+		logger.Warn("Account " + account + " enroll TOTP failed: " + err.Error())
+		return
+	}
+
+	var totpEnrollSucceed = TOTPEnrollSucceed{}
+	totpEnrollSucceed.Secret = secret
+	totpEnrollSucceed.URI = uri
+	c.JSON(http.StatusOK, totpEnrollSucceed)
+
+	logger.Info("Account " + account + " enrolled TOTP, waiting for confirm")
+	return
+}
+
+// @Summary Confirm TOTP of current account.
+// @Description enable enrolled TOTP with a code, recovery codes are returned only once
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body TOTPCodeReceiveBody true "TOTP code"
+// @Tags MFA
+// @version 1.0
+// @Success 200 {object} TOTPConfirmSucceed
+// @Failure 400 {object} TOTPFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 429 {object} TOTPFailed
+// @Router /api/v1/mfa/totp/confirm [post]
+func ConfirmTOTP(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch account
+	account := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = TOTPCodeReceiveBody{}
+
+	if err := c.ShouldBindJSON(&receiveBody); err != nil || receiveBody.Code == "" {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " bad request: code is required"
+		c.JSON(http.StatusBadRequest, totpFailed)
+		logger.Warn("Account " + account + " confirm TOTP bad request")
+		return
+	}
+
+	// Fetch login limiter, wrong codes count as login failures
+	loginLimiter := c.MustGet("LoginLimiter").(*auth.LoginLimiter)
+
+	// Check whether account or client IP is locked
+	clientIP := c.ClientIP()
+	if retryAfter := loginLimiter.Check(account, clientIP, time.Now()); retryAfter > 0 {
+		retryAfterSeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " is temporarily locked, retry after " + retryAfterSeconds + " seconds."
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusTooManyRequests, totpFailed)
+		logger.Warn("Account " + account + " try to confirm TOTP while locked from " + clientIP)
+		return
+	}
+
+	// Fetch mfa
+	mfa := c.MustGet("MFA").(*auth.MFA)
+
+	recoveryCodes, err := mfa.Confirm(account, receiveBody.Code, time.Now())
+	if err != nil {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " confirm TOTP failed: " + err.Error()
+		c.JSON(http.StatusBadRequest, totpFailed)
+		logger.Warn("Account " + account + " confirm TOTP from " + clientIP + " failed: " + err.Error())
+
+		if err == auth.ErrInvalidMFACode {
+			loginLimiter.Failure(account, clientIP, time.Now())
+		}
+		return
+	}
+
+	var totpConfirmSucceed = TOTPConfirmSucceed{}
+	totpConfirmSucceed.RecoveryCodes = recoveryCodes
+	c.JSON(http.StatusOK, totpConfirmSucceed)
+
+	logger.Info("Account " + account + " enabled TOTP")
+	return
+}
+
+// @Summary Disable TOTP of current account.
+// @Description disable TOTP with a code or recovery code
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body TOTPCodeReceiveBody true "TOTP code or recovery code"
+// @Tags MFA
+// @version 1.0
+// @Success 200 {object} TOTPSucceed
+// @Failure 400 {object} TOTPFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 429 {object} TOTPFailed
+// @Router /api/v1/mfa/totp [delete]
+func DisableTOTP(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch account
+	account := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = TOTPCodeReceiveBody{}
+
+	if err := c.ShouldBindJSON(&receiveBody); err != nil || receiveBody.Code == "" {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " bad request: code is required"
+		c.JSON(http.StatusBadRequest, totpFailed)
+		logger.Warn("Account " + account + " disable TOTP bad request")
+		return
+	}
+
+	// Fetch login limiter, wrong codes count as login failures
+	loginLimiter := c.MustGet("LoginLimiter").(*auth.LoginLimiter)
+
+	// Check whether account or client IP is locked
+	clientIP := c.ClientIP()
+	if retryAfter := loginLimiter.Check(account, clientIP, time.Now()); retryAfter > 0 {
+		retryAfterSeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " is temporarily locked, retry after " + retryAfterSeconds + " seconds."
+		c.Header("Retry-After", retryAfterSeconds)
+		c.JSON(http.StatusTooManyRequests, totpFailed)
+		logger.Warn("Account " + account + " try to disable TOTP while locked from " + clientIP)
+		return
+	}
+
+	// Fetch mfa
+	mfa := c.MustGet("MFA").(*auth.MFA)
+
+	if err := mfa.Disable(account, receiveBody.Code, time.Now()); err != nil {
+		var totpFailed = TOTPFailed{}
+		totpFailed.Message = "Account " + account + " disable TOTP failed: " + err.Error()
+		c.JSON(http.StatusBadRequest, totpFailed)
+		logger.Warn("Account " + account + " disable TOTP from " + clientIP + " failed: " + err.Error())
+
+		if err == auth.ErrInvalidMFACode {
+			loginLimiter.Failure(account, clientIP, time.Now())
+		}
+		return
+	}
+
+	var totpSucceed = TOTPSucceed{}
+	totpSucceed.Message = "Account " + account + " TOTP disabled."
+	c.JSON(http.StatusOK, totpSucceed)
+
+	logger.Warn("Account " + account + " disabled TOTP")
+	return
+}
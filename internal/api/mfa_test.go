@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+)
+
+// enrollTestTOTP enables TOTP of account with token and returns its secret and recovery codes
+func enrollTestTOTP(t *testing.T, ts *testServer, token string) (string, []string) {
+
+	w := ts.call(http.MethodPost, "/api/v1/mfa/totp/enroll", "", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var enrolled TOTPEnrollSucceed
+	decodeBody(t, w, &enrolled)
+
+	code, err := auth.TOTPCode(enrolled.Secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = ts.call(http.MethodPost, "/api/v1/mfa/totp/confirm", "", token, TOTPCodeReceiveBody{Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var confirmed TOTPConfirmSucceed
+	decodeBody(t, w, &confirmed)
+
+	return enrolled.Secret, confirmed.RecoveryCodes
+}
+
+func TestLoginMFA(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"LOGIN LOCKOUT": {"Account_Max_Failures": "2", "IP_Max_Failures": "0"}},
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "mobile", Scopes: []string{"login"}},
+	)
+
+	secret, recoveryCodes := enrollTestTOTP(t, ts, ts.login("web", "alice").Token)
+	if len(recoveryCodes) == 0 {
+		t.Fatal("confirm returned no recovery codes")
+	}
+
+	// Password only gets mfa pending token, which is not an access token
+	pending := ts.login("web", "alice")
+	if !pending.MFARequired || pending.MFAToken == "" || pending.Token != "" {
+		t.Fatalf("login of account with TOTP = %+v, want mfa token only", pending)
+	}
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", pending.MFAToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("mfa token as access token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	loginMFA := func(client, mfaToken, code string) int {
+		return ts.call(http.MethodPost, "/api/v1/login/mfa", client, "", LoginMFAReceiveBody{MFAToken: mfaToken, Code: code}).Code
+	}
+
+	// The code confirmed at enroll can not be used again, the next one can
+	nextCode, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mfa token is bound to client which logged in
+	if status := loginMFA("mobile", pending.MFAToken, nextCode); status != http.StatusUnauthorized {
+		t.Errorf("login mfa from another client status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	if status := loginMFA("web", pending.MFAToken, nextCode); status != http.StatusOK {
+		t.Fatalf("login mfa status = %d, want %d", status, http.StatusOK)
+	}
+
+	// mfa token can only be used once
+	if status := loginMFA("web", pending.MFAToken, recoveryCodes[0]); status != http.StatusUnauthorized {
+		t.Errorf("login mfa with used mfa token status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Recovery code works once
+	if status := loginMFA("web", ts.login("web", "alice").MFAToken, recoveryCodes[0]); status != http.StatusOK {
+		t.Errorf("login mfa with recovery code status = %d, want %d", status, http.StatusOK)
+	}
+	if status := loginMFA("web", ts.login("web", "alice").MFAToken, recoveryCodes[0]); status != http.StatusBadRequest {
+		t.Errorf("login mfa with used recovery code status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Failed codes, including the reused recovery code, lock account out like wrong passwords
+	mfaToken := ts.login("web", "alice").MFAToken
+	if status := loginMFA("web", mfaToken, "000000"); status != http.StatusBadRequest {
+		t.Errorf("login mfa with wrong code status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := loginMFA("web", mfaToken, recoveryCodes[1]); status != http.StatusTooManyRequests {
+		t.Errorf("login mfa of locked account status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/mtls"
+)
+
+// A function to make TLS config of https server, client certificates are verified with client CA if client auth is not apikey
+func MakeTLSConfig(cfg conf.IConf) (*tls.Config, error) {
+
+	// Fetch config of tls
+	tlsConf := cfg.TLSCfg()
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if tlsConf.ClientAuth == mtls.ClientAuthAPIKey {
+		return tlsConfig, nil
+	}
+
+	clientCAs, err := mtls.LoadCAPool(tlsConf.ClientCAFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificate is verified if given, and ValidateClient rejects requests without certificate in mtls mode,
+	// so public paths as jwks still work without certificate
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return tlsConfig, nil
+}
+
+// A function to check client with client certificate or API key, selected by [TLS] Client_Auth in config
+func ValidateClient(c *gin.Context) {
+
+	// Fetch client auth mode
+	clientAuth := c.MustGet("ClientAuth").(string)
+
+	if clientAuth != mtls.ClientAuthAPIKey {
+
+		// Use client certificate if presented
+		if cert := verifiedClientCert(c.Request); cert != nil {
+			ValidateClientCert(c, cert)
+			return
+		}
+
+		if clientAuth == mtls.ClientAuthMTLS {
+			// Fetch logger
+			logger := c.MustGet("Logger").(*logrus.Entry)
+
+			var authFailedResp = AuthFailedResp{}
+			authFailedResp.ErrorString = "client certificate is required"
+			c.JSON(http.StatusUnauthorized, authFailedResp)
+
+			logger.Warn("Client certificate is required, but no certificate from " + c.ClientIP())
+			auditLog(c, audit.Event{Type: audit.EventClientCertUse, Outcome: audit.OutcomeFailure, Reason: "client certificate is required"})
+
+			c.Abort()
+			return
+		}
+	}
+
+	ValidateAPIKey(c)
+}
+
+// A function to map verified client certificate to client, and set the same context as ValidateAPIKey
+func ValidateClientCert(c *gin.Context, cert *x509.Certificate) {
+
+	// Init auth failed struct
+	var authFailedResp = AuthFailedResp{}
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch client map
+	clientMap := c.MustGet("ClientMap").(*mtls.ClientMap)
+
+	// Map certificate to client
+	rule, ok := clientMap.Match(cert)
+	if !ok {
+		authFailedResp.ErrorString = "client certificate is not mapped to any client"
+		c.JSON(http.StatusUnauthorized, authFailedResp)
+
+		logger.Warn("Client certificate " + cert.Subject.String() + " from " + c.ClientIP() + " is not mapped to any client")
+		auditLog(c, audit.Event{Type: audit.EventClientCertUse, Outcome: audit.OutcomeFailure, Target: mtls.Thumbprint(cert), Reason: "not mapped to any client"})
+
+		c.Abort()
+		return
+	}
+
+	// Check route restrictions with the same record as API key, so RequireScope works unchanged, checkClientRecord is in binding.go
+	record := apikey.Record{
+		Client: rule.Client,
+		Tenant: rule.Tenant,
+		Scopes: rule.Scopes,
+		Routes: rule.Routes,
+	}
+	if err := checkClientRecord(c, record); err != nil {
+		authFailedResp.ErrorString = err.Error()
+		c.JSON(http.StatusForbidden, authFailedResp)
+
+		logger.Warn(rule.Client + " user client certificate " + cert.Subject.String() + " rejected on " + c.Request.Method + " " + c.Request.URL.Path + ": " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventClientCertUse, Outcome: audit.OutcomeFailure, Client: rule.Client, Target: mtls.Thumbprint(cert), Reason: err.Error()})
+
+		c.Abort()
+		return
+	}
+
+	// Set to memo which client do the access
+	c.Set("client", rule.Client)
+	c.Set("apiKeyRecord", record)
+	c.Set("clientCertThumbprint", mtls.Thumbprint(cert))
+
+	// Check tenant of client, checkClientTenant is in tenant.go
+	if !checkClientTenant(c, rule.Tenant) {
+		return
+	}
+
+	auditLog(c, audit.Event{Type: audit.EventClientCertUse, Outcome: audit.OutcomeSuccess, Target: mtls.Thumbprint(cert)})
+
+	// If met, do next
+	c.Next()
+
+	logger.Info(rule.Client + " user client certificate " + cert.Subject.String() + " authentication succeed")
+	return
+}
+
+// verifiedClientCert returns leaf client certificate verified in TLS handshake, or nil
+func verifiedClientCert(req *http.Request) *x509.Certificate {
+
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// A function to load client map when client certificate auth is enabled, otherwise returns nil
+func loadClientMap(cfg conf.IConf) (*mtls.ClientMap, error) {
+
+	// Fetch config of tls
+	tlsConf := cfg.TLSCfg()
+
+	switch tlsConf.ClientAuth {
+	case mtls.ClientAuthAPIKey:
+		return nil, nil
+	case mtls.ClientAuthMTLS, mtls.ClientAuthBoth:
+		return mtls.LoadClientMap(tlsConf.ClientMapFilePath)
+	default:
+		return nil, errors.New("no such client auth: " + tlsConf.ClientAuth)
+	}
+}
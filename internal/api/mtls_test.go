@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/mtls"
+)
+
+// newTestClientCert returns self-signed client certificate of subject CN, and its PEM
+func newTestClientCert(t *testing.T, commonName string) (*x509.Certificate, string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// newMTLSTestServer starts test server of client auth and overrides with client map of partner, which is only allowed to login,
+// and reader, which is only allowed to GET
+func newMTLSTestServer(t *testing.T, clientAuth string, overrides testConfig) *testServer {
+
+	ts := prepareTestServer(t)
+
+	_, caPEM := newTestClientCert(t, "client-ca")
+	ts.writeFile("client_ca.pem", caPEM)
+	ts.writeJSON("client_map.json", map[string][]mtls.ClientRule{"clients": {
+		{Client: "partner", SubjectCN: "partner.client.local", Scopes: []string{"login"}},
+		{Client: "reader", SubjectCN: "reader.client.local", Routes: []string{"GET /api/v1/*"}},
+	}})
+
+	cfg := testConfig{
+		"API SERVER": {"Protocol": "https"},
+		"TLS": {
+			"Cert_File_Path":       "server.pem",
+			"Key_File_Path":        "server.key",
+			"Client_Auth":          clientAuth,
+			"Client_CA_File_Path":  "client_ca.pem",
+			"Client_Map_File_Path": "client_map.json",
+		},
+	}
+	for section, keys := range overrides {
+		if cfg[section] == nil {
+			cfg[section] = map[string]string{}
+		}
+		for key, value := range keys {
+			cfg[section][key] = value
+		}
+	}
+	ts.start(cfg)
+
+	return ts
+}
+
+// loginWithCert logs alice in with client certificate verified in TLS handshake, and API key of client if not empty
+func (ts *testServer) loginWithCert(cert *x509.Certificate, client string) int {
+
+	req := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "alice", Password: testPassword})
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	if client != "" {
+		req.Header.Set("X-API-Key", ts.apiKeys[client])
+	}
+
+	return ts.serve(req).Code
+}
+
+func TestMakeTLSConfig(t *testing.T) {
+
+	ts := newMTLSTestServer(t, mtls.ClientAuthBoth, nil)
+
+	tlsConfig, err := MakeTLSConfig(ts.cfg)
+	if err != nil {
+		t.Fatalf("MakeTLSConfig() error = %v", err)
+	}
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven || tlsConfig.ClientCAs == nil {
+		t.Errorf("MakeTLSConfig() client auth = %v, want client certificates verified if given", tlsConfig.ClientAuth)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MakeTLSConfig() min version = %x, want TLS 1.2", tlsConfig.MinVersion)
+	}
+}
+
+func TestValidateClientCert(t *testing.T) {
+
+	partnerCert, _ := newTestClientCert(t, "partner.client.local")
+	readerCert, _ := newTestClientCert(t, "reader.client.local")
+	unknownCert, _ := newTestClientCert(t, "unknown.client.local")
+
+	tests := []struct {
+		name        string
+		clientAuth  string
+		cert        *x509.Certificate
+		client      string
+		wantStatus  int
+		wantOutcome string // outcome of client_cert_use event, empty if none
+		wantClient  string
+	}{
+		{"mapped certificate", mtls.ClientAuthBoth, partnerCert, "", http.StatusOK, "success", "partner"},
+		{"certificate is used before API key", mtls.ClientAuthBoth, unknownCert, "web", http.StatusUnauthorized, "failure", ""},
+		{"unmapped certificate", mtls.ClientAuthMTLS, unknownCert, "", http.StatusUnauthorized, "failure", ""},
+		{"route not allowed to client", mtls.ClientAuthMTLS, readerCert, "", http.StatusForbidden, "failure", "reader"},
+		{"API key without certificate", mtls.ClientAuthBoth, nil, "web", http.StatusOK, "", ""},
+		{"API key without certificate in mtls mode", mtls.ClientAuthMTLS, nil, "web", http.StatusUnauthorized, "failure", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newMTLSTestServer(t, tt.clientAuth, nil)
+
+			if status := ts.loginWithCert(tt.cert, tt.client); status != tt.wantStatus {
+				t.Errorf("login status = %d, want %d", status, tt.wantStatus)
+			}
+
+			events := ts.auditEvents("client_cert_use")
+			if tt.wantOutcome == "" {
+				if len(events) != 0 {
+					t.Errorf("client_cert_use events = %+v, want none", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Outcome != tt.wantOutcome || events[0].Client != tt.wantClient {
+				t.Fatalf("client_cert_use events = %+v, want one %s of client %q", events, tt.wantOutcome, tt.wantClient)
+			}
+			if tt.cert != nil && events[0].Target != mtls.Thumbprint(tt.cert) {
+				t.Errorf("client_cert_use target = %q, want thumbprint of certificate", events[0].Target)
+			}
+		})
+	}
+}
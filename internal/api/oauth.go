@@ -0,0 +1,202 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+)
+
+// OAuth2 error codes of RFC 6749 section 5.2
+const (
+	OAuthErrInvalidRequest       = "invalid_request"
+	OAuthErrInvalidClient        = "invalid_client"
+	OAuthErrUnauthorizedClient   = "unauthorized_client"
+	OAuthErrUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrInvalidScope         = "invalid_scope"
+	OAuthErrServerError          = "server_error"
+)
+
+// OAuth token response struct
+
+type OAuthTokenSucceed struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJFUzI1NiIsImtpZCI6ImVzLTIwMjEtMDgiLCJ0eXAiOiJKV1QifQ..." format:"string"`
+	TokenType   string `json:"token_type" example:"Bearer" format:"string"`
+	ExpiresIn   int64  `json:"expires_in" example:"1200"`
+	Scope       string `json:"scope,omitempty" example:"service:read" format:"string"`
+}
+
+type OAuthFailed struct {
+	Error            string `json:"error" example:"invalid_client" format:"string"`
+	ErrorDescription string `json:"error_description,omitempty" example:"client authentication failed" format:"string"`
+}
+
+// @Summary Issue access token to machine client with OAuth2 client credentials grant.
+// @Description RFC 6749 token endpoint, client_id is the client of API key and client_secret is the API key, by HTTP Basic or form
+// @Param Authorization header string false "Basic base64(client_id:client_secret)"
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param grant_type formData string true "client_credentials"
+// @Param scope formData string false "space separated scopes listed on API key, default all scopes of API key"
+// @Param client_id formData string false "client of API key, if not in Authorization header"
+// @Param client_secret formData string false "API key, if not in Authorization header"
+// @Tags OAuth
+// @version 1.0
+// @Success 200 {object} OAuthTokenSucceed
+// @Failure 400 {object} OAuthFailed
+// @Failure 401 {object} OAuthFailed
+// @Failure 500 {object} OAuthFailed
+// @Router /oauth/token [post]
+func IssueOAuthToken(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Token response must not be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	// Read client credentials from HTTP Basic or form
+	clientID, clientSecret, basicAuth, ok := oauthClientCredentials(c)
+	if !ok {
+		oauthFailed(c, http.StatusBadRequest, OAuthErrInvalidRequest, "malformed client credentials")
+		logger.Warn("OAuth token request from " + c.ClientIP() + " bad request: malformed client credentials")
+		return
+	}
+
+	// Check grant type
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		oauthFailed(c, http.StatusBadRequest, OAuthErrInvalidRequest, "grant_type is required")
+		logger.Warn("OAuth token request of client " + clientID + " bad request: grant_type is required")
+		return
+	}
+	if grantType != "client_credentials" {
+		oauthFailed(c, http.StatusBadRequest, OAuthErrUnsupportedGrantType, "only client_credentials is supported")
+		logger.Warn("OAuth token request of client " + clientID + " bad request: unsupported grant_type " + grantType)
+		return
+	}
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Authenticate client with API key, and the key must belong to client
+	keyID, record, ok := apiKeyStore.Lookup(clientSecret)
+	if !ok || clientID == "" || record.Client != clientID {
+		if basicAuth {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthFailed(c, http.StatusUnauthorized, OAuthErrInvalidClient, "client authentication failed")
+		logger.Warn("OAuth token request of client " + clientID + " from " + c.ClientIP() + " rejected: client authentication failed")
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Client: clientID, Reason: "client authentication failed"})
+		return
+	}
+
+	// Check restrictions of API key, key which requires signing can not be sent as client secret
+	err := record.Check(time.Now(), c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+	if err == nil && record.RequireSigning {
+		err = apikey.ErrSigningRequired
+	}
+	if err != nil {
+		status, errorCode := http.StatusUnauthorized, OAuthErrInvalidClient
+		if err == apikey.ErrSourceNotAllowed || err == apikey.ErrRouteNotAllowed || err == apikey.ErrSigningRequired {
+			status, errorCode = http.StatusBadRequest, OAuthErrUnauthorizedClient
+		}
+		oauthFailed(c, status, errorCode, err.Error())
+		logger.Warn("OAuth token request of client " + clientID + " API-Key " + keyID + " from " + c.ClientIP() + " rejected: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Client: clientID, Target: keyID, Reason: err.Error()})
+		return
+	}
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	// Check tenant of client
+	if err := tenants.Check(record.Tenant, "", time.Now()); err != nil {
+		status := http.StatusBadRequest
+		if err == tenant.ErrRateLimited {
+			status = http.StatusTooManyRequests
+		}
+		oauthFailed(c, status, OAuthErrUnauthorizedClient, err.Error())
+		logger.Warn("OAuth token request of client " + clientID + " of tenant " + record.Tenant + " rejected: " + err.Error())
+		auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Client: clientID, Tenant: record.Tenant, Target: keyID, Reason: err.Error()})
+		return
+	}
+
+	// Grant requested scopes if they are listed on API key, or all scopes of API key if none requested.
+	// Key without scopes is unrestricted on its own routes, but grants no scope to token.
+	scopes := strings.Fields(c.PostForm("scope"))
+	if len(scopes) == 0 {
+		scopes = record.Scopes
+	}
+	for _, scope := range scopes {
+		if !containsString(record.Scopes, scope) {
+			oauthFailed(c, http.StatusBadRequest, OAuthErrInvalidScope, "scope "+scope+" is not allowed")
+			logger.Warn("OAuth token request of client " + clientID + " API-Key " + keyID + " rejected: " + apikey.ErrScopeNotAllowed.Error() + " " + scope)
+			auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeFailure, Client: clientID, Target: keyID, Reason: "scope " + scope + " is not allowed"})
+			return
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	// Fetch jwt keyset and token options
+	keySet := c.MustGet("KeySet").(*keyset.KeySet)
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	// Generate token, subject is client
+	ttl := tenants.AccessTokenTTL(record.Tenant, tokenOptions.AccessTokenTTL)
+	token, err := GenerateToken(keySet, tokenOptions, Claims{ClientID: record.Client, Tenant: record.Tenant, Scope: scope, Cnf: confirmationOf(c, record.Client)}, ttl)
+	if err != nil {
+		oauthFailed(c, http.StatusInternalServerError, OAuthErrServerError, "generate token failed")
+		logger.Warn("OAuth token request of client " + clientID + " generate token failed: " + err.Error())
+		return
+	}
+
+	// Succeed and return token, no refresh token for client credentials
+	var oauthTokenSucceed = OAuthTokenSucceed{}
+	oauthTokenSucceed.AccessToken = token
+	oauthTokenSucceed.TokenType = "Bearer"
+	oauthTokenSucceed.ExpiresIn = int64(ttl / time.Second)
+	oauthTokenSucceed.Scope = scope
+	c.JSON(http.StatusOK, oauthTokenSucceed)
+
+	logger.Info("OAuth token request of client " + clientID + " API-Key " + keyID + " succeed with scope [" + scope + "]")
+	auditLog(c, audit.Event{Type: audit.EventLogin, Outcome: audit.OutcomeSuccess, Client: clientID, Tenant: record.Tenant, Target: keyID, Reason: "client credentials, scope " + scope})
+	return
+}
+
+// oauthClientCredentials reads client credentials from HTTP Basic or form, but not both
+func oauthClientCredentials(c *gin.Context) (clientID, clientSecret string, basicAuth, ok bool) {
+
+	clientID, clientSecret, basicAuth = c.Request.BasicAuth()
+	if !basicAuth {
+		return c.PostForm("client_id"), c.PostForm("client_secret"), false, true
+	}
+
+	// Credentials are form-urlencoded before base64 in HTTP Basic
+	var errID, errSecret error
+	clientID, errID = url.QueryUnescape(clientID)
+	clientSecret, errSecret = url.QueryUnescape(clientSecret)
+	if errID != nil || errSecret != nil || c.PostForm("client_secret") != "" {
+		return "", "", true, false
+	}
+
+	return clientID, clientSecret, true, true
+}
+
+// oauthFailed returns OAuth2 error response
+func oauthFailed(c *gin.Context, status int, errorCode, description string) {
+
+	var failed = OAuthFailed{}
+	failed.Error = errorCode
+	failed.ErrorDescription = description
+	c.JSON(status, failed)
+}
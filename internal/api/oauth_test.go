@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+)
+
+func TestIssueOAuthToken(t *testing.T) {
+
+	ts := newTestServer(t, nil,
+		apikey.Record{Client: "svc", Scopes: []string{"service:read", "reports:read"}},
+		apikey.Record{Client: "no-scope"},
+		apikey.Record{Client: "signing", Scopes: []string{"service:read"}, RequireSigning: true},
+	)
+
+	tests := []struct {
+		name       string
+		basicAuth  bool
+		client     string
+		secret     string
+		form       url.Values
+		wantStatus int
+		wantError  string
+		wantScope  string
+	}{
+		{"form credentials", false, "svc", ts.apiKeys["svc"], url.Values{"grant_type": {"client_credentials"}}, http.StatusOK, "", "service:read reports:read"},
+		{"basic auth", true, "svc", ts.apiKeys["svc"], url.Values{"grant_type": {"client_credentials"}}, http.StatusOK, "", "service:read reports:read"},
+		{"requested scope", false, "svc", ts.apiKeys["svc"], url.Values{"grant_type": {"client_credentials"}, "scope": {"service:read"}}, http.StatusOK, "", "service:read"},
+		{"scope not listed", false, "svc", ts.apiKeys["svc"], url.Values{"grant_type": {"client_credentials"}, "scope": {"login"}}, http.StatusBadRequest, OAuthErrInvalidScope, ""},
+		{"key without scopes gets none", false, "no-scope", ts.apiKeys["no-scope"], url.Values{"grant_type": {"client_credentials"}, "scope": {"service:read"}}, http.StatusBadRequest, OAuthErrInvalidScope, ""},
+		{"signing only key", false, "signing", ts.apiKeys["signing"], url.Values{"grant_type": {"client_credentials"}}, http.StatusBadRequest, OAuthErrUnauthorizedClient, ""},
+		{"wrong secret", false, "svc", ts.apiKeys["no-scope"], url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, OAuthErrInvalidClient, ""},
+		{"no grant type", false, "svc", ts.apiKeys["svc"], url.Values{}, http.StatusBadRequest, OAuthErrInvalidRequest, ""},
+		{"password grant", false, "svc", ts.apiKeys["svc"], url.Values{"grant_type": {"password"}}, http.StatusBadRequest, OAuthErrUnsupportedGrantType, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			if !tt.basicAuth {
+				form.Set("client_id", tt.client)
+				form.Set("client_secret", tt.secret)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicAuth {
+				req.SetBasicAuth(url.QueryEscape(tt.client), url.QueryEscape(tt.secret))
+			}
+
+			w := ts.serve(req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", w.Header().Get("Cache-Control"))
+			}
+
+			if tt.wantError != "" {
+				var failed OAuthFailed
+				decodeBody(t, w, &failed)
+				if failed.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", failed.Error, tt.wantError)
+				}
+				return
+			}
+
+			var succeed OAuthTokenSucceed
+			decodeBody(t, w, &succeed)
+			if succeed.TokenType != "Bearer" || succeed.Scope != tt.wantScope || succeed.ExpiresIn != 1200 {
+				t.Errorf("token response = %+v, want Bearer token of scope %q for 1200 seconds", succeed, tt.wantScope)
+			}
+
+			// Client token has permissions of its scopes, and is not an account
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", succeed.AccessToken, nil); w.Code != http.StatusOK {
+				t.Errorf("getServiceInfo with client token status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if w := ts.call(http.MethodPut, "/api/v1/accounts/password", "", succeed.AccessToken, nil); w.Code != http.StatusForbidden {
+				t.Errorf("change password with client token status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/oidc"
+)
+
+// A function to verify token of external issuer, and map it to claims of local token
+func ParseExternalToken(externalIssuers *oidc.Verifier, token string) (*Claims, error) {
+
+	identity, err := externalIssuers.Verify(token, time.Now())
+	if err != nil {
+		return nil, &TokenError{Code: TokenErrExternalTokenInvalid, Message: err.Error()}
+	}
+
+	// jti is used in revocation, keep jti of issuers apart, and token without jti gets one from its hash
+	jti := identity.Issuer + "#" + identity.ID
+	if identity.ID == "" {
+		sum := sha256.Sum256([]byte(token))
+		jti = identity.Issuer + "#sha256-" + hex.EncodeToString(sum[:16])
+	}
+
+	claims := &Claims{
+		Account: identity.Account,
+		Role:    identity.Role,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: identity.ExpiresAt.Unix(),
+			Id:        jti,
+			IssuedAt:  identity.IssuedAt.Unix(),
+			Issuer:    identity.Issuer,
+			Subject:   identity.Subject,
+		},
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+func TestExternalIssuerToken(t *testing.T) {
+
+	idpKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := prepareTestServer(t)
+	ts.writeJSON("jwks.json", keyset.JWKSet{Keys: []keyset.JWK{{
+		Kty: "EC",
+		Kid: "idp-1",
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(idpKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(idpKey.Y.FillBytes(make([]byte, 32))),
+	}}})
+	ts.writeJSON("issuers.json", map[string]interface{}{"issuers": []map[string]interface{}{{
+		"issuer":         "https://idp.example.com",
+		"audiences":      []string{"CXWEO-API"},
+		"jwks_file":      "jwks.json",
+		"account_claim":  "email",
+		"account_prefix": "idp:",
+		"role_rules":     []map[string]string{{"claim": "groups", "value": "admins", "role": "Admin"}},
+		"default_role":   "Member",
+	}}})
+	ts.start(testConfig{"TOKEN": {"External_Issuers_File_Path": "issuers.json"}})
+
+	externalToken := func(issuer string, groups ...string) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"iss":    issuer,
+			"sub":    "00u1",
+			"aud":    "CXWEO-API",
+			"email":  "alice@example.com",
+			"groups": groups,
+			"jti":    "idp-jti",
+			"iat":    now.Unix(),
+			"exp":    now.Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "idp-1"
+		signed, err := token.SignedString(idpKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// External account is mapped with prefix and role rules
+	w := ts.call(http.MethodGet, "/api/v1/me", "", externalToken("https://idp.example.com"), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("me with external token status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var meSucceed MeSucceed
+	decodeBody(t, w, &meSucceed)
+	if meSucceed.Account != "idp:alice@example.com" || meSucceed.Role != "Member" || meSucceed.Issuer != "https://idp.example.com" {
+		t.Errorf("me = %+v, want idp:alice@example.com of role Member", meSucceed)
+	}
+
+	adminToken := externalToken("https://idp.example.com", "admins")
+	if w := ts.call(http.MethodGet, "/api/v1/admin/apikeys", "", adminToken, nil); w.Code != http.StatusOK {
+		t.Errorf("admin route with external admin token status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// Token of untrusted issuer is verified as local token and rejected, the log only has its fingerprint
+	untrusted := externalToken("https://other.example.com")
+	if w := ts.call(http.MethodGet, "/api/v1/me", "", untrusted, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("me with untrusted issuer token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	logs := ts.logs.String()
+	if strings.Contains(logs, untrusted) || strings.Contains(logs, strings.Split(untrusted, ".")[1]) {
+		t.Error("rejected token is written to log")
+	}
+	if !strings.Contains(logs, tokenFingerprint(untrusted)) {
+		t.Errorf("log = %s, want fingerprint %s of rejected token", logs, tokenFingerprint(untrusted))
+	}
+}
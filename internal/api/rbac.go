@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/auth"
+)
+
+// Forbidden resp, will be used when 403 in all api path
+type ForbiddenResp struct {
+	ErrorString string `json:"error" example:"permission denied"`
+	Required    string `json:"required" example:"service:read"`
+}
+
+// RequireRole returns middleware to check whether role of token is one of roles, should be used after AuthRequired
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		role := c.GetString("role")
+
+		for _, allowedRole := range roles {
+			if role == allowedRole {
+				c.Next()
+				return
+			}
+		}
+
+		denyAccess(c, "role "+strings.Join(roles, "|"))
+	}
+}
+
+// RequireAccount returns middleware to check whether token is of an account, should be used after AuthRequired.
+// Client credentials token has no account, so it can not manage credentials of account.
+func RequireAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if c.GetString("account") == "" {
+			denyAccess(c, "account")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission returns middleware to check whether role of token has permission in policy, should be used after AuthRequired.
+// Client credentials token has no role, and passes if permission is one of its scopes.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// Fetch policy
+		policy := c.MustGet("Policy").(*auth.Policy)
+
+		if policy.HasPermission(c.GetString("role"), permission) {
+			c.Next()
+			return
+		}
+
+		for _, scope := range c.GetStringSlice("scopes") {
+			if scope == permission {
+				c.Next()
+				return
+			}
+		}
+
+		denyAccess(c, permission)
+	}
+}
+
+// denyAccess returns 403 and writes audit log line of denial
+func denyAccess(c *gin.Context, required string) {
+
+	var forbiddenResp = ForbiddenResp{}
+	forbiddenResp.ErrorString = "permission denied"
+	forbiddenResp.Required = required
+	c.JSON(http.StatusForbidden, forbiddenResp)
+
+	auditLog(c, audit.Event{Type: audit.EventAccessDenied, Outcome: audit.OutcomeFailure, Reason: "role " + c.GetString("role") + " requires " + required})
+
+	c.Abort()
+}
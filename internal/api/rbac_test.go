@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+)
+
+func TestRBAC(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	memberToken := ts.login("web", "alice").Token
+	adminToken := ts.login("web", "admin").Token
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		wantStatus int
+	}{
+		{"member has permission", http.MethodGet, "/api/v1/getServiceInfo", memberToken, http.StatusOK},
+		{"admin has all permissions", http.MethodGet, "/api/v1/getServiceInfo", adminToken, http.StatusOK},
+		{"member is not admin", http.MethodGet, "/api/v1/admin/apikeys", memberToken, http.StatusForbidden},
+		{"admin route", http.MethodGet, "/api/v1/admin/apikeys", adminToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.call(tt.method, tt.target, "", tt.token, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	events := ts.auditEvents(audit.EventAccessDenied)
+	if len(events) != 1 || events[0].Actor != "alice" {
+		t.Errorf("access denied audit events = %+v, want one of alice", events)
+	}
+}
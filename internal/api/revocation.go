@@ -0,0 +1,229 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+)
+
+// Logout receive and response struct
+
+type LogoutReceiveBody struct {
+	RefreshToken string `json:"RefreshToken" example:"refresh token" format:"string"`
+}
+
+type LogoutSucceed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+type LogoutFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// @Summary Logout and revoke current token.
+// @Description revoke current access token, and the refresh token family if refresh token is given
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body LogoutReceiveBody false "Refresh token to revoke"
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} LogoutSucceed
+// @Failure 400 {object} LogoutFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 500 {object} LogoutFailed
+// @Router /api/v1/logout [post]
+func Logout(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch account and token info
+	account := c.MustGet("account").(string)
+	jti := c.MustGet("jti").(string)
+	tokenExpiresAt := c.MustGet("tokenExpiresAt").(time.Time)
+
+	// Fetch body received, body is optional
+	var receiveBody = LogoutReceiveBody{}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&receiveBody); err != nil {
+			var logoutFailed = LogoutFailed{}
+			logoutFailed.Message = "Account " + account + " bad request: " + err.Error()
+			c.JSON(http.StatusBadRequest, logoutFailed)
+			logger.Warn("Account " + account + " logout bad request: " + err.Error())
+			return
+		}
+	}
+
+	// Fetch revocation store
+	revocationStore := c.MustGet("RevocationStore").(tokenstore.RevocationStore)
+
+	// Revoke current access token until it expires
+	if err := revocationStore.RevokeToken(jti, tokenExpiresAt); err != nil {
+		var logoutFailed = LogoutFailed{}
+		logoutFailed.Message = "Account " + account + " logout failed."
+		c.JSON(http.StatusInternalServerError, logoutFailed)
+		logger.Warn("Account " + account + " logout revoke token " + jti + " failed: " + err.Error())
+		return
+	}
+
+	// Remove session of opaque token, the token is rejected by revocation anyway
+	if err := deleteSession(c, jti); err != nil {
+		logger.Warn("Account " + account + " logout delete session " + jti + " failed: " + err.Error())
+	}
+
+	// Refresh token is in cookie in session cookie mode
+	if refreshCookie, ok := sessionCookie(c, true); ok && receiveBody.RefreshToken == "" {
+		receiveBody.RefreshToken = refreshCookie
+	}
+
+	// Revoke refresh token family if given
+	if receiveBody.RefreshToken != "" {
+		refreshStore := c.MustGet("RefreshStore").(tokenstore.RefreshStore)
+		refreshStore.RevokeToken(receiveBody.RefreshToken)
+	}
+
+	// Remove session cookies, clearSessionCookies is in session.go
+	clearSessionCookies(c)
+
+	var logoutSucceed = LogoutSucceed{}
+	logoutSucceed.Message = "Account " + account + " logout succeed."
+	c.JSON(http.StatusOK, logoutSucceed)
+
+	logger.Info("Account " + account + " logout and revoked token " + jti)
+	auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeSuccess, Target: "jti " + jti, Reason: "logout"})
+	return
+}
+
+// Revoke tokens receive and response struct
+
+type RevokeTokensReceiveBody struct {
+	Jti     string `json:"Jti" example:"jti" format:"string"`
+	Account string `json:"Account" example:"account" format:"string"`
+}
+
+type RevokeTokensSucceed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+type RevokeTokensFailed struct {
+	Message string `json:"message" example:"msg" format:"string"`
+}
+
+// @Summary Revoke tokens by jti or by account.
+// @Description revoke one access token by jti, or all access and refresh tokens of an account, admin only
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Accept  json
+// @Produce  json
+// @Param Body body RevokeTokensReceiveBody true "Jti or Account"
+// @Tags AAA
+// @version 1.0
+// @Success 200 {object} RevokeTokensSucceed
+// @Failure 400 {object} RevokeTokensFailed
+// @Failure 401 {object} AuthFailedResp
+// @Failure 403 {object} ForbiddenResp
+// @Failure 500 {object} RevokeTokensFailed
+// @Router /api/v1/admin/tokens/revoke [post]
+func RevokeTokens(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch admin account
+	admin := c.MustGet("account").(string)
+
+	// Fetch body received
+	var receiveBody = RevokeTokensReceiveBody{}
+
+	err := c.ShouldBindJSON(&receiveBody)
+	if err != nil || (receiveBody.Jti == "" && receiveBody.Account == "") {
+		var revokeFailed = RevokeTokensFailed{}
+		revokeFailed.Message = "bad request: Jti or Account is required"
+		c.JSON(http.StatusBadRequest, revokeFailed)
+		logger.Warn("Admin " + admin + " revoke tokens bad request")
+		return
+	}
+
+	// Fetch revocation store
+	revocationStore := c.MustGet("RevocationStore").(tokenstore.RevocationStore)
+
+	// Revoked entries are kept until the longest possible access token of any tenant expires, leeway included
+	now := time.Now()
+	expiresAt := now.Add(revocationTTL(c))
+
+	if receiveBody.Jti != "" {
+		if err := revocationStore.RevokeToken(receiveBody.Jti, expiresAt); err != nil {
+			var revokeFailed = RevokeTokensFailed{}
+			revokeFailed.Message = "revoke token " + receiveBody.Jti + " failed."
+			c.JSON(http.StatusInternalServerError, revokeFailed)
+			logger.Warn("Admin " + admin + " revoke token " + receiveBody.Jti + " failed: " + err.Error())
+			auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeFailure, Target: "jti " + receiveBody.Jti, Reason: err.Error()})
+			return
+		}
+		if err := deleteSession(c, receiveBody.Jti); err != nil {
+			logger.Warn("Admin " + admin + " delete session " + receiveBody.Jti + " failed: " + err.Error())
+		}
+
+		logger.Warn("Admin " + admin + " revoked token " + receiveBody.Jti)
+		auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeSuccess, Target: "jti " + receiveBody.Jti, Reason: "revoked by admin"})
+	}
+
+	if receiveBody.Account != "" {
+		if err := revocationStore.RevokeAccount(receiveBody.Account, now, expiresAt); err != nil {
+			var revokeFailed = RevokeTokensFailed{}
+			revokeFailed.Message = "revoke tokens of account " + receiveBody.Account + " failed."
+			c.JSON(http.StatusInternalServerError, revokeFailed)
+			logger.Warn("Admin " + admin + " revoke tokens of account " + receiveBody.Account + " failed: " + err.Error())
+			auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeFailure, Target: "account " + receiveBody.Account, Reason: err.Error()})
+			return
+		}
+
+		// Refresh tokens of account are revoked too, otherwise new access tokens can be refreshed
+		refreshStore := c.MustGet("RefreshStore").(tokenstore.RefreshStore)
+		refreshStore.RevokeAccount(receiveBody.Account)
+
+		if err := deleteAccountSessions(c, receiveBody.Account); err != nil {
+			logger.Warn("Admin " + admin + " delete sessions of account " + receiveBody.Account + " failed: " + err.Error())
+		}
+
+		logger.Warn("Admin " + admin + " revoked tokens of account " + receiveBody.Account)
+		auditLog(c, audit.Event{Type: audit.EventTokenRevocation, Outcome: audit.OutcomeSuccess, Target: "account " + receiveBody.Account, Reason: "revoked by admin"})
+	}
+
+	var revokeSucceed = RevokeTokensSucceed{}
+	revokeSucceed.Message = "revoke tokens succeed."
+	c.JSON(http.StatusOK, revokeSucceed)
+	return
+}
+
+// deleteSession removes session of opaque token of jti, there is no session in jwt format
+func deleteSession(c *gin.Context, jti string) error {
+
+	// Fetch token options
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	if tokenOptions.Sessions == nil {
+		return nil
+	}
+
+	return tokenOptions.Sessions.Delete(jti)
+}
+
+// deleteAccountSessions removes sessions of opaque tokens of account, there is no session in jwt format
+func deleteAccountSessions(c *gin.Context, account string) error {
+
+	// Fetch token options
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	if tokenOptions.Sessions == nil {
+		return nil
+	}
+
+	return tokenOptions.Sessions.DeleteAccount(account)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// jtiOf returns jti of token without verifying it
+func jtiOf(t *testing.T, token string) string {
+
+	claims := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.Id
+}
+
+func TestLogout(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	loginSucceed := ts.login("web", "alice")
+	other := ts.login("web", "alice")
+
+	w := ts.call(http.MethodPost, "/api/v1/logout", "", loginSucceed.Token, LogoutReceiveBody{RefreshToken: loginSucceed.RefreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// Token and refresh token of the session are revoked, other sessions of account are not
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", loginSucceed.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("token after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/token/refresh", "web", "", RefreshReceiveBody{RefreshToken: loginSucceed.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", other.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("token of other session status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRevokeTokens(t *testing.T) {
+
+	ts := newTestServer(t, nil)
+
+	adminToken := ts.login("web", "admin").Token
+
+	t.Run("by jti", func(t *testing.T) {
+		revoked := ts.login("web", "alice").Token
+		kept := ts.login("web", "alice").Token
+
+		w := ts.call(http.MethodPost, "/api/v1/admin/tokens/revoke", "", adminToken, RevokeTokensReceiveBody{Jti: jtiOf(t, revoked)})
+		if w.Code != http.StatusOK {
+			t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+		}
+
+		if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", revoked, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("revoked token status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", kept, nil); w.Code != http.StatusOK {
+			t.Errorf("other token status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("by account", func(t *testing.T) {
+		before := ts.login("web", "alice")
+
+		w := ts.call(http.MethodPost, "/api/v1/admin/tokens/revoke", "", adminToken, RevokeTokensReceiveBody{Account: "alice"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+		}
+
+		if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", before.Token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("token issued before revocation status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := ts.call(http.MethodPost, "/api/v1/token/refresh", "web", "", RefreshReceiveBody{RefreshToken: before.RefreshToken}); w.Code != http.StatusUnauthorized {
+			t.Errorf("refresh token issued before revocation status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		// Login right after revocation, likely in the same second, is not revoked
+		after := ts.login("web", "alice")
+		if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", after.Token, nil); w.Code != http.StatusOK {
+			t.Errorf("token issued after revocation status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("neither jti nor account", func(t *testing.T) {
+		w := ts.call(http.MethodPost, "/api/v1/admin/tokens/revoke", "", adminToken, RevokeTokensReceiveBody{})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("revoke status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
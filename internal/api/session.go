@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// Header of CSRF token, its value should equal CSRF cookie
+const CSRFHeader = "X-CSRF-Token"
+
+// Error code of CSRF check, returned in code of 403 body
+const CSRFErrInvalid = "csrf_token_invalid"
+
+// Refresh token cookie is only sent to /api/v1, used by token refresh and logout
+const refreshCookiePath = "/api/v1"
+
+// respondTokenPair returns token pair in body, or sets them to HttpOnly cookies in cookie mode and returns CSRF token in body
+func respondTokenPair(c *gin.Context, token, refreshToken string) error {
+
+	// Fetch session config
+	sessionCfg := c.MustGet("SessionConf").(conf.SessionConf)
+
+	var loginSucceed = LoginSucceed{}
+
+	if !sessionCfg.CookieMode {
+		loginSucceed.Token = token
+		loginSucceed.RefreshToken = refreshToken
+		c.JSON(http.StatusOK, loginSucceed)
+		return nil
+	}
+
+	// Fetch token options
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	// CSRF token is random and readable by frontend, it is sent back in header of state-changing requests
+	randomBytes := utils.GenerateRandomBytes(32)
+	if randomBytes == nil {
+		return errors.New("generate csrf token failed")
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	setCookie(c, sessionCfg, sessionCfg.CookieName, token, "/", accessTokenTTL(c, c.GetString("tenant")), true)
+	setCookie(c, sessionCfg, sessionCfg.CookieName+"_refresh", refreshToken, refreshCookiePath, tokenOptions.RefreshTokenTTL, true)
+	setCookie(c, sessionCfg, sessionCfg.CSRFCookieName, csrfToken, "/", tokenOptions.RefreshTokenTTL, false)
+
+	loginSucceed.CSRFToken = csrfToken
+	c.JSON(http.StatusOK, loginSucceed)
+
+	return nil
+}
+
+// clearSessionCookies removes cookies of session, nothing is done if not in cookie mode
+func clearSessionCookies(c *gin.Context) {
+
+	// Fetch session config
+	sessionCfg := c.MustGet("SessionConf").(conf.SessionConf)
+
+	if !sessionCfg.CookieMode {
+		return
+	}
+
+	setCookie(c, sessionCfg, sessionCfg.CookieName, "", "/", -1, true)
+	setCookie(c, sessionCfg, sessionCfg.CookieName+"_refresh", "", refreshCookiePath, -1, true)
+	setCookie(c, sessionCfg, sessionCfg.CSRFCookieName, "", "/", -1, false)
+}
+
+// sessionCookie returns value of access token cookie, or refresh token cookie if refresh is true
+func sessionCookie(c *gin.Context, refresh bool) (string, bool) {
+
+	// Fetch session config
+	sessionCfg := c.MustGet("SessionConf").(conf.SessionConf)
+
+	if !sessionCfg.CookieMode {
+		return "", false
+	}
+
+	name := sessionCfg.CookieName
+	if refresh {
+		name += "_refresh"
+	}
+
+	value, err := c.Cookie(name)
+	if err != nil || value == "" {
+		return "", false
+	}
+
+	return value, true
+}
+
+// checkCSRF checks CSRF header equals CSRF cookie, safe methods are not checked
+func checkCSRF(c *gin.Context) bool {
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	// Fetch session config
+	sessionCfg := c.MustGet("SessionConf").(conf.SessionConf)
+
+	csrfCookie, err := c.Cookie(sessionCfg.CSRFCookieName)
+	if err != nil || csrfCookie == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(csrfCookie), []byte(c.GetHeader(CSRFHeader))) == 1
+}
+
+// rejectCSRF returns 403 of CSRF check
+func rejectCSRF(c *gin.Context) {
+
+	var authFailedResp = AuthFailedResp{}
+	authFailedResp.ErrorString = "csrf token is invalid"
+	authFailedResp.Code = CSRFErrInvalid
+	c.JSON(http.StatusForbidden, authFailedResp)
+
+	c.Abort()
+}
+
+// setCookie sets Secure cookie with same site of config, negative maxAge removes cookie
+func setCookie(c *gin.Context, sessionCfg conf.SessionConf, name, value, path string, maxAge time.Duration, httpOnly bool) {
+
+	sameSite := http.SameSiteStrictMode
+	switch sessionCfg.SameSite {
+	case "Lax":
+		sameSite = http.SameSiteLaxMode
+	case "None":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	maxAgeSeconds := int(maxAge / time.Second)
+	if maxAge < 0 {
+		maxAgeSeconds = -1
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   sessionCfg.CookieDomain,
+		MaxAge:   maxAgeSeconds,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
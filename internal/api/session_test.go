@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// cookiesOf returns cookies set by response by name
+func cookiesOf(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	return cookies
+}
+
+func TestSessionCookieMode(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"SESSION": {"Cookie_Mode": "true"}})
+
+	// Login sets tokens to cookies, only CSRF token is in body
+	w := ts.call(http.MethodPost, "/api/v1/login", "web", "", LoginReceiveBody{Account: "alice", Password: testPassword})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var loginSucceed LoginSucceed
+	decodeBody(t, w, &loginSucceed)
+	if loginSucceed.Token != "" || loginSucceed.RefreshToken != "" || loginSucceed.CSRFToken == "" {
+		t.Fatalf("login body = %+v, want only csrf token", loginSucceed)
+	}
+
+	cookies := cookiesOf(w)
+	session, refresh, csrf := cookies["cxweo_session"], cookies["cxweo_session_refresh"], cookies["cxweo_csrf"]
+	if session == nil || refresh == nil || csrf == nil {
+		t.Fatalf("login cookies = %v, want session, refresh and csrf cookies", cookies)
+	}
+	for _, cookie := range []*http.Cookie{session, refresh, csrf} {
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("cookie %s is not Secure and SameSite Strict: %+v", cookie.Name, cookie)
+		}
+	}
+	if !session.HttpOnly || !refresh.HttpOnly || csrf.HttpOnly {
+		t.Errorf("token cookies should be HttpOnly and csrf cookie readable, got %v %v %v", session.HttpOnly, refresh.HttpOnly, csrf.HttpOnly)
+	}
+	if refresh.Path != "/api/v1" || csrf.Value != loginSucceed.CSRFToken {
+		t.Errorf("refresh cookie path = %q, csrf cookie = %q, want /api/v1 and csrf token of body", refresh.Path, csrf.Value)
+	}
+
+	// withCookies sends request with session cookies and CSRF header if not empty
+	withCookies := func(method, target, client, csrfHeader string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := ts.newRequest(method, target, nil)
+		if client != "" {
+			req.Header.Set("X-API-Key", ts.apiKeys[client])
+		}
+		if csrfHeader != "" {
+			req.Header.Set(CSRFHeader, csrfHeader)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return ts.serve(req)
+	}
+
+	// Safe method needs no CSRF token
+	if w := withCookies(http.MethodGet, "/api/v1/getServiceInfo", "", "", session); w.Code != http.StatusOK {
+		t.Errorf("get with session cookie status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	csrfTests := []struct {
+		name       string
+		csrfHeader string
+	}{
+		{"no csrf header", ""},
+		{"wrong csrf header", "wrong-csrf-token"},
+	}
+	for _, tt := range csrfTests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, target := range []string{"/api/v1/logout", "/api/v1/token/refresh"} {
+				w := withCookies(http.MethodPost, target, "web", tt.csrfHeader, session, refresh, csrf)
+				var authFailedResp AuthFailedResp
+				decodeBody(t, w, &authFailedResp)
+				if w.Code != http.StatusForbidden || authFailedResp.Code != CSRFErrInvalid {
+					t.Errorf("post %s status = %d, code = %q, want %d with %q", target, w.Code, authFailedResp.Code, http.StatusForbidden, CSRFErrInvalid)
+				}
+			}
+		})
+	}
+
+	// Refresh with cookie and CSRF token rotates token cookies
+	w = withCookies(http.MethodPost, "/api/v1/token/refresh", "web", csrf.Value, refresh, csrf)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh with cookie status = %d, body = %s", w.Code, w.Body.String())
+	}
+	rotated := cookiesOf(w)
+	if rotated["cxweo_session"] == nil || rotated["cxweo_session_refresh"] == nil || rotated["cxweo_session_refresh"].Value == refresh.Value {
+		t.Fatalf("refresh cookies = %v, want rotated session and refresh cookies", rotated)
+	}
+	session, refresh, csrf = rotated["cxweo_session"], rotated["cxweo_session_refresh"], rotated["cxweo_csrf"]
+
+	// Logout with CSRF token removes cookies
+	w = withCookies(http.MethodPost, "/api/v1/logout", "", csrf.Value, session, refresh, csrf)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout with cookie status = %d, body = %s", w.Code, w.Body.String())
+	}
+	for name, cookie := range cookiesOf(w) {
+		if cookie.MaxAge >= 0 || cookie.Value != "" {
+			t.Errorf("cookie %s after logout = %+v, want removed", name, cookie)
+		}
+	}
+	if w := withCookies(http.MethodGet, "/api/v1/getServiceInfo", "", "", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("get with session cookie after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCorsConfig(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		allowedOrigins  string
+		origin          string
+		wantAllowOrigin string
+		wantCredentials bool
+	}{
+		{"any origin without allowed origins", "", "https://app.example.com", "*", false},
+		{"allowed origin", "https://app.example.com", "https://app.example.com", "https://app.example.com", true},
+		{"other origin", "https://app.example.com", "https://evil.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, testConfig{"CORS": {"Allowed_Origins": tt.allowedOrigins}})
+
+			req := ts.newRequest(http.MethodOptions, "/api/v1/login", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			w := ts.serve(req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.wantCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+)
+
+// A function to check signed request of API key, which signs method, path, body hash, timestamp and nonce with signing secret
+func ValidateSignedRequest(c *gin.Context) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	// Fetch API key store
+	apiKeyStore := c.MustGet("APIKeyStore").(*apikey.Store)
+
+	// Fetch max clock skew of signed request
+	maxSkew := c.MustGet("SignatureMaxSkew").(time.Duration)
+
+	// Read signing headers from request
+	keyID := c.GetHeader(apikey.HeaderKeyID)
+	timestamp := c.GetHeader(apikey.HeaderTimestamp)
+	nonce := c.GetHeader(apikey.HeaderNonce)
+	signature := c.GetHeader(apikey.HeaderSignature)
+
+	// Find record and signing secret of key id
+	record, ok := apiKeyStore.LookupID(keyID)
+	if !ok {
+		rejectSignedRequest(c, logger, keyID, "no such API-Key id, authentication failed")
+		return
+	}
+
+	signingSecret, err := apiKeyStore.SigningSecret(keyID)
+	if err != nil {
+		rejectSignedRequest(c, logger, keyID, err.Error())
+		return
+	}
+
+	// Check timestamp and nonce format before reading body
+	signedAt, err := apikey.CheckTimestamp(timestamp, time.Now(), maxSkew)
+	if err != nil {
+		rejectSignedRequest(c, logger, keyID, err.Error())
+		return
+	}
+
+	if err := apikey.CheckNonceFormat(nonce); err != nil {
+		rejectSignedRequest(c, logger, keyID, err.Error())
+		return
+	}
+
+	// Fetch max body size of signed request
+	maxBodyBytes := c.MustGet("SignedBodyMaxBytes").(int64)
+
+	// Read body to hash it, then put it back for handlers. Body is read before signature verified, so its size is limited
+	var body []byte
+	if c.Request.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+		if err != nil {
+			rejectSignedRequestBody(c, logger, keyID, maxBodyBytes)
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	// Verify signature
+	stringToSign := apikey.StringToSign(c.Request.Method, c.Request.URL.RequestURI(), body, timestamp, nonce)
+	if !apikey.VerifySignature(signingSecret, stringToSign, signature) {
+		rejectSignedRequest(c, logger, keyID, apikey.ErrSignatureInvalid.Error())
+		return
+	}
+
+	// Fetch nonce store
+	nonceStore := c.MustGet("NonceStore").(apikey.NonceStore)
+
+	// Nonce is remembered until its timestamp is out of window, so replay is rejected
+	if !nonceStore.Use(keyID, nonce, signedAt.Add(maxSkew)) {
+		rejectSignedRequest(c, logger, keyID, apikey.ErrNonceReused.Error())
+		return
+	}
+
+	c.Set("requestSigned", true)
+
+	acceptAPIKey(c, keyID, record)
+}
+
+// rejectSignedRequestBody returns 413 when body of signed request can not be read within limit
+func rejectSignedRequestBody(c *gin.Context, logger *logrus.Entry, keyID string, maxBodyBytes int64) {
+
+	reason := "request body is larger than " + strconv.FormatInt(maxBodyBytes, 10) + " bytes or can not be read"
+
+	var authFailedResp = AuthFailedResp{}
+	authFailedResp.ErrorString = reason
+	c.JSON(http.StatusRequestEntityTooLarge, authFailedResp)
+
+	logger.Warn("Signed request of API-Key " + keyID + " rejected from " + c.ClientIP() + " on " + c.Request.Method + " " + c.Request.URL.Path + ": " + reason)
+	auditLog(c, audit.Event{Type: audit.EventAPIKeyUse, Outcome: audit.OutcomeFailure, Target: keyID, Reason: "signed request: " + reason})
+
+	c.Abort()
+}
+
+// rejectSignedRequest returns 401 and logs reason
+func rejectSignedRequest(c *gin.Context, logger *logrus.Entry, keyID, reason string) {
+
+	var authFailedResp = AuthFailedResp{}
+	authFailedResp.ErrorString = reason
+	c.JSON(http.StatusUnauthorized, authFailedResp)
+
+	logger.Warn("Signed request of API-Key " + keyID + " rejected from " + c.ClientIP() + " on " + c.Request.Method + " " + c.Request.URL.Path + ": " + reason)
+	auditLog(c, audit.Event{Type: audit.EventAPIKeyUse, Outcome: audit.OutcomeFailure, Target: keyID, Reason: "signed request: " + reason})
+
+	c.Abort()
+}
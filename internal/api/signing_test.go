@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+)
+
+// signedRequest returns request of client signed with its signing secret
+func (ts *testServer) signedRequest(client, method, target string, body []byte, timestamp time.Time, nonce string) *http.Request {
+
+	keyID := ts.keyIDs[client]
+	signingSecret := apikey.DeriveSigningSecret(ts.hmacKey, keyID, apikey.HashKey(ts.apiKeys[client], ts.hmacKey))
+	unixSeconds := strconv.FormatInt(timestamp.Unix(), 10)
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(apikey.HeaderKeyID, keyID)
+	req.Header.Set(apikey.HeaderTimestamp, unixSeconds)
+	req.Header.Set(apikey.HeaderNonce, nonce)
+	req.Header.Set(apikey.HeaderSignature, apikey.Sign(signingSecret, apikey.StringToSign(method, target, body, unixSeconds, nonce)))
+
+	return req
+}
+
+func TestValidateSignedRequest(t *testing.T) {
+
+	ts := newTestServer(t, testConfig{"API SERVER": {"Signed_Body_Max_Bytes": "256"}},
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "signer", Scopes: []string{"login"}, RequireSigning: true},
+	)
+
+	loginBody, err := json.Marshal(LoginReceiveBody{Account: "alice", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	t.Run("signed request", func(t *testing.T) {
+		w := ts.serve(ts.signedRequest("signer", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-signed-0001"))
+		if w.Code != http.StatusOK {
+			t.Errorf("signed login status = %d, body = %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		if w := ts.serve(ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-replay-0001")); w.Code != http.StatusOK {
+			t.Fatalf("first request status = %d, body = %s", w.Code, w.Body.String())
+		}
+
+		// The same signed request again
+		w := ts.serve(ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-replay-0001"))
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), apikey.ErrNonceReused.Error()) {
+			t.Errorf("replayed request status = %d, body = %s, want %d with nonce reused", w.Code, w.Body.String(), http.StatusUnauthorized)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		req        func() *http.Request
+		wantStatus int
+		wantError  string
+	}{
+		{
+			"timestamp out of skew",
+			func() *http.Request {
+				return ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now.Add(-10*time.Minute), "nonce-skew-000001")
+			},
+			http.StatusUnauthorized, apikey.ErrTimestampOutOfWindow.Error(),
+		},
+		{
+			"malformed nonce",
+			func() *http.Request {
+				return ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "short")
+			},
+			http.StatusUnauthorized, apikey.ErrNonceMalformed.Error(),
+		},
+		{
+			"body changed after signing",
+			func() *http.Request {
+				req := ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-changed-001")
+				other := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "admin", Password: testPassword})
+				req.Body = other.Body
+				return req
+			},
+			http.StatusUnauthorized, apikey.ErrSignatureInvalid.Error(),
+		},
+		{
+			"query changed after signing",
+			func() *http.Request {
+				req := ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-query-00001")
+				req.URL.RawQuery = "x=1"
+				req.RequestURI = "/api/v1/login?x=1"
+				return req
+			},
+			http.StatusUnauthorized, apikey.ErrSignatureInvalid.Error(),
+		},
+		{
+			"unknown key id",
+			func() *http.Request {
+				req := ts.signedRequest("web", http.MethodPost, "/api/v1/login", loginBody, now, "nonce-unknown-001")
+				req.Header.Set(apikey.HeaderKeyID, "0000000000000000")
+				return req
+			},
+			http.StatusUnauthorized, "no such API-Key id",
+		},
+		{
+			"body larger than limit",
+			func() *http.Request {
+				return ts.signedRequest("web", http.MethodPost, "/api/v1/login", bytes.Repeat([]byte("a"), 257), now, "nonce-large-00001")
+			},
+			http.StatusRequestEntityTooLarge, "larger than 256 bytes",
+		},
+		{
+			"signing required key in header",
+			func() *http.Request {
+				req := ts.newRequest(http.MethodPost, "/api/v1/login", LoginReceiveBody{Account: "alice", Password: testPassword})
+				req.Header.Set("X-API-Key", ts.apiKeys["signer"])
+				return req
+			},
+			http.StatusUnauthorized, apikey.ErrSigningRequired.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.serve(tt.req())
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("status = %d, body = %s, want %d with %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/audit"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+)
+
+// checkTenant checks whether tenant exists, role is allowed in it, and its requests are under limit, then sets tenant to context.
+// If not, it returns 403 or 429, writes audit log and aborts.
+func checkTenant(c *gin.Context, tenantName, role string) bool {
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	if err := tenants.Check(tenantName, role, time.Now()); err != nil {
+		rejectTenant(c, tenantName, err)
+		return false
+	}
+
+	c.Set("tenant", tenantName)
+
+	return true
+}
+
+// checkClientTenant checks tenant of API key or client certificate with checkTenant.
+// Client presented with token is not counted here, AuthRequired counts the request once when it checks tenant of token.
+func checkClientTenant(c *gin.Context, tenantName string) bool {
+
+	if !c.GetBool("clientWithToken") {
+		return checkTenant(c, tenantName, "")
+	}
+
+	// Fetch tenants
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+
+	if err := tenants.CheckRole(tenantName, ""); err != nil {
+		rejectTenant(c, tenantName, err)
+		return false
+	}
+
+	c.Set("tenant", tenantName)
+
+	return true
+}
+
+// rejectTenant returns 403, or 429 when tenant is rate limited, writes audit log and aborts
+func rejectTenant(c *gin.Context, tenantName string, err error) {
+
+	// Fetch logger
+	logger := c.MustGet("Logger").(*logrus.Entry)
+
+	status := http.StatusForbidden
+	if err == tenant.ErrRateLimited {
+		status = http.StatusTooManyRequests
+		c.Header("Retry-After", "60")
+	}
+
+	var forbiddenResp = ForbiddenResp{}
+	forbiddenResp.ErrorString = err.Error()
+	forbiddenResp.Required = "tenant " + tenantName
+	c.JSON(status, forbiddenResp)
+
+	logger.Warn("Tenant " + tenantName + " request of account " + c.GetString("account") + " client " + c.GetString("client") +
+		" rejected on " + c.Request.Method + " " + c.Request.URL.Path + ": " + err.Error())
+	auditLog(c, audit.Event{Type: audit.EventAccessDenied, Outcome: audit.OutcomeFailure, Tenant: tenantName, Reason: err.Error()})
+
+	c.Abort()
+}
+
+// accessTokenTTL returns access token lifetime of tenant
+func accessTokenTTL(c *gin.Context, tenantName string) time.Duration {
+
+	// Fetch tenants and token options
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	return tenants.AccessTokenTTL(tenantName, tokenOptions.AccessTokenTTL)
+}
+
+// revocationTTL returns how long revocation of account or token should be kept,
+// which is the longest lifetime of access token of any tenant or impersonation token, with leeway
+func revocationTTL(c *gin.Context) time.Duration {
+
+	// Fetch tenants and token options
+	tenants := c.MustGet("Tenants").(*tenant.Tenants)
+	tokenOptions := c.MustGet("TokenOptions").(*TokenOptions)
+
+	ttl := tenants.MaxAccessTokenTTL(tokenOptions.AccessTokenTTL)
+	if tokenOptions.ImpersonationTokenTTL > ttl {
+		ttl = tokenOptions.ImpersonationTokenTTL
+	}
+
+	return ttl + tokenOptions.Leeway
+}
+
+// requestClientTenant returns tenant of API key or client certificate validated with request by ValidatePresentedClient, false if neither is presented
+func requestClientTenant(c *gin.Context) (string, bool) {
+
+	record, ok := c.Get("apiKeyRecord")
+	if !ok {
+		return "", false
+	}
+
+	return record.(apikey.Record).Tenant, true
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+
+	"github.com/cxweoth/gin-api-server-template/internal/apikey"
+	"github.com/cxweoth/gin-api-server-template/internal/tenant"
+)
+
+func newTenantTestServer(t *testing.T) *testServer {
+
+	return newTestServer(t, testConfig{
+		"TENANT acme":    {"Service_Name": "Acme API", "Access_Token_TTL_Minutes": "5", "Allowed_Roles": "Member"},
+		"TENANT globex":  {},
+		"TENANT limited": {"Requests_Per_Minute": "2"},
+	},
+		apikey.Record{Client: "web", Scopes: []string{"login"}},
+		apikey.Record{Client: "acme-web", Tenant: "acme", Scopes: []string{"login"}},
+		apikey.Record{Client: "globex-web", Tenant: "globex", Scopes: []string{"login"}},
+		apikey.Record{Client: "limited-web", Tenant: "limited", Scopes: []string{"login"}},
+		apikey.Record{Client: "initech-web", Tenant: "initech", Scopes: []string{"login"}},
+	)
+}
+
+func TestTenantToken(t *testing.T) {
+
+	ts := newTenantTestServer(t)
+
+	token := ts.login("acme-web", "alice").Token
+
+	// Token has tenant claim and lifetime of tenant
+	claims := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Tenant != "acme" || claims.ExpiresAt-claims.IssuedAt != int64(5*time.Minute/time.Second) {
+		t.Errorf("token tenant = %q, lifetime = %ds, want acme and 300s", claims.Tenant, claims.ExpiresAt-claims.IssuedAt)
+	}
+
+	// Service name is overridden by tenant
+	var serviceInfo ServiceInfoSuccessResp
+	decodeBody(t, ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", token, nil), &serviceInfo)
+	if serviceInfo.ServiceName != "Acme API" {
+		t.Errorf("service name = %q, want Acme API", serviceInfo.ServiceName)
+	}
+	decodeBody(t, ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", ts.login("globex-web", "alice").Token, nil), &serviceInfo)
+	if serviceInfo.ServiceName != "CXWEO" {
+		t.Errorf("service name of tenant without override = %q, want CXWEO", serviceInfo.ServiceName)
+	}
+
+	tests := []struct {
+		name       string
+		client     string
+		token      string
+		wantStatus int
+	}{
+		{"token with API key of the same tenant", "acme-web", token, http.StatusOK},
+		{"token with API key of other tenant", "globex-web", token, http.StatusForbidden},
+		{"token with API key without tenant", "web", token, http.StatusForbidden},
+		{"token without tenant with API key of tenant", "acme-web", ts.login("web", "alice").Token, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", tt.client, tt.token, nil); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, body = %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+
+	// Refresh token can not be used with API key of other tenant, and refreshed token keeps tenant of login
+	refreshToken := ts.login("acme-web", "alice").RefreshToken
+	if w := ts.call(http.MethodPost, "/api/v1/token/refresh", "globex-web", "", RefreshReceiveBody{RefreshToken: refreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with API key of other tenant status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w := ts.call(http.MethodPost, "/api/v1/token/refresh", "acme-web", "", RefreshReceiveBody{RefreshToken: refreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var loginSucceed LoginSucceed
+	decodeBody(t, w, &loginSucceed)
+	refreshed := &Claims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(loginSucceed.Token, refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Tenant != "acme" {
+		t.Errorf("refreshed token tenant = %q, want acme", refreshed.Tenant)
+	}
+}
+
+func TestTenantLogin(t *testing.T) {
+
+	ts := newTenantTestServer(t)
+
+	tests := []struct {
+		name       string
+		client     string
+		account    string
+		wantStatus int
+	}{
+		{"allowed role", "acme-web", "alice", http.StatusOK},
+		{"role not allowed in tenant", "acme-web", "admin", http.StatusForbidden},
+		{"no role restriction", "globex-web", "admin", http.StatusOK},
+		{"unknown tenant of API key", "initech-web", "alice", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.call(http.MethodPost, "/api/v1/login", tt.client, "", LoginReceiveBody{Account: tt.account, Password: testPassword})
+			if w.Code != tt.wantStatus {
+				t.Errorf("login status = %d, body = %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+
+	// Requests of tenant are limited per minute
+	for i := 0; i < 2; i++ {
+		if w := ts.call(http.MethodPost, "/api/v1/login", "limited-web", "", LoginReceiveBody{Account: "alice", Password: testPassword}); w.Code != http.StatusOK {
+			t.Fatalf("login %d of limited tenant status = %d, body = %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	w := ts.call(http.MethodPost, "/api/v1/login", "limited-web", "", LoginReceiveBody{Account: "alice", Password: testPassword})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("login over limit status = %d, Retry-After = %q, want %d and 60", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if w := ts.call(http.MethodPost, "/api/v1/login", "globex-web", "", LoginReceiveBody{Account: "alice", Password: testPassword}); w.Code != http.StatusOK {
+		t.Errorf("login of other tenant status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRevocationTTL(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		tenants []tenant.Tenant
+		options TokenOptions
+		wantTTL time.Duration
+	}{
+		{"access token", nil, TokenOptions{AccessTokenTTL: 20 * time.Minute, ImpersonationTokenTTL: 15 * time.Minute}, 20 * time.Minute},
+		{"longer access token of tenant", []tenant.Tenant{{Name: "acme", AccessTokenTTL: time.Hour}}, TokenOptions{AccessTokenTTL: 20 * time.Minute, ImpersonationTokenTTL: 15 * time.Minute}, time.Hour},
+		{"longer impersonation token", nil, TokenOptions{AccessTokenTTL: 20 * time.Minute, ImpersonationTokenTTL: 30 * time.Minute}, 30 * time.Minute},
+		{"with leeway", nil, TokenOptions{AccessTokenTTL: 20 * time.Minute, ImpersonationTokenTTL: 15 * time.Minute, Leeway: 30 * time.Second}, 20*time.Minute + 30*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenants, err := tenant.NewTenants(tt.tenants)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("Tenants", tenants)
+			c.Set("TokenOptions", &tt.options)
+
+			if got := revocationTTL(c); got != tt.wantTTL {
+				t.Errorf("revocationTTL() = %v, want %v", got, tt.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Error codes of token validation, returned in code of 401 body
+const (
+	TokenErrBearerFormat         = "invalid_bearer_format"
+	TokenErrMalformed            = "token_malformed"
+	TokenErrUnknownKey           = "unknown_kid"
+	TokenErrAlgorithmNotAllowed  = "alg_not_allowed"
+	TokenErrSignatureInvalid     = "signature_invalid"
+	TokenErrMissingClaim         = "missing_claim"
+	TokenErrExpired              = "token_expired"
+	TokenErrNotYetValid          = "token_not_yet_valid"
+	TokenErrIssuedInFuture       = "token_issued_in_future"
+	TokenErrInvalidIssuer        = "invalid_issuer"
+	TokenErrInvalidAudience      = "invalid_audience"
+	TokenErrRevoked              = "token_revoked"
+	TokenErrNotAccessToken       = "not_access_token"
+	TokenErrExternalTokenInvalid = "external_token_invalid"
+	TokenErrUnknownSession       = "unknown_session"
+	TokenErrBindingMismatch      = "token_binding_mismatch"
+	TokenErrInvalid              = "token_invalid"
+)
+
+// Standard claims which can be required
+var standardClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// TokenError tells why token is not valid, Code is one of TokenErr* codes
+type TokenError struct {
+	Code    string
+	Message string
+}
+
+func (e *TokenError) Error() string {
+	return e.Message
+}
+
+// tokenErrorCode returns code of token error, or TokenErrInvalid for other errors
+func tokenErrorCode(err error) string {
+
+	if tokenErr, ok := err.(*TokenError); ok {
+		return tokenErr.Code
+	}
+
+	return TokenErrInvalid
+}
+
+// TokenOptions are claims of issued tokens and rules of token validation
+type TokenOptions struct {
+	AccessTokenTTL        time.Duration
+	RefreshTokenTTL       time.Duration
+	ImpersonationTokenTTL time.Duration
+	Issuer                string
+	Audience              string // empty: aud is subject of token as before, and aud is not validated
+	Leeway                time.Duration
+	Algorithms            []string
+	RequiredClaims        []string
+	Sessions              tokenstore.SessionStore // set in opaque format, tokens are references to sessions instead of jwt
+	BindToClient          bool                    // issued tokens have cnf of client which requested them
+}
+
+// MakeTokenOptions returns token options of config, algorithms default to algorithms of keys in keyset
+func MakeTokenOptions(cfg conf.IConf, keySet *keyset.KeySet) (*TokenOptions, error) {
+
+	tokenCfg := cfg.TokenCfg()
+
+	options := &TokenOptions{
+		AccessTokenTTL:        tokenCfg.AccessTokenTTL,
+		RefreshTokenTTL:       tokenCfg.RefreshTokenTTL,
+		ImpersonationTokenTTL: tokenCfg.ImpersonationTokenTTL,
+		Issuer:                tokenCfg.Issuer,
+		Audience:              tokenCfg.Audience,
+		Leeway:                tokenCfg.Leeway,
+		Algorithms:            tokenCfg.AllowedAlgorithms,
+		RequiredClaims:        tokenCfg.RequiredClaims,
+		BindToClient:          tokenCfg.BindToClient,
+	}
+
+	if options.Leeway < 0 {
+		return nil, errors.New("token leeway should not be negative")
+	}
+
+	if len(options.Algorithms) == 0 {
+		options.Algorithms = keySet.Algorithms()
+	}
+
+	// Tokens signed by active key should pass validation
+	activeAlg := keySet.SigningKey().Method.Alg()
+	if !containsString(options.Algorithms, activeAlg) {
+		return nil, errors.New("alg " + activeAlg + " of active key is not in allowed algorithms")
+	}
+
+	if len(options.RequiredClaims) == 0 {
+		options.RequiredClaims = standardClaims
+	}
+	for _, claim := range options.RequiredClaims {
+		if !containsString(standardClaims, claim) {
+			return nil, errors.New("no such standard claim to require: " + claim)
+		}
+	}
+
+	// Opaque tokens are resolved with session store
+	if tokenCfg.Format == "opaque" {
+		sessions, err := tokenstore.MakeSessionStore(cfg)
+		if err != nil {
+			return nil, errors.New("init session store failed: " + err.Error())
+		}
+		options.Sessions = sessions
+	}
+
+	return options, nil
+}
+
+// sessionOf returns session which holds claims of opaque token
+func sessionOf(claims Claims) tokenstore.Session {
+
+	session := tokenstore.Session{
+		ID:        claims.Id,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		Account:   claims.Account,
+		Role:      claims.Role,
+		AMR:       claims.AMR,
+		Client:    claims.ClientID,
+		Tenant:    claims.Tenant,
+		Scope:     claims.Scope,
+		TokenUse:  claims.TokenUse,
+		IssuedAt:  issuedAtOf(&claims),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	if claims.Act != nil {
+		session.Actor = claims.Act.Subject
+	}
+	if claims.Cnf != nil {
+		session.CnfClient = claims.Cnf.Client
+		session.CnfThumbprint = claims.Cnf.X5tS256
+	}
+
+	return session
+}
+
+// claimsOfSession returns claims of opaque token, so it is handled the same as jwt
+func claimsOfSession(session tokenstore.Session) *Claims {
+
+	claims := &Claims{
+		Account:  session.Account,
+		Role:     session.Role,
+		AMR:      session.AMR,
+		TokenUse: session.TokenUse,
+		ClientID: session.Client,
+		Tenant:   session.Tenant,
+		Scope:    session.Scope,
+		IatMs:    session.IssuedAt.UnixNano() / int64(time.Millisecond),
+	}
+	if session.Actor != "" {
+		claims.Act = &Actor{Subject: session.Actor}
+	}
+	if session.CnfClient != "" || session.CnfThumbprint != "" {
+		claims.Cnf = &Confirmation{Client: session.CnfClient, X5tS256: session.CnfThumbprint}
+	}
+	claims.StandardClaims = jwt.StandardClaims{
+		Audience:  session.Audience,
+		ExpiresAt: session.ExpiresAt.Unix(),
+		Id:        session.ID,
+		IssuedAt:  session.IssuedAt.Unix(),
+		Issuer:    session.Issuer,
+		NotBefore: session.IssuedAt.Unix(),
+		Subject:   session.Subject,
+	}
+
+	return claims
+}
+
+// parseSessionToken resolves opaque token with session store, then checks claims as jwt
+func parseSessionToken(tokenOptions *TokenOptions, token string) (*Claims, error) {
+
+	session, err := tokenOptions.Sessions.Lookup(token)
+	if err == tokenstore.ErrSessionExpired {
+		return nil, &TokenError{Code: TokenErrExpired, Message: "token is expired"}
+	}
+	if err != nil {
+		return nil, &TokenError{Code: TokenErrUnknownSession, Message: "no such session"}
+	}
+
+	claims := claimsOfSession(session)
+	if err := tokenOptions.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkClaims checks required claims, time claims with leeway, iss and aud of local token
+func (options *TokenOptions) checkClaims(claims *Claims, now time.Time) error {
+
+	// Check required claims are present
+	present := map[string]bool{
+		"iss": claims.Issuer != "",
+		"sub": claims.Subject != "",
+		"aud": claims.Audience != "",
+		"exp": claims.ExpiresAt != 0,
+		"nbf": claims.NotBefore != 0,
+		"iat": claims.IssuedAt != 0,
+		"jti": claims.Id != "",
+	}
+	for _, claim := range options.RequiredClaims {
+		if !present[claim] {
+			return &TokenError{Code: TokenErrMissingClaim, Message: "token has no " + claim}
+		}
+	}
+
+	// Check time claims with leeway
+	leeway := int64(options.Leeway / time.Second)
+	nowUnix := now.Unix()
+	if claims.ExpiresAt != 0 && nowUnix > claims.ExpiresAt+leeway {
+		return &TokenError{Code: TokenErrExpired, Message: "token is expired"}
+	}
+	if claims.NotBefore != 0 && nowUnix+leeway < claims.NotBefore {
+		return &TokenError{Code: TokenErrNotYetValid, Message: "token is not yet valid before sometime"}
+	}
+	if claims.IssuedAt != 0 && nowUnix+leeway < claims.IssuedAt {
+		return &TokenError{Code: TokenErrIssuedInFuture, Message: "token is issued in the future"}
+	}
+
+	// Check iss and aud
+	if claims.Issuer != options.Issuer {
+		return &TokenError{Code: TokenErrInvalidIssuer, Message: "token issuer is not accepted"}
+	}
+	// Without configured audience, aud is the subject of token which carries nothing to validate
+	if options.Audience != "" && claims.Audience != options.Audience {
+		return &TokenError{Code: TokenErrInvalidAudience, Message: "token audience is not accepted"}
+	}
+
+	return nil
+}
+
+// audienceOf returns aud of issued token with subject
+func (options *TokenOptions) audienceOf(subject string) string {
+
+	if options.Audience == "" {
+		return subject
+	}
+
+	return options.Audience
+}
+
+func containsString(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
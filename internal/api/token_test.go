@@ -0,0 +1,274 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+	"github.com/cxweoth/gin-api-server-template/internal/tokenstore"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// loadTestKeySet returns keyset of an active ES256 key "es" and a HS256 key "hs"
+func loadTestKeySet(t *testing.T) *keyset.KeySet {
+
+	dir := t.TempDir()
+
+	file := keyset.KeySetFile{ActiveKid: "es"}
+	for kid, alg := range map[string]string{"es": "ES256", "hs": "HS256"} {
+		entry, err := keyset.GenerateKeyEntry(kid, alg, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Keys = append(file.Keys, entry)
+	}
+
+	filePath := filepath.Join(dir, "keyset.json")
+	if err := utils.WriteJsonFileAtomic(filePath, file); err != nil {
+		t.Fatal(err)
+	}
+
+	keySet, err := keyset.LoadKeySet(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keySet
+}
+
+// signTestToken signs claims with method and key, kid is not set to header if empty
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims Claims) string {
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestParseTokenKeyPinning(t *testing.T) {
+
+	keySet := loadTestKeySet(t)
+	options := &TokenOptions{Issuer: "gin-api-server", Algorithms: []string{"ES256", "HS256"}}
+
+	now := time.Now()
+	claims := Claims{Account: "alice", Role: "User", StandardClaims: jwt.StandardClaims{
+		Issuer: "gin-api-server", Subject: "alice", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(),
+	}}
+
+	esKey := keySet.SigningKey()
+	hsKey, _ := keySet.VerificationKey("hs")
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(esKey.VerifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{"active es256 key", signTestToken(t, jwt.SigningMethodES256, "es", esKey.SignKey, claims), ""},
+		{"trusted hs256 key", signTestToken(t, jwt.SigningMethodHS256, "hs", hsKey.SignKey, claims), ""},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodES256, "missing", esKey.SignKey, claims), TokenErrUnknownKey},
+		{"no kid", signTestToken(t, jwt.SigningMethodES256, "", esKey.SignKey, claims), TokenErrUnknownKey},
+		{"alg not allowed", signTestToken(t, jwt.SigningMethodHS512, "hs", hsKey.SignKey, claims), TokenErrAlgorithmNotAllowed},
+		{"alg none", signTestToken(t, jwt.SigningMethodNone, "es", jwt.UnsafeAllowNoneSignatureType, claims), TokenErrAlgorithmNotAllowed},
+		{"alg of another key", signTestToken(t, jwt.SigningMethodHS256, "es", hsKey.SignKey, claims), TokenErrAlgorithmNotAllowed},
+		{"hmac with public key as secret", signTestToken(t, jwt.SigningMethodHS256, "es", publicKeyDER, claims), TokenErrAlgorithmNotAllowed},
+		{"signed by untrusted key", signTestToken(t, jwt.SigningMethodES256, "es", otherKey, claims), TokenErrSignatureInvalid},
+		{"malformed", "not.a.token", TokenErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseToken(keySet, options, tt.token)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("ParseToken() error = %v", err)
+				}
+				if got.Account != "alice" {
+					t.Errorf("ParseToken() account = %s, want alice", got.Account)
+				}
+				return
+			}
+
+			if err == nil || tokenErrorCode(err) != tt.wantCode {
+				t.Errorf("ParseToken() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenKid(t *testing.T) {
+
+	keySet := loadTestKeySet(t)
+	options := &TokenOptions{Issuer: "gin-api-server", Algorithms: []string{"ES256", "HS256"}}
+
+	token, err := GenerateToken(keySet, options, Claims{Account: "alice", Role: "User"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token is signed by active key, and kid is set so the key is found in validation
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "es" || parsed.Method.Alg() != "ES256" {
+		t.Errorf("GenerateToken() header = %v, want kid es of ES256", parsed.Header)
+	}
+
+	claims, err := ParseToken(keySet, options, token)
+	if err != nil {
+		t.Fatalf("ParseToken() of generated token error = %v", err)
+	}
+	if claims.Account != "alice" || claims.Subject != "alice" || claims.Id == "" {
+		t.Errorf("ParseToken() claims = %+v, want claims of alice with jti", claims)
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+
+	valid := func(change func(claims *Claims)) *Claims {
+		claims := &Claims{StandardClaims: jwt.StandardClaims{
+			Issuer: "gin-api-server", Subject: "alice", Audience: "api", Id: "jti",
+			IssuedAt: now.Unix(), NotBefore: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(),
+		}}
+		if change != nil {
+			change(claims)
+		}
+		return claims
+	}
+
+	options := &TokenOptions{Issuer: "gin-api-server", Audience: "api", Leeway: 30 * time.Second, RequiredClaims: []string{"exp", "jti"}}
+	noAudience := &TokenOptions{Issuer: "gin-api-server"}
+
+	tests := []struct {
+		name     string
+		options  *TokenOptions
+		claims   *Claims
+		wantCode string
+	}{
+		{"valid", options, valid(nil), ""},
+		{"missing required exp", options, valid(func(c *Claims) { c.ExpiresAt = 0 }), TokenErrMissingClaim},
+		{"missing required jti", options, valid(func(c *Claims) { c.Id = "" }), TokenErrMissingClaim},
+		{"expired within leeway", options, valid(func(c *Claims) { c.ExpiresAt = now.Add(-20 * time.Second).Unix() }), ""},
+		{"expired", options, valid(func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }), TokenErrExpired},
+		{"not yet valid", options, valid(func(c *Claims) { c.NotBefore = now.Add(time.Minute).Unix() }), TokenErrNotYetValid},
+		{"issued in the future", options, valid(func(c *Claims) { c.IssuedAt = now.Add(time.Minute).Unix() }), TokenErrIssuedInFuture},
+		{"other issuer", options, valid(func(c *Claims) { c.Issuer = "other" }), TokenErrInvalidIssuer},
+		{"other audience", options, valid(func(c *Claims) { c.Audience = "other" }), TokenErrInvalidAudience},
+		{"aud not checked without configured audience", noAudience, valid(func(c *Claims) { c.Audience = "alice" }), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.checkClaims(tt.claims, now)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("checkClaims() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || tokenErrorCode(err) != tt.wantCode {
+				t.Errorf("checkClaims() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestOpaqueToken(t *testing.T) {
+
+	for _, backend := range []string{"memory", "file"} {
+		t.Run(backend, func(t *testing.T) {
+			overrides := testConfig{"TOKEN": {"Format": "opaque", "Session_Backend": backend}}
+			ts := newTestServer(t, overrides)
+
+			// Login returns reference token instead of jwt, handlers are the same
+			loginSucceed := ts.login("web", "alice")
+			if !tokenstore.IsSessionToken(loginSucceed.Token) || strings.Contains(loginSucceed.Token, ".") {
+				t.Fatalf("login token = %q, want opaque session token", loginSucceed.Token)
+			}
+
+			var meSucceed MeSucceed
+			decodeBody(t, ts.call(http.MethodGet, "/api/v1/me", "", loginSucceed.Token, nil), &meSucceed)
+			if meSucceed.Account != "alice" || meSucceed.Role != "Member" || meSucceed.ExpiresAt.IsZero() {
+				t.Errorf("me with opaque token = %+v, want alice of role Member", meSucceed)
+			}
+
+			// Unknown session is rejected with its own code
+			w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", tokenstore.SessionTokenPrefix+"unknown", nil)
+			var authFailedResp AuthFailedResp
+			decodeBody(t, w, &authFailedResp)
+			if w.Code != http.StatusUnauthorized || authFailedResp.Code != TokenErrUnknownSession {
+				t.Errorf("unknown session status = %d, code = %q, want %d with %q", w.Code, authFailedResp.Code, http.StatusUnauthorized, TokenErrUnknownSession)
+			}
+
+			// Refreshed token is opaque too
+			w = ts.call(http.MethodPost, "/api/v1/token/refresh", "web", "", RefreshReceiveBody{RefreshToken: loginSucceed.RefreshToken})
+			if w.Code != http.StatusOK {
+				t.Fatalf("refresh status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var refreshed LoginSucceed
+			decodeBody(t, w, &refreshed)
+			if !tokenstore.IsSessionToken(refreshed.Token) {
+				t.Errorf("refreshed token = %q, want opaque session token", refreshed.Token)
+			}
+
+			// Logout removes session at once
+			if w := ts.call(http.MethodPost, "/api/v1/logout", "", refreshed.Token, LogoutReceiveBody{}); w.Code != http.StatusOK {
+				t.Fatalf("logout status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", refreshed.Token, nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("token after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+
+			// Revocation of account removes its sessions
+			kept := ts.login("web", "alice").Token
+			if w := ts.call(http.MethodPost, "/api/v1/admin/tokens/revoke", "", ts.login("web", "admin").Token, RevokeTokensReceiveBody{Account: "alice"}); w.Code != http.StatusOK {
+				t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", kept, nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("token after revocation of account status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+
+			if backend != "file" {
+				return
+			}
+
+			// Sessions of file backend are kept after restart
+			restarted := ts.login("web", "alice").Token
+			ts.start(overrides)
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", restarted, nil); w.Code != http.StatusOK {
+				t.Errorf("token after restart status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if w := ts.call(http.MethodGet, "/api/v1/getServiceInfo", "", kept, nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("revoked token after restart status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
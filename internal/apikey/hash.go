@@ -0,0 +1,149 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// Prefix of API keys which carry key id, format: ak_<key id>.<secret>
+const keyPrefix = "ak_"
+
+// Prefix of key id of plaintext keys migrated from old format, which carry no key id
+const legacyKeyIDPrefix = "legacy_"
+
+// Digest algorithms of API key hash
+const (
+	DigestSHA256     = "sha256"
+	DigestHMACSHA256 = "hmac-sha256"
+)
+
+// KeyID returns key id of raw API key.
+// Key id of ak_<key id>.<secret> is the part in key, otherwise it is derived from sha256 of key.
+func KeyID(apiKey string) string {
+
+	if strings.HasPrefix(apiKey, keyPrefix) {
+		if dot := strings.Index(apiKey, "."); dot > len(keyPrefix) {
+			return apiKey[len(keyPrefix):dot]
+		}
+	}
+
+	sum := sha256.Sum256([]byte(apiKey))
+	return legacyKeyIDPrefix + hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey returns a new raw API key and its key id
+func GenerateKey() (string, string, error) {
+
+	keyIDBytes := utils.GenerateRandomBytes(8)
+	secretBytes := utils.GenerateRandomBytes(32)
+	if keyIDBytes == nil || secretBytes == nil {
+		return "", "", errors.New("generate random bytes failed")
+	}
+
+	keyID := hex.EncodeToString(keyIDBytes)
+	apiKey := keyPrefix + keyID + "." + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	return apiKey, keyID, nil
+}
+
+// HashKey returns hash of raw API key in format <digest>:<hex>.
+// hmac-sha256 is used when hmacKey given, otherwise sha256.
+func HashKey(apiKey string, hmacKey []byte) string {
+
+	if len(hmacKey) > 0 {
+		return DigestHMACSHA256 + ":" + hex.EncodeToString(digest(DigestHMACSHA256, apiKey, hmacKey))
+	}
+
+	return DigestSHA256 + ":" + hex.EncodeToString(digest(DigestSHA256, apiKey, nil))
+}
+
+// VerifyKey checks raw API key with hash in constant time
+func VerifyKey(apiKey, hash string, hmacKey []byte) bool {
+
+	parts := strings.SplitN(hash, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	if parts[0] == DigestHMACSHA256 && len(hmacKey) == 0 {
+		return false
+	}
+
+	actual := digest(parts[0], apiKey, hmacKey)
+	if actual == nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(expected, actual) == 1
+}
+
+func digest(algorithm, apiKey string, hmacKey []byte) []byte {
+
+	switch algorithm {
+	case DigestSHA256:
+		sum := sha256.Sum256([]byte(apiKey))
+		return sum[:]
+	case DigestHMACSHA256:
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write([]byte(apiKey))
+		return mac.Sum(nil)
+	default:
+		return nil
+	}
+}
+
+// HMAC keys which were published with this repository, anyone can compute hashes and signing secrets with them
+var publishedHMACKeys = []string{"wPS3WMqeev3DBiJNEWdeq/FJUgoWNHaayID2wHNG4kw="}
+
+// Size of HMAC keys made by GenerateHMACKey
+const hmacKeySize = 32
+
+// GenerateHMACKey returns a new base64 encoded HMAC key
+func GenerateHMACKey() (string, error) {
+
+	randomBytes := utils.GenerateRandomBytes(hmacKeySize)
+	if randomBytes == nil {
+		return "", errors.New("generate random bytes failed")
+	}
+
+	return base64.StdEncoding.EncodeToString(randomBytes), nil
+}
+
+// ReadHMACKeyFile reads base64 encoded HMAC key from file
+func ReadHMACKeyFile(filePath string) ([]byte, error) {
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read API key HMAC key file failed: " + err.Error())
+	}
+
+	encodedKey := strings.TrimSpace(string(byteValue))
+	for _, publishedKey := range publishedHMACKeys {
+		if encodedKey == publishedKey {
+			return nil, errors.New("API key HMAC key was published with this repository, generate your own with apikey-tool hmac-key")
+		}
+	}
+
+	hmacKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.New("API key HMAC key is not base64 encoded")
+	}
+	if len(hmacKey) < hmacKeySize {
+		return nil, errors.New("API key HMAC key should be at least 32 bytes")
+	}
+
+	return hmacKey, nil
+}
@@ -0,0 +1,165 @@
+package apikey
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyID(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		apiKey string
+		want   string
+	}{
+		{"key with key id", "ak_0123456789abcdef.secret", "0123456789abcdef"},
+		{"legacy key", "secretApiKey", "legacy_85e7fe9826e6b7c3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KeyID(tt.apiKey); got != tt.want {
+				t.Errorf("KeyID(%q) = %s, want %s", tt.apiKey, got, tt.want)
+			}
+		})
+	}
+
+	// Malformed keys with prefix get a legacy key id, never an empty one
+	for _, apiKey := range []string{"ak_0123456789abcdef", "ak_.secret"} {
+		if got := KeyID(apiKey); !strings.HasPrefix(got, legacyKeyIDPrefix) {
+			t.Errorf("KeyID(%q) = %s, want legacy key id", apiKey, got)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+
+	apiKey, keyID, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(apiKey, keyPrefix+keyID+".") || len(keyID) != 16 {
+		t.Errorf("GenerateKey() = %s, %s, want ak_<16 hex key id>.<secret>", apiKey, keyID)
+	}
+	if KeyID(apiKey) != keyID {
+		t.Errorf("KeyID() of generated key = %s, want %s", KeyID(apiKey), keyID)
+	}
+
+	otherKey, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherKey == apiKey {
+		t.Error("GenerateKey() returned the same key twice")
+	}
+}
+
+func TestVerifyKey(t *testing.T) {
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	otherHMACKey := []byte("fedcba9876543210fedcba9876543210")
+
+	sha256Hash := HashKey("secretApiKey", nil)
+	hmacHash := HashKey("secretApiKey", hmacKey)
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		hash    string
+		hmacKey []byte
+		want    bool
+	}{
+		{"sha256", "secretApiKey", sha256Hash, nil, true},
+		{"sha256 ignores hmac key", "secretApiKey", sha256Hash, hmacKey, true},
+		{"sha256 wrong key", "otherApiKey", sha256Hash, nil, false},
+		{"hmac-sha256", "secretApiKey", hmacHash, hmacKey, true},
+		{"hmac-sha256 wrong key", "otherApiKey", hmacHash, hmacKey, false},
+		{"hmac-sha256 other hmac key", "secretApiKey", hmacHash, otherHMACKey, false},
+		{"hmac-sha256 without hmac key", "secretApiKey", hmacHash, nil, false},
+		{"unknown digest", "secretApiKey", "md5:" + strings.SplitN(sha256Hash, ":", 2)[1], nil, false},
+		{"no digest", "secretApiKey", strings.SplitN(sha256Hash, ":", 2)[1], nil, false},
+		{"not hex", "secretApiKey", "sha256:xyz", nil, false},
+		{"truncated hash", "secretApiKey", sha256Hash[:20], nil, false},
+		{"empty hash", "secretApiKey", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyKey(tt.apiKey, tt.hash, tt.hmacKey); got != tt.want {
+				t.Errorf("VerifyKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !strings.HasPrefix(sha256Hash, DigestSHA256+":") || !strings.HasPrefix(hmacHash, DigestHMACSHA256+":") {
+		t.Errorf("HashKey() = %s, %s, want digest prefixes", sha256Hash, hmacHash)
+	}
+}
+
+func TestReadHMACKeyFile(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"32 bytes", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")), false},
+		{"trailing newline", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")) + "\n", false},
+		{"short key", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), true},
+		{"not base64", "not base64!", true},
+		{"published key", publishedHMACKeys[0], true},
+		{"published key with trailing newline", publishedHMACKeys[0] + "\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(dir, "hmac.key")
+			if err := ioutil.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := ReadHMACKeyFile(filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadHMACKeyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ReadHMACKeyFile(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("ReadHMACKeyFile() of missing file error = nil, want error")
+	}
+}
+
+func TestGenerateHMACKey(t *testing.T) {
+
+	first, err := GenerateHMACKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateHMACKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("GenerateHMACKey() returned the same key twice")
+	}
+
+	// Generated key is accepted by ReadHMACKeyFile
+	filePath := filepath.Join(t.TempDir(), "hmac.key")
+	if err := ioutil.WriteFile(filePath, []byte(first+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hmacKey, err := ReadHMACKeyFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadHMACKeyFile() of generated key error = %v", err)
+	}
+	if len(hmacKey) != hmacKeySize {
+		t.Errorf("generated key length = %d, want %d", len(hmacKey), hmacKeySize)
+	}
+}
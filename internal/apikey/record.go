@@ -0,0 +1,181 @@
+package apikey
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ErrKeyDisabled      = errors.New("API key is disabled")
+	ErrKeyNotYetValid   = errors.New("API key is not yet valid")
+	ErrKeyExpired       = errors.New("API key is expired")
+	ErrSourceNotAllowed = errors.New("source IP is not allowed for API key")
+	ErrRouteNotAllowed  = errors.New("route is not allowed for API key")
+	ErrScopeNotAllowed  = errors.New("scope is not allowed for API key")
+)
+
+// Record of API key in API key file, the raw key is never stored.
+// Empty Scopes, Routes or AllowedCIDRs means no restriction.
+type Record struct {
+	Client         string     `json:"client"`
+	Tenant         string     `json:"tenant,omitempty"` // tenant of client, empty: no tenant
+	Hash           string     `json:"hash"`
+	Scopes         []string   `json:"scopes,omitempty"`          // scope names, e.g. "login"
+	Routes         []string   `json:"routes,omitempty"`          // route patterns, e.g. "POST /api/v1/login", "/api/v1/*"
+	NotBefore      *time.Time `json:"not_before,omitempty"`      // RFC 3339
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`      // RFC 3339
+	AllowedCIDRs   []string   `json:"allowed_cidrs,omitempty"`   // e.g. "10.0.0.0/8"
+	RequireSigning bool       `json:"require_signing,omitempty"` // only signed requests are accepted, needs API key HMAC key
+	Disabled       bool       `json:"disabled,omitempty"`
+}
+
+// Validate checks fields of record
+func (r Record) Validate() error {
+
+	if r.Client == "" || r.Hash == "" {
+		return errors.New("no client or hash")
+	}
+
+	return r.ValidateRestrictions()
+}
+
+// ValidateRestrictions checks restrictions of record, i.e. allowed cidrs, routes and validity period
+func (r Record) ValidateRestrictions() error {
+
+	for _, cidr := range r.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.New("allowed cidr " + cidr + " is malformed")
+		}
+	}
+
+	for _, route := range r.Routes {
+		if _, _, err := parseRoute(route); err != nil {
+			return err
+		}
+	}
+
+	if r.NotBefore != nil && r.ExpiresAt != nil && !r.NotBefore.Before(*r.ExpiresAt) {
+		return errors.New("not before should be before expires at")
+	}
+
+	return nil
+}
+
+// Check checks whether API key can be used now, from source IP, on method and path
+func (r Record) Check(now time.Time, sourceIP, method, path string) error {
+
+	if err := r.CheckUsable(now, sourceIP); err != nil {
+		return err
+	}
+
+	if !r.allowRoute(method, path) {
+		return ErrRouteNotAllowed
+	}
+
+	return nil
+}
+
+// CheckUsable checks whether API key can be used now and from source IP, route restrictions are not checked
+func (r Record) CheckUsable(now time.Time, sourceIP string) error {
+
+	if r.Disabled {
+		return ErrKeyDisabled
+	}
+
+	if r.NotBefore != nil && now.Before(*r.NotBefore) {
+		return ErrKeyNotYetValid
+	}
+
+	if r.ExpiresAt != nil && !now.Before(*r.ExpiresAt) {
+		return ErrKeyExpired
+	}
+
+	if !r.allowSource(sourceIP) {
+		return ErrSourceNotAllowed
+	}
+
+	return nil
+}
+
+// HasScope checks whether API key has scope
+func (r Record) HasScope(scope string) bool {
+
+	if len(r.Scopes) == 0 {
+		return true
+	}
+
+	for _, allowedScope := range r.Scopes {
+		if allowedScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Record) allowSource(sourceIP string) bool {
+
+	if len(r.AllowedCIDRs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(sourceIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range r.AllowedCIDRs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Record) allowRoute(method, path string) bool {
+
+	if len(r.Routes) == 0 {
+		return true
+	}
+
+	for _, route := range r.Routes {
+		routeMethod, routePath, err := parseRoute(route)
+		if err != nil {
+			continue
+		}
+		if routeMethod != "" && routeMethod != method {
+			continue
+		}
+		if strings.HasSuffix(routePath, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(routePath, "*")) {
+				return true
+			}
+		} else if routePath == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRoute parses route pattern "[METHOD ]/path", path can end with * to match prefix
+func parseRoute(route string) (string, string, error) {
+
+	fields := strings.Fields(route)
+
+	switch len(fields) {
+	case 1:
+		if strings.HasPrefix(fields[0], "/") {
+			return "", fields[0], nil
+		}
+	case 2:
+		if strings.HasPrefix(fields[1], "/") {
+			return strings.ToUpper(fields[0]), fields[1], nil
+		}
+	}
+
+	return "", "", errors.New("route " + route + " is malformed")
+}
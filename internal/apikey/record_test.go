@@ -0,0 +1,117 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordCheck(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		record   Record
+		sourceIP string
+		method   string
+		path     string
+		want     error
+	}{
+		{"no restrictions", Record{}, "192.0.2.1", "GET", "/api/v1/me", nil},
+		{"disabled", Record{Disabled: true}, "192.0.2.1", "GET", "/api/v1/me", ErrKeyDisabled},
+		{"not yet valid", Record{NotBefore: &future}, "192.0.2.1", "GET", "/api/v1/me", ErrKeyNotYetValid},
+		{"valid from now", Record{NotBefore: &now}, "192.0.2.1", "GET", "/api/v1/me", nil},
+		{"expired", Record{ExpiresAt: &past}, "192.0.2.1", "GET", "/api/v1/me", ErrKeyExpired},
+		{"expires now", Record{ExpiresAt: &now}, "192.0.2.1", "GET", "/api/v1/me", ErrKeyExpired},
+		{"within validity", Record{NotBefore: &past, ExpiresAt: &future}, "192.0.2.1", "GET", "/api/v1/me", nil},
+		{"source in cidr", Record{AllowedCIDRs: []string{"192.0.2.0/24"}}, "192.0.2.1", "GET", "/api/v1/me", nil},
+		{"source in second cidr", Record{AllowedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}}, "2001:db8::1", "GET", "/api/v1/me", nil},
+		{"source not in cidr", Record{AllowedCIDRs: []string{"192.0.2.0/24"}}, "198.51.100.1", "GET", "/api/v1/me", ErrSourceNotAllowed},
+		{"source not an ip", Record{AllowedCIDRs: []string{"192.0.2.0/24"}}, "localhost", "GET", "/api/v1/me", ErrSourceNotAllowed},
+		{"route with method", Record{Routes: []string{"POST /api/v1/login"}}, "192.0.2.1", "POST", "/api/v1/login", nil},
+		{"route method is case insensitive", Record{Routes: []string{"post /api/v1/login"}}, "192.0.2.1", "POST", "/api/v1/login", nil},
+		{"route of other method", Record{Routes: []string{"POST /api/v1/login"}}, "192.0.2.1", "GET", "/api/v1/login", ErrRouteNotAllowed},
+		{"route of any method", Record{Routes: []string{"/api/v1/login"}}, "192.0.2.1", "GET", "/api/v1/login", nil},
+		{"route prefix", Record{Routes: []string{"/api/v1/accounts/*"}}, "192.0.2.1", "POST", "/api/v1/accounts/register", nil},
+		{"route prefix does not match parent", Record{Routes: []string{"/api/v1/accounts/*"}}, "192.0.2.1", "POST", "/api/v1/accounts", ErrRouteNotAllowed},
+		{"route is exact without star", Record{Routes: []string{"/api/v1/login"}}, "192.0.2.1", "POST", "/api/v1/login/mfa", ErrRouteNotAllowed},
+		{"malformed route is skipped", Record{Routes: []string{"login", "POST /api/v1/login"}}, "192.0.2.1", "POST", "/api/v1/login", nil},
+		{"disabled before route", Record{Disabled: true, Routes: []string{"/api/v1/login"}}, "192.0.2.1", "GET", "/api/v1/me", ErrKeyDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.record.Check(now, tt.sourceIP, tt.method, tt.path); err != tt.want {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordCheckUsableIgnoresRoutes(t *testing.T) {
+
+	record := Record{Routes: []string{"POST /api/v1/login"}, AllowedCIDRs: []string{"192.0.2.0/24"}}
+	now := time.Unix(1600000000, 0)
+
+	if err := record.CheckUsable(now, "192.0.2.1"); err != nil {
+		t.Errorf("CheckUsable() error = %v, want nil", err)
+	}
+	if err := record.CheckUsable(now, "198.51.100.1"); err != ErrSourceNotAllowed {
+		t.Errorf("CheckUsable() error = %v, want %v", err, ErrSourceNotAllowed)
+	}
+}
+
+func TestRecordHasScope(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{"no scopes allow all", nil, "login", true},
+		{"listed scope", []string{"login", "token"}, "token", true},
+		{"unlisted scope", []string{"login"}, "token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Record{Scopes: tt.scopes}).HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordValidate(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		record  Record
+		wantErr bool
+	}{
+		{"client and hash", Record{Client: "User1", Hash: "sha256:00"}, false},
+		{"no client", Record{Hash: "sha256:00"}, true},
+		{"no hash", Record{Client: "User1"}, true},
+		{"valid restrictions", Record{Client: "User1", Hash: "sha256:00", AllowedCIDRs: []string{"10.0.0.0/8"}, Routes: []string{"GET /api/v1/*"}, NotBefore: &now, ExpiresAt: &later}, false},
+		{"malformed cidr", Record{Client: "User1", Hash: "sha256:00", AllowedCIDRs: []string{"10.0.0.0"}}, true},
+		{"malformed route", Record{Client: "User1", Hash: "sha256:00", Routes: []string{"GET api/v1/me"}}, true},
+		{"route with too many fields", Record{Client: "User1", Hash: "sha256:00", Routes: []string{"GET /api/v1/me now"}}, true},
+		{"not before after expires at", Record{Client: "User1", Hash: "sha256:00", NotBefore: &later, ExpiresAt: &now}, true},
+		{"not before equals expires at", Record{Client: "User1", Hash: "sha256:00", NotBefore: &now, ExpiresAt: &now}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.record.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of signed request, which carries key id instead of API key
+const (
+	HeaderKeyID     = "X-API-Key-ID"
+	HeaderTimestamp = "X-Timestamp" // unix seconds
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature" // base64 HMAC-SHA256 of string to sign with signing secret
+)
+
+var (
+	ErrSigningRequired      = errors.New("request signing is required for API key")
+	ErrSigningNotSupported  = errors.New("request signing needs API key HMAC key")
+	ErrSignatureInvalid     = errors.New("request signature is invalid")
+	ErrTimestampOutOfWindow = errors.New("request timestamp is out of allowed clock skew")
+	ErrNonceMalformed       = errors.New("request nonce should be 16 to 128 characters of [A-Za-z0-9_-]")
+	ErrNonceReused          = errors.New("request nonce is already used")
+)
+
+var nonceFormat = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+// DeriveSigningSecret returns signing secret of API key, base64url of HMAC-SHA256(hmacKey, "request-signing:" + key id + ":" + key hash).
+// Secret is bound to hash of the key, so it changes when the key is replaced, and it can not be derived from key id and HMAC key alone.
+// Secrets are never stored, they are derived again with the HMAC key when requests are verified.
+func DeriveSigningSecret(hmacKey []byte, keyID, keyHash string) string {
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte("request-signing:" + keyID + ":" + keyHash))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// StringToSign returns the string signed by client:
+// METHOD \n request URI with query \n hex sha256 of body \n timestamp \n nonce
+func StringToSign(method, requestURI string, body []byte, timestamp, nonce string) string {
+
+	bodySum := sha256.Sum256(body)
+
+	return method + "\n" + requestURI + "\n" + hex.EncodeToString(bodySum[:]) + "\n" + timestamp + "\n" + nonce
+}
+
+// Sign returns base64 HMAC-SHA256 of string to sign with signing secret
+func Sign(signingSecret, stringToSign string) string {
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(stringToSign))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature in constant time
+func VerifySignature(signingSecret, stringToSign, signature string) bool {
+
+	expected := Sign(signingSecret, stringToSign)
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// CheckTimestamp checks unix seconds timestamp is within maxSkew of now, and returns it
+func CheckTimestamp(timestamp string, now time.Time, maxSkew time.Duration) (time.Time, error) {
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrTimestampOutOfWindow
+	}
+
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-maxSkew)) || signedAt.After(now.Add(maxSkew)) {
+		return time.Time{}, ErrTimestampOutOfWindow
+	}
+
+	return signedAt, nil
+}
+
+// CheckNonceFormat checks nonce is long enough to be unique
+func CheckNonceFormat(nonce string) error {
+
+	if !nonceFormat.MatchString(nonce) {
+		return ErrNonceMalformed
+	}
+
+	return nil
+}
+
+// NonceStore remembers used nonces of key ids until they expire, so it can be shared between servers later
+type NonceStore interface {
+	// Use records nonce of key id, and returns false if nonce is already used
+	Use(keyID, nonce string, expiresAt time.Time) bool
+}
+
+// MemoryNonceStore keeps used nonces in memory
+type MemoryNonceStore struct {
+	mu         sync.Mutex
+	nonces     map[string]time.Time
+	lastPurged time.Time
+}
+
+// NewMemoryNonceStore returns empty nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+// Use records nonce of key id until expiresAt
+func (s *MemoryNonceStore) Use(keyID, nonce string, expiresAt time.Time) bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purgeLocked(now)
+
+	key := keyID + ":" + nonce
+	if usedUntil, ok := s.nonces[key]; ok && now.Before(usedUntil) {
+		return false
+	}
+
+	s.nonces[key] = expiresAt
+
+	return true
+}
+
+// purgeLocked removes expired nonces, at most once per minute
+func (s *MemoryNonceStore) purgeLocked(now time.Time) {
+
+	if now.Sub(s.lastPurged) < time.Minute {
+		return
+	}
+	s.lastPurged = now
+
+	for key, expiresAt := range s.nonces {
+		if !now.Before(expiresAt) {
+			delete(s.nonces, key)
+		}
+	}
+}
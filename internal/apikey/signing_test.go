@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	secret := DeriveSigningSecret(hmacKey, "0123456789abcdef", HashKey("ak_0123456789abcdef.secret", hmacKey))
+
+	body := []byte(`{"Account":"alice"}`)
+	stringToSign := StringToSign("POST", "/api/v1/login?x=1", body, "1600000000", "nonce-0123456789abcdef")
+	signature := Sign(secret, stringToSign)
+
+	tests := []struct {
+		name         string
+		secret       string
+		stringToSign string
+		signature    string
+		want         bool
+	}{
+		{"valid", secret, stringToSign, signature, true},
+		{"other method", secret, StringToSign("PUT", "/api/v1/login?x=1", body, "1600000000", "nonce-0123456789abcdef"), signature, false},
+		{"other query", secret, StringToSign("POST", "/api/v1/login?x=2", body, "1600000000", "nonce-0123456789abcdef"), signature, false},
+		{"other body", secret, StringToSign("POST", "/api/v1/login?x=1", []byte(`{"Account":"bob"}`), "1600000000", "nonce-0123456789abcdef"), signature, false},
+		{"other timestamp", secret, StringToSign("POST", "/api/v1/login?x=1", body, "1600000001", "nonce-0123456789abcdef"), signature, false},
+		{"other nonce", secret, StringToSign("POST", "/api/v1/login?x=1", body, "1600000000", "nonce-0123456789abcdeg"), signature, false},
+		{"other secret", DeriveSigningSecret(hmacKey, "0123456789abcdef", HashKey("ak_0123456789abcdef.other", hmacKey)), stringToSign, signature, false},
+		{"empty signature", secret, stringToSign, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySignature(tt.secret, tt.stringToSign, tt.signature); got != tt.want {
+				t.Errorf("VerifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveSigningSecret(t *testing.T) {
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	secret := DeriveSigningSecret(hmacKey, "key-1", "sha256:00")
+
+	tests := []struct {
+		name    string
+		hmacKey []byte
+		keyID   string
+		keyHash string
+	}{
+		{"other hmac key", []byte("fedcba9876543210fedcba9876543210"), "key-1", "sha256:00"},
+		{"other key id", hmacKey, "key-2", "sha256:00"},
+		{"other key hash", hmacKey, "key-1", "sha256:01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if DeriveSigningSecret(tt.hmacKey, tt.keyID, tt.keyHash) == secret {
+				t.Error("DeriveSigningSecret() returned the same secret")
+			}
+		})
+	}
+
+	if DeriveSigningSecret(hmacKey, "key-1", "sha256:00") != secret {
+		t.Error("DeriveSigningSecret() is not deterministic")
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+	maxSkew := 5 * time.Minute
+
+	tests := []struct {
+		name      string
+		timestamp string
+		wantErr   error
+	}{
+		{"now", strconv.FormatInt(now.Unix(), 10), nil},
+		{"oldest in window", strconv.FormatInt(now.Add(-maxSkew).Unix(), 10), nil},
+		{"latest in window", strconv.FormatInt(now.Add(maxSkew).Unix(), 10), nil},
+		{"too old", strconv.FormatInt(now.Add(-maxSkew-time.Second).Unix(), 10), ErrTimestampOutOfWindow},
+		{"too new", strconv.FormatInt(now.Add(maxSkew+time.Second).Unix(), 10), ErrTimestampOutOfWindow},
+		{"milliseconds", strconv.FormatInt(now.Unix()*1000, 10), ErrTimestampOutOfWindow},
+		{"not a number", "yesterday", ErrTimestampOutOfWindow},
+		{"empty", "", ErrTimestampOutOfWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckTimestamp(tt.timestamp, now, maxSkew)
+			if err != tt.wantErr {
+				t.Errorf("CheckTimestamp() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckNonceFormat(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		nonce   string
+		wantErr error
+	}{
+		{"16 characters", "0123456789abcdef", nil},
+		{"url-safe base64", "Ab-_0123456789abcdef", nil},
+		{"128 characters", strings.Repeat("a", 128), nil},
+		{"15 characters", "0123456789abcde", ErrNonceMalformed},
+		{"129 characters", strings.Repeat("a", 129), ErrNonceMalformed},
+		{"padding", "0123456789abcdef==", ErrNonceMalformed},
+		{"newline", "0123456789abcdef\n", ErrNonceMalformed},
+		{"empty", "", ErrNonceMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckNonceFormat(tt.nonce); err != tt.wantErr {
+				t.Errorf("CheckNonceFormat() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryNonceStoreReplay(t *testing.T) {
+
+	store := NewMemoryNonceStore()
+	expiresAt := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		keyID     string
+		nonce     string
+		expiresAt time.Time
+		want      bool
+	}{
+		{"first use", "key-1", "nonce-0123456789abcdef", expiresAt, true},
+		{"replay", "key-1", "nonce-0123456789abcdef", expiresAt, false},
+		{"same nonce of another key", "key-2", "nonce-0123456789abcdef", expiresAt, true},
+		{"another nonce", "key-1", "nonce-fedcba9876543210", expiresAt, true},
+		{"nonce expired at first use", "key-1", "nonce-expired-0123456", time.Now().Add(-time.Second), true},
+		{"expired nonce can be used again", "key-1", "nonce-expired-0123456", expiresAt, true},
+		{"replay after reuse", "key-1", "nonce-expired-0123456", expiresAt, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Use(tt.keyID, tt.nonce, tt.expiresAt); got != tt.want {
+				t.Errorf("Use(%q, %q) = %v, want %v", tt.keyID, tt.nonce, got, tt.want)
+			}
+		})
+	}
+}
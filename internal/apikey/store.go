@@ -0,0 +1,332 @@
+package apikey
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	// ErrKeyNotFound is returned when key id not in store
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrPlaintextKeyFile is returned when keys are changed while API key file is plaintext format,
+	// the file is only converted by apikey-tool migrate, never as side effect of a change
+	ErrPlaintextKeyFile = errors.New("API key file is plaintext format, migrate it with apikey-tool migrate before changing keys")
+	// ErrRotateDisabledKey is returned when revoked key is rotated, a new key of its client should be created instead
+	ErrRotateDisabledKey = errors.New("API key is disabled and can not be rotated, create a new key instead")
+)
+
+// API key file format, records are keyed by key id
+type KeyFile struct {
+	Keys map[string]Record `json:"keys"`
+}
+
+// Loaded keys
+type keySet struct {
+	records   map[string]Record
+	plaintext bool
+}
+
+// Store keeps API keys in memory, keys are swapped atomically when file reloaded
+type Store struct {
+	filePath string
+	hmacKey  []byte
+	keys     atomic.Value // *keySet
+	updateMu sync.Mutex   // serializes updates written to file
+}
+
+// NewStore loads API key file and returns store, loading must succeed at start.
+// hmacKey is needed to verify hmac-sha256 hashes.
+func NewStore(filePath string, hmacKey []byte) (*Store, error) {
+
+	store := &Store{filePath: filePath, hmacKey: hmacKey}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Lookup returns key id and record of API key, the key is found by key id and compared in constant time.
+// Restrictions of record are not checked, use Record.Check.
+func (s *Store) Lookup(apiKey string) (string, Record, bool) {
+
+	keys := s.keys.Load().(*keySet)
+
+	keyID := KeyID(apiKey)
+	record, ok := keys.records[keyID]
+	if !ok {
+		return "", Record{}, false
+	}
+
+	if !VerifyKey(apiKey, record.Hash, s.hmacKey) {
+		return "", Record{}, false
+	}
+
+	return keyID, record, true
+}
+
+// LookupID returns record of key id, which is used by signed requests without API key
+func (s *Store) LookupID(keyID string) (Record, bool) {
+
+	keys := s.keys.Load().(*keySet)
+	record, ok := keys.records[keyID]
+
+	return record, ok
+}
+
+// SigningSecret returns request signing secret of key id, it needs HMAC key
+func (s *Store) SigningSecret(keyID string) (string, error) {
+
+	if len(s.hmacKey) == 0 {
+		return "", ErrSigningNotSupported
+	}
+
+	record, ok := s.LookupID(keyID)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+
+	return DeriveSigningSecret(s.hmacKey, keyID, record.Hash), nil
+}
+
+// IsPlaintext checks whether loaded API key file is the old plaintext format
+func (s *Store) IsPlaintext() bool {
+	return s.keys.Load().(*keySet).plaintext
+}
+
+// Reload reads API key file and swaps in new keys.
+// If file is malformed, the last good keys are kept and error is returned.
+func (s *Store) Reload() error {
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	keys, err := readKeyFile(s.filePath, s.hmacKey)
+	if err != nil {
+		return err
+	}
+
+	s.keys.Store(keys)
+
+	return nil
+}
+
+// List returns copy of all records by key id
+func (s *Store) List() map[string]Record {
+
+	keys := s.keys.Load().(*keySet)
+
+	records := map[string]Record{}
+	for keyID, record := range keys.records {
+		records[keyID] = record
+	}
+
+	return records
+}
+
+// Create generates a new API key with metadata of record, and returns raw key once
+func (s *Store) Create(record Record) (string, string, error) {
+
+	var apiKey, keyID string
+
+	err := s.update(func(records map[string]Record) error {
+
+		var err error
+		apiKey, keyID, err = GenerateKey()
+		if err != nil {
+			return err
+		}
+
+		record.Hash = HashKey(apiKey, s.hmacKey)
+		if err := record.Validate(); err != nil {
+			return err
+		}
+		records[keyID] = record
+
+		return nil
+	})
+
+	return apiKey, keyID, err
+}
+
+// Rotate generates a new API key with same metadata of key id.
+// The old key keeps working for overlap, then expires. Disabled key is not rotated.
+func (s *Store) Rotate(keyID string, overlap time.Duration) (string, string, error) {
+
+	var apiKey, newKeyID string
+
+	err := s.update(func(records map[string]Record) error {
+
+		record, ok := records[keyID]
+		if !ok {
+			return ErrKeyNotFound
+		}
+		if record.Disabled {
+			return ErrRotateDisabledKey
+		}
+
+		var err error
+		apiKey, newKeyID, err = GenerateKey()
+		if err != nil {
+			return err
+		}
+
+		newRecord := record
+		newRecord.Hash = HashKey(apiKey, s.hmacKey)
+		records[newKeyID] = newRecord
+
+		// Shorten expiry of old key to the end of overlap
+		overlapEnd := time.Now().Add(overlap).UTC()
+		if record.ExpiresAt == nil || record.ExpiresAt.After(overlapEnd) {
+			record.ExpiresAt = &overlapEnd
+		}
+		records[keyID] = record
+
+		return nil
+	})
+
+	return apiKey, newKeyID, err
+}
+
+// Revoke disables API key, the record is kept for audit
+func (s *Store) Revoke(keyID string) error {
+
+	return s.update(func(records map[string]Record) error {
+
+		record, ok := records[keyID]
+		if !ok {
+			return ErrKeyNotFound
+		}
+
+		record.Disabled = true
+		records[keyID] = record
+
+		return nil
+	})
+}
+
+// update applies change to copy of records, writes them to file atomically then swaps them in.
+// Plaintext file is not changed, since writing it would silently convert it to hashed format.
+func (s *Store) update(change func(records map[string]Record) error) error {
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	if s.IsPlaintext() {
+		return ErrPlaintextKeyFile
+	}
+
+	records := s.List()
+	if err := change(records); err != nil {
+		return err
+	}
+
+	if err := utils.WriteJsonFileAtomic(s.filePath, KeyFile{Keys: records}); err != nil {
+		return errors.New("write API key file failed: " + err.Error())
+	}
+
+	s.keys.Store(&keySet{records: records})
+
+	return nil
+}
+
+// FilePath returns path of API key file
+func (s *Store) FilePath() string {
+	return s.filePath
+}
+
+// readKeyFile reads API key file in hashed format {"keys": {"<key id>": {"client": ..., "hash": ...}}}.
+// The old plaintext format {"client": "API key"} is still accepted and hashed in memory.
+func readKeyFile(filePath string, hmacKey []byte) (*keySet, error) {
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read API key file failed: " + err.Error())
+	}
+
+	plaintext, err := IsPlaintextKeyFile(byteValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if plaintext {
+		records, err := ParsePlaintextKeyFile(byteValue, hmacKey)
+		if err != nil {
+			return nil, err
+		}
+		return &keySet{records: records.Keys, plaintext: true}, nil
+	}
+
+	file, err := ParseKeyFile(byteValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keySet{records: file.Keys}, nil
+}
+
+// IsPlaintextKeyFile checks whether API key file is the old plaintext format, which has no keys object
+func IsPlaintextKeyFile(byteValue []byte) (bool, error) {
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(byteValue, &fields); err != nil {
+		return false, errors.New("parse API key file failed: " + err.Error())
+	}
+
+	_, ok := fields["keys"]
+
+	return !ok, nil
+}
+
+// ParseKeyFile parses hashed API key file
+func ParseKeyFile(byteValue []byte) (KeyFile, error) {
+
+	var file KeyFile
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return KeyFile{}, errors.New("parse API key file failed: " + err.Error())
+	}
+
+	for keyID, record := range file.Keys {
+		if err := record.Validate(); err != nil {
+			return KeyFile{}, errors.New("API key " + keyID + " is invalid: " + err.Error())
+		}
+	}
+
+	if file.Keys == nil {
+		file.Keys = map[string]Record{}
+	}
+
+	return file, nil
+}
+
+// ParsePlaintextKeyFile parses old plaintext format {"client": "API key"} to hashed format
+func ParsePlaintextKeyFile(byteValue []byte, hmacKey []byte) (KeyFile, error) {
+
+	clients := map[string]string{}
+	if err := json.Unmarshal(byteValue, &clients); err != nil {
+		return KeyFile{}, errors.New("parse plaintext API key file failed: " + err.Error())
+	}
+
+	file := KeyFile{Keys: map[string]Record{}}
+	for client, apiKey := range clients {
+		if apiKey == "" {
+			return KeyFile{}, errors.New("API key of client " + client + " is empty")
+		}
+
+		keyID := KeyID(apiKey)
+		if otherRecord, ok := file.Keys[keyID]; ok {
+			return KeyFile{}, errors.New("API key of client " + client + " is same as client " + otherRecord.Client)
+		}
+
+		file.Keys[keyID] = Record{Client: client, Hash: HashKey(apiKey, hmacKey)}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,250 @@
+package apikey
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStoreKeys(t *testing.T) {
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+
+	store, err := NewStore(writeKeyFile(t, `{"keys": {}}`), hmacKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKey, keyID, err := store.Create(Record{Client: "User1", Scopes: []string{"login"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedKey, rotatedKeyID, err := store.Rotate(keyID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, revokedKeyID, err := store.Create(Record{Client: "User2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(revokedKeyID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantKeyID  string
+		wantUsable error
+	}{
+		{"old key in overlap", apiKey, keyID, nil},
+		{"rotated key", rotatedKey, rotatedKeyID, nil},
+		{"revoked key", revokedKey, revokedKeyID, ErrKeyDisabled},
+		{"unknown key", "ak_0123456789abcdef.secret", "", nil},
+		{"key id with wrong secret", "ak_" + keyID + ".secret", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKeyID, record, ok := store.Lookup(tt.apiKey)
+			if gotKeyID != tt.wantKeyID || ok != (tt.wantKeyID != "") {
+				t.Fatalf("Lookup() = %s, %v, want %s", gotKeyID, ok, tt.wantKeyID)
+			}
+			if !ok {
+				return
+			}
+
+			if err := record.CheckUsable(time.Now(), "192.0.2.1"); err != tt.wantUsable {
+				t.Errorf("CheckUsable() error = %v, want %v", err, tt.wantUsable)
+			}
+		})
+	}
+
+	// Rotated key keeps metadata, old key expires at end of overlap
+	oldRecord, _ := store.LookupID(keyID)
+	newRecord, _ := store.LookupID(rotatedKeyID)
+	if len(newRecord.Scopes) != 1 || newRecord.Scopes[0] != "login" {
+		t.Errorf("rotated record scopes = %v, want [login]", newRecord.Scopes)
+	}
+	if oldRecord.ExpiresAt == nil || oldRecord.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("old record expires at %v, want within overlap", oldRecord.ExpiresAt)
+	}
+
+	// Keys survive reload of file
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := store.Lookup(rotatedKey); !ok {
+		t.Error("Lookup() of rotated key after reload failed")
+	}
+
+	// Revoked key can not be rotated back to life
+	if _, _, err := store.Rotate(revokedKeyID, 0); err != ErrRotateDisabledKey {
+		t.Errorf("Rotate() of revoked key error = %v, want %v", err, ErrRotateDisabledKey)
+	}
+
+	if err := store.Revoke("missing"); err != ErrKeyNotFound {
+		t.Errorf("Revoke() of unknown key id error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+
+	first, firstKeyID, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, secondKeyID, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := writeKeyFile(t, `{"keys": {"`+firstKeyID+`": {"client": "User1", "hash": "`+HashKey(first, nil)+`"}}}`)
+
+	store, err := NewStore(filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, record, ok := store.Lookup(first); !ok || record.Client != "User1" {
+		t.Fatalf("Lookup() = %+v, %v, want key of User1", record, ok)
+	}
+
+	// Keys are swapped when file changed
+	if err := ioutil.WriteFile(filePath, []byte(`{"keys": {"`+secondKeyID+`": {"client": "User2", "hash": "`+HashKey(second, nil)+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := store.Lookup(first); ok {
+		t.Error("Lookup() of key removed from file succeeded")
+	}
+	if _, record, ok := store.Lookup(second); !ok || record.Client != "User2" {
+		t.Errorf("Lookup() = %+v, %v, want key of User2", record, ok)
+	}
+
+	// Malformed file keeps last good keys
+	if err := ioutil.WriteFile(filePath, []byte(`{"keys": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() of malformed file succeeded")
+	}
+	if _, _, ok := store.Lookup(second); !ok {
+		t.Error("Lookup() after failed reload failed, want last good keys")
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+
+	apiKey, keyID, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := writeKeyFile(t, `{"keys": {}}`)
+	store, err := NewStore(filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	go store.Watch(10*time.Millisecond, logrus.NewEntry(logger), func(err error) { reloaded <- err }, stop)
+
+	// Give watcher time to start, changes before that are not seen
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ioutil.WriteFile(filePath, []byte(`{"keys": {"`+keyID+`": {"client": "User1", "hash": "`+HashKey(apiKey, nil)+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-reloaded:
+			if err != nil {
+				t.Fatalf("reload error = %v", err)
+			}
+			if _, _, ok := store.Lookup(apiKey); ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("API key file change is not reloaded")
+		}
+	}
+}
+
+func TestStorePlaintextKeyFile(t *testing.T) {
+
+	store, err := NewStore(writeKeyFile(t, `{"User1": "secretApiKey"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !store.IsPlaintext() {
+		t.Fatal("IsPlaintext() = false, want true")
+	}
+	if keyID, record, ok := store.Lookup("secretApiKey"); !ok || keyID != KeyID("secretApiKey") || record.Client != "User1" {
+		t.Errorf("Lookup() = %s, %+v, %v, want key of User1", keyID, record, ok)
+	}
+
+	// Plaintext file is never rewritten by a change
+	if _, _, err := store.Create(Record{Client: "User2"}); err != ErrPlaintextKeyFile {
+		t.Errorf("Create() error = %v, want %v", err, ErrPlaintextKeyFile)
+	}
+	if err := store.Revoke(KeyID("secretApiKey")); err != ErrPlaintextKeyFile {
+		t.Errorf("Revoke() error = %v, want %v", err, ErrPlaintextKeyFile)
+	}
+}
+
+func TestParseKeyFiles(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		content       string
+		wantPlaintext bool
+		wantErr       bool
+	}{
+		{"hashed", `{"keys": {"k1": {"client": "User1", "hash": "sha256:00"}}}`, false, false},
+		{"hashed without keys", `{"keys": null}`, false, false},
+		{"hashed record without hash", `{"keys": {"k1": {"client": "User1"}}}`, false, true},
+		{"hashed record with malformed cidr", `{"keys": {"k1": {"client": "User1", "hash": "sha256:00", "allowed_cidrs": ["10.0.0.1"]}}}`, false, true},
+		{"plaintext", `{"User1": "key1", "User2": "key2"}`, true, false},
+		{"plaintext empty key", `{"User1": ""}`, true, true},
+		{"plaintext same key of two clients", `{"User1": "key1", "User2": "key1"}`, true, true},
+		{"malformed", `{"keys": `, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readKeyFile(writeKeyFile(t, tt.content), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readKeyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			plaintext, err := IsPlaintextKeyFile([]byte(tt.content))
+			if err == nil && plaintext != tt.wantPlaintext {
+				t.Errorf("IsPlaintextKeyFile() = %v, want %v", plaintext, tt.wantPlaintext)
+			}
+		})
+	}
+}
+
+// writeKeyFile writes content to API key file in a temp folder and returns its path
+func writeKeyFile(t *testing.T, content string) string {
+
+	filePath := filepath.Join(t.TempDir(), "apikey.json")
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Watch reloads API key file when it changes, and blocks until stop closed.
+// It watches file with inotify, and falls back to polling file every pollInterval.
+// onReload is called after each reload with its error if not nil, e.g. to write audit log.
+func (s *Store) Watch(pollInterval time.Duration, logger *logrus.Entry, onReload func(err error), stop <-chan struct{}) {
+
+	reload := func() {
+		err := s.Reload()
+		if onReload != nil {
+			onReload(err)
+		}
+		if err != nil {
+			logger.Warn("reload API key file failed, keep serving last good keys: " + err.Error())
+			return
+		}
+		logger.Info("API key file reloaded")
+	}
+
+	err := watchFileEvents(s.filePath, reload, stop)
+	if err == nil {
+		return
+	}
+
+	logger.Info("watch API key file with inotify failed, fall back to polling: " + err.Error())
+	pollFile(s.filePath, pollInterval, reload, stop)
+}
+
+// pollFile calls onChange when modify time or size of file changed
+func pollFile(filePath string, interval time.Duration, onChange func(), stop <-chan struct{}) {
+
+	lastModTime, lastSize := fileVersion(filePath)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			modTime, size := fileVersion(filePath)
+			if modTime.Equal(lastModTime) && size == lastSize {
+				continue
+			}
+			lastModTime, lastSize = modTime, size
+			onChange()
+		}
+	}
+}
+
+func fileVersion(filePath string) (time.Time, int64) {
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}, -1
+	}
+
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package apikey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchFileEvents watches folder of file with inotify, so file replaced by rename is still watched.
+// onChange is called after file written or moved in.
+func watchFileEvents(filePath string, onChange func(), stop <-chan struct{}) error {
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return errors.New("inotify init failed: " + err.Error())
+	}
+
+	mask := uint32(syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE)
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(filePath), mask); err != nil {
+		syscall.Close(fd)
+		return errors.New("inotify add watch failed: " + err.Error())
+	}
+
+	// Read fd through os.File, so close when stop makes blocking read return,
+	// and the fd number is not reused by another file while it is read
+	file := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-stop
+		file.Close()
+	}()
+
+	fileName := filepath.Base(filePath)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := file.Read(buf)
+		if err != nil || n <= 0 {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return errors.New("inotify read failed")
+			}
+		}
+
+		changed := false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+
+			// Name is padded with NUL bytes
+			name := buf[nameStart:nameEnd]
+			for i, b := range name {
+				if b == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			if string(name) == fileName {
+				changed = true
+			}
+
+			offset = nameEnd
+		}
+
+		if changed {
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package apikey
+
+import "errors"
+
+// watchFileEvents is not supported except linux, Watch falls back to polling
+func watchFileEvents(filePath string, onChange func(), stop <-chan struct{}) error {
+	return errors.New("inotify is only supported on linux")
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+)
+
+// Types of audit events
+const (
+	EventLogin           = "login"            // account login, or client credentials token request
+	EventAPIKeyUse       = "apikey_use"       // request authenticated with API key or signed request
+	EventClientCertUse   = "client_cert_use"  // request authenticated with client certificate
+	EventTokenRevocation = "token_revocation" // logout, admin revocation, or revocation after password changed
+	EventAccessDenied    = "access_denied"    // role, permission, scope or mfa not met
+	EventConfigReload    = "config_reload"    // API key file reloaded
+	EventAccountChange   = "account_change"   // account registered, password changed or reset
+	EventAdminAction     = "admin_action"     // API keys or registration changed by admin
+	EventImpersonation   = "impersonation"    // impersonation token minted, or request made with it
+)
+
+// Outcomes of audit events
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is one line of audit log
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Outcome   string    `json:"outcome"`
+	Actor     string    `json:"actor,omitempty"`   // real account, or client if no account
+	Subject   string    `json:"subject,omitempty"` // effective account when actor impersonates it
+	Tenant    string    `json:"tenant,omitempty"`
+	Client    string    `json:"client,omitempty"` // client of API key, client certificate or client credentials token
+	IP        string    `json:"ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Action    string    `json:"action,omitempty"` // e.g. POST /api/v1/login
+	Target    string    `json:"target,omitempty"` // e.g. key id, jti or account acted on
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Logger writes audit events
+type Logger interface {
+	Log(event Event) error
+}
+
+// A function to make audit logger with [AUDIT] in config, audit log has its own rotation and retention
+func MakeLogger(cfg conf.IConf) (*FileLogger, error) {
+
+	// Fetch config of audit
+	auditConf := cfg.AuditCfg()
+
+	writer, err := rotatelogs.New(
+		auditConf.LogPath+".%Y%m%d%H%M",
+		rotatelogs.WithLinkName(auditConf.LogPath),
+		rotatelogs.WithMaxAge(auditConf.Retention),
+		rotatelogs.WithRotationTime(auditConf.RotationTime),
+	)
+	if err != nil {
+		return nil, errors.New("audit log rotatelogs init failed: " + err.Error())
+	}
+
+	return NewFileLogger(writer), nil
+}
+
+// FileLogger appends audit events to writer as json lines
+type FileLogger struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewFileLogger returns audit logger which writes to writer, writer should append only
+func NewFileLogger(writer io.Writer) *FileLogger {
+	return &FileLogger{writer: writer}
+}
+
+// Log writes event as one json line, time is set if not given
+func (l *FileLogger) Log(event Event) error {
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+
+	byteValue, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// One write for each line, so lines of concurrent events are not mixed
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.writer.Write(append(byteValue, '\n'))
+
+	return err
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLoggerLog(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := NewFileLogger(&buf)
+
+	taipei := time.FixedZone("UTC+8", 8*60*60)
+	given := time.Date(2021, 8, 1, 8, 0, 0, 0, taipei)
+
+	events := []Event{
+		{Type: EventLogin, Outcome: OutcomeSuccess, Actor: "alice", Client: "web", IP: "10.0.0.1", RequestID: "req-1"},
+		{Time: given, Type: EventAccessDenied, Outcome: OutcomeFailure, Actor: "alice", Reason: "role Member is not allowed"},
+	}
+	for _, event := range events {
+		if err := logger.Log(event); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+
+	var got []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not json event: %v", scanner.Text(), err)
+		}
+		got = append(got, event)
+	}
+
+	if len(got) != len(events) {
+		t.Fatalf("logged %d events, want %d", len(got), len(events))
+	}
+	if got[0].Type != EventLogin || got[0].Actor != "alice" || got[0].Client != "web" || got[0].RequestID != "req-1" {
+		t.Errorf("event = %+v, want login of alice", got[0])
+	}
+
+	// Time is set if not given, and always written in UTC
+	if got[0].Time.Location() != time.UTC || time.Since(got[0].Time) > time.Minute {
+		t.Errorf("event time = %v, want recent UTC time", got[0].Time)
+	}
+	if got[1].Time.Location() != time.UTC || !got[1].Time.Equal(given) {
+		t.Errorf("event time = %v, want %v in UTC", got[1].Time, given)
+	}
+}
+
+func TestFileLoggerConcurrentLines(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := NewFileLogger(&buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger.Log(Event{Type: EventAPIKeyUse, Outcome: OutcomeSuccess, Target: strconv.Itoa(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	// Lines of concurrent events are not mixed
+	targets := map[string]bool{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not json event: %v", scanner.Text(), err)
+		}
+		targets[event.Target] = true
+	}
+	if len(targets) != 50 {
+		t.Errorf("logged %d distinct events, want 50", len(targets))
+	}
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/notify"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	ErrAccountsNotSupported = errors.New("authenticator backend can not manage accounts")
+	ErrRegistrationDisabled = errors.New("registration is disabled")
+	ErrAccountNameInvalid   = errors.New("account should be 3 to 64 characters of [A-Za-z0-9._@-]")
+	ErrInvalidResetToken    = errors.New("invalid or expired reset token")
+	ErrResetTokenGenerate   = errors.New("generate reset token failed")
+	ErrResetNotifyFailed    = errors.New("send reset token failed")
+)
+
+const resetTokenByteCount = 32
+
+var accountNameFormat = regexp.MustCompile(`^[A-Za-z0-9._@-]{3,64}$`)
+
+// Reset token entry, keyed by sha256 of token
+type resetToken struct {
+	account   string
+	expiresAt time.Time
+}
+
+// Accounts registers accounts and changes or resets their passwords.
+// Reset tokens are kept in memory, and sent to accounts with notifier.
+type Accounts struct {
+	store    AccountStore
+	policy   PasswordPolicy
+	notifier notify.Notifier
+	resetTTL time.Duration
+
+	mu                  sync.Mutex
+	registrationEnabled bool
+	resetTokens         map[string]resetToken
+}
+
+// A function to make accounts with [ACCOUNT] in config, authenticator should be an AccountStore to manage accounts
+func MakeAccounts(cfg conf.IConf, authenticator Authenticator) (*Accounts, error) {
+
+	// Fetch config of account
+	accountConf := cfg.AccountCfg()
+
+	notifier, err := notify.MakeNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := PasswordPolicy{
+		MinLength:     accountConf.PasswordMinLength,
+		RequireUpper:  accountConf.PasswordRequireUpper,
+		RequireLower:  accountConf.PasswordRequireLower,
+		RequireDigit:  accountConf.PasswordRequireDigit,
+		RequireSymbol: accountConf.PasswordRequireSymbol,
+	}
+
+	// Backends which can not manage accounts still authenticate, account endpoints return ErrAccountsNotSupported
+	store, _ := authenticator.(AccountStore)
+
+	return NewAccounts(store, policy, notifier, accountConf.ResetTokenTTL, accountConf.RegistrationEnabled), nil
+}
+
+// NewAccounts returns accounts with store, nil store can not manage accounts
+func NewAccounts(store AccountStore, policy PasswordPolicy, notifier notify.Notifier, resetTTL time.Duration, registrationEnabled bool) *Accounts {
+	return &Accounts{
+		store:               store,
+		policy:              policy,
+		notifier:            notifier,
+		resetTTL:            resetTTL,
+		registrationEnabled: registrationEnabled,
+		resetTokens:         map[string]resetToken{},
+	}
+}
+
+// RegistrationEnabled checks whether accounts can be registered
+func (a *Accounts) RegistrationEnabled() bool {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.registrationEnabled
+}
+
+// SetRegistrationEnabled turns registration on or off until restart
+func (a *Accounts) SetRegistrationEnabled(enabled bool) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.registrationEnabled = enabled
+}
+
+// Register creates account of default role with password
+func (a *Accounts) Register(account, password string) (User, error) {
+
+	if a.store == nil {
+		return User{}, ErrAccountsNotSupported
+	}
+
+	if !a.RegistrationEnabled() {
+		return User{}, ErrRegistrationDisabled
+	}
+
+	if !accountNameFormat.MatchString(account) {
+		return User{}, ErrAccountNameInvalid
+	}
+
+	if err := a.policy.Check(account, password); err != nil {
+		return User{}, err
+	}
+
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	if err := a.store.Create(account, passwordHash, DefaultRole); err != nil {
+		return User{}, err
+	}
+
+	return User{Account: account, Role: DefaultRole}, nil
+}
+
+// Lookup returns account and role of existing account
+func (a *Accounts) Lookup(account string) (User, error) {
+
+	if a.store == nil {
+		return User{}, ErrAccountsNotSupported
+	}
+
+	return a.store.Lookup(account)
+}
+
+// ChangePassword sets new password of account after old password verified
+func (a *Accounts) ChangePassword(account, oldPassword, newPassword string) error {
+
+	if a.store == nil {
+		return ErrAccountsNotSupported
+	}
+
+	if _, err := a.store.Authenticate(account, oldPassword); err != nil {
+		return err
+	}
+
+	if oldPassword == newPassword {
+		return ErrPasswordNotChanged
+	}
+
+	return a.setPassword(account, newPassword)
+}
+
+// RequestReset creates one-time reset token of account, and returns send which sends it to account with notifier.
+// The same work is done whether account exists or not, and send of unknown account sends nothing,
+// so caller should run send after responding to keep response time independent of account and notifier.
+func (a *Accounts) RequestReset(account string, now time.Time) (func() error, error) {
+
+	if a.store == nil {
+		return nil, ErrAccountsNotSupported
+	}
+
+	exists := a.store.Exists(account)
+
+	randomBytes := utils.GenerateRandomBytes(resetTokenByteCount)
+	if randomBytes == nil {
+		return nil, ErrResetTokenGenerate
+	}
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+	tokenHash := hashResetToken(token)
+
+	// Only the latest token of account is valid
+	a.mu.Lock()
+	a.purgeLocked(now)
+	for existingHash, entry := range a.resetTokens {
+		if entry.account == account {
+			delete(a.resetTokens, existingHash)
+		}
+	}
+	if exists {
+		a.resetTokens[tokenHash] = resetToken{account: account, expiresAt: now.Add(a.resetTTL)}
+	}
+	a.mu.Unlock()
+
+	send := func() error {
+		if !exists {
+			return nil
+		}
+
+		body := "Use this token to reset password of " + account + " in " + a.resetTTL.String() + ": " + token
+		if err := a.notifier.Notify(account, "Password reset", body); err != nil {
+			return errors.New(ErrResetNotifyFailed.Error() + ": " + err.Error())
+		}
+
+		return nil
+	}
+
+	return send, nil
+}
+
+// ResetPassword sets new password of the account of reset token, token can only be used once
+func (a *Accounts) ResetPassword(token, newPassword string, now time.Time) (string, error) {
+
+	if a.store == nil {
+		return "", ErrAccountsNotSupported
+	}
+
+	tokenHash := hashResetToken(token)
+
+	a.mu.Lock()
+	entry, ok := a.resetTokens[tokenHash]
+	if !ok || !now.Before(entry.expiresAt) {
+		a.mu.Unlock()
+		return "", ErrInvalidResetToken
+	}
+	a.mu.Unlock()
+
+	// Token is kept if new password is not accepted by policy, so user can try another password
+	if err := a.policy.Check(entry.account, newPassword); err != nil {
+		return entry.account, err
+	}
+
+	// Consume token, it may be used by another request meanwhile
+	a.mu.Lock()
+	if _, ok := a.resetTokens[tokenHash]; !ok {
+		a.mu.Unlock()
+		return "", ErrInvalidResetToken
+	}
+	delete(a.resetTokens, tokenHash)
+	a.mu.Unlock()
+
+	return entry.account, a.setPassword(entry.account, newPassword)
+}
+
+// setPassword checks new password with policy and saves its hash
+func (a *Accounts) setPassword(account, password string) error {
+
+	if err := a.policy.Check(account, password); err != nil {
+		return err
+	}
+
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return a.store.SetPasswordHash(account, passwordHash)
+}
+
+// purgeLocked removes expired reset tokens
+func (a *Accounts) purgeLocked(now time.Time) {
+
+	for tokenHash, entry := range a.resetTokens {
+		if !now.Before(entry.expiresAt) {
+			delete(a.resetTokens, tokenHash)
+		}
+	}
+}
+
+func hashResetToken(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the last body sent to each recipient
+type recordingNotifier struct {
+	bodies map[string]string
+}
+
+func (n *recordingNotifier) Notify(recipient, subject, body string) error {
+	n.bodies[recipient] = body
+	return nil
+}
+
+// token returns reset token at the end of the last body sent to recipient
+func (n *recordingNotifier) token(recipient string) string {
+
+	body := n.bodies[recipient]
+
+	return body[strings.LastIndex(body, " ")+1:]
+}
+
+func newTestAccounts(t *testing.T, registrationEnabled bool) (*Accounts, *recordingNotifier) {
+
+	passwordHash, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewLocalAuthenticatorWithUsers(map[string]UserRecord{
+		"alice": {PasswordHash: passwordHash, Role: "User"},
+	})
+	notifier := &recordingNotifier{bodies: map[string]string{}}
+	policy := PasswordPolicy{MinLength: 8, RequireDigit: true}
+
+	return NewAccounts(store, policy, notifier, 15*time.Minute, registrationEnabled), notifier
+}
+
+func TestAccountsRegister(t *testing.T) {
+
+	tests := []struct {
+		name                string
+		registrationEnabled bool
+		account             string
+		password            string
+		want                error
+	}{
+		{"registered", true, "bob", "Passw0rd!", nil},
+		{"registration disabled", false, "bob", "Passw0rd!", ErrRegistrationDisabled},
+		{"account too short", true, "bo", "Passw0rd!", ErrAccountNameInvalid},
+		{"account with space", true, "bob smith", "Passw0rd!", ErrAccountNameInvalid},
+		{"password rejected by policy", true, "bob", "password", ErrPasswordNeedsDigit},
+		{"existing account", true, "alice", "Passw0rd!", ErrAccountExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, _ := newTestAccounts(t, tt.registrationEnabled)
+
+			user, err := accounts.Register(tt.account, tt.password)
+			if err != tt.want {
+				t.Fatalf("Register() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if user.Account != tt.account || user.Role != DefaultRole {
+				t.Errorf("Register() = %+v, want %s with role %s", user, tt.account, DefaultRole)
+			}
+			if _, err := accounts.store.Authenticate(tt.account, tt.password); err != nil {
+				t.Errorf("Authenticate() of registered account error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAccountsChangePassword(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		oldPassword string
+		newPassword string
+		want        error
+	}{
+		{"changed", "Passw0rd!", "N3wPassword", nil},
+		{"wrong old password", "wrong", "N3wPassword", ErrInvalidCredentials},
+		{"same password", "Passw0rd!", "Passw0rd!", ErrPasswordNotChanged},
+		{"rejected by policy", "Passw0rd!", "short1", ErrPasswordTooShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, _ := newTestAccounts(t, true)
+
+			if err := accounts.ChangePassword("alice", tt.oldPassword, tt.newPassword); err != tt.want {
+				t.Fatalf("ChangePassword() error = %v, want %v", err, tt.want)
+			}
+
+			// Old password keeps working unless password was changed
+			_, err := accounts.store.Authenticate("alice", "Passw0rd!")
+			if (err == nil) != (tt.want != nil) {
+				t.Errorf("Authenticate() with old password error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAccountsResetPassword(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name        string
+		requests    int
+		token       func(notifier *recordingNotifier) string
+		newPassword string
+		at          time.Duration
+		want        error
+	}{
+		{"reset", 1, func(n *recordingNotifier) string { return n.token("alice") }, "N3wPassword", time.Minute, nil},
+		{"expired token", 1, func(n *recordingNotifier) string { return n.token("alice") }, "N3wPassword", 15 * time.Minute, ErrInvalidResetToken},
+		{"unknown token", 1, func(n *recordingNotifier) string { return "unknown" }, "N3wPassword", time.Minute, ErrInvalidResetToken},
+		{"rejected by policy", 1, func(n *recordingNotifier) string { return n.token("alice") }, "short1", time.Minute, ErrPasswordTooShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, notifier := newTestAccounts(t, true)
+
+			send, err := accounts.RequestReset("alice", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := send(); err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token(notifier)
+
+			account, err := accounts.ResetPassword(token, tt.newPassword, now.Add(tt.at))
+			if err != tt.want {
+				t.Fatalf("ResetPassword() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if account != "alice" {
+				t.Errorf("ResetPassword() account = %s, want alice", account)
+			}
+			if _, err := accounts.store.Authenticate("alice", tt.newPassword); err != nil {
+				t.Errorf("Authenticate() with new password error = %v", err)
+			}
+
+			// Token can only be used once
+			if _, err := accounts.ResetPassword(token, "An0therPassword", now.Add(tt.at)); err != ErrInvalidResetToken {
+				t.Errorf("ResetPassword() with used token error = %v, want %v", err, ErrInvalidResetToken)
+			}
+		})
+	}
+}
+
+func TestAccountsRequestReset(t *testing.T) {
+
+	accounts, notifier := newTestAccounts(t, true)
+	now := time.Unix(1600000000, 0)
+
+	// Unknown account gets a send function which sends nothing
+	send, err := accounts.RequestReset("mallory", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(); err != nil || len(notifier.bodies) != 0 {
+		t.Errorf("send() of unknown account error = %v, sent %v, want nothing sent", err, notifier.bodies)
+	}
+
+	// Only the latest token of account is valid
+	send, _ = accounts.RequestReset("alice", now)
+	send()
+	firstToken := notifier.token("alice")
+	send, _ = accounts.RequestReset("alice", now)
+	send()
+
+	if _, err := accounts.ResetPassword(firstToken, "N3wPassword", now); err != ErrInvalidResetToken {
+		t.Errorf("ResetPassword() with replaced token error = %v, want %v", err, ErrInvalidResetToken)
+	}
+	if _, err := accounts.ResetPassword(notifier.token("alice"), "N3wPassword", now); err != nil {
+		t.Errorf("ResetPassword() with latest token error = %v", err)
+	}
+
+	// Backend without account store can not manage accounts
+	unsupported := NewAccounts(nil, PasswordPolicy{}, notifier, time.Minute, true)
+	if _, err := unsupported.RequestReset("alice", now); err != ErrAccountsNotSupported {
+		t.Errorf("RequestReset() without store error = %v, want %v", err, ErrAccountsNotSupported)
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+)
+
+// ErrInvalidCredentials is returned when account or password not met
+var ErrInvalidCredentials = errors.New("invalid account or password")
+
+// Role of account when credential backend not assigns one
+const DefaultRole = "Member"
+
+// User is the identity returned by authenticator
+type User struct {
+	Account string
+	Role    string
+}
+
+// Authenticator is used to verify account and password in Login
+type Authenticator interface {
+	Authenticate(account, password string) (User, error)
+}
+
+// AccountStore is an authenticator which can also create accounts and set passwords
+type AccountStore interface {
+	Authenticator
+	Exists(account string) bool
+	Lookup(account string) (User, error)
+	Create(account, passwordHash, role string) error
+	SetPasswordHash(account, passwordHash string) error
+}
+
+// A function to make authenticator which selected by [AUTH] Backend in config
+func MakeAuthenticator(cfg conf.IConf) (Authenticator, error) {
+
+	// Fetch config of auth
+	authConf := cfg.AuthCfg()
+
+	switch authConf.Backend {
+	case "local":
+		return NewLocalAuthenticator(authConf.UserFilePath)
+	default:
+		return nil, errors.New("no such authenticator backend: " + authConf.Backend)
+	}
+}
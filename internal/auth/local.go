@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	ErrAccountExists   = errors.New("account already exists")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// Placeholder hash in users.example.json
+const SamplePasswordHash = "REPLACE_WITH_HASH_FROM_USER_TOOL"
+
+// Password hashes which were published with this repository, anyone can login with them
+var publishedPasswordHashes = []string{
+	SamplePasswordHash,
+	"$2a$10$IxHNZEYrqgR87UDh/6/acum2YuJf/B/qR7V6MJsi0JTvevP0v5Oxe",
+	"$argon2id$v=19$m=65536,t=3,p=2$4dZwncjk2fMyoU8HrAnrjQ$2TdEGGjHGdkvvYBobGmK2WGarg1CnPn1gWlIhAdHcOQ",
+}
+
+// User record format in user file
+type UserRecord struct {
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+}
+
+// LocalAuthenticator verifies accounts with password hashes stored in local user file.
+// Created accounts and changed passwords are written back to user file.
+type LocalAuthenticator struct {
+	mu           sync.RWMutex
+	users        map[string]UserRecord
+	userFilePath string // empty: changes are kept in memory only
+}
+
+// NewLocalAuthenticator reads user file and returns authenticator
+func NewLocalAuthenticator(userFilePath string) (*LocalAuthenticator, error) {
+
+	// Read user file
+	byteValue, err := ioutil.ReadFile(userFilePath)
+	if err != nil {
+		return nil, errors.New("read user file failed: " + err.Error())
+	}
+
+	// Parse user records
+	users := map[string]UserRecord{}
+	if err := json.Unmarshal(byteValue, &users); err != nil {
+		return nil, errors.New("parse user file failed: " + err.Error())
+	}
+
+	// Malformed hashes are rejected here, so they do not fail login requests later
+	for account, user := range users {
+		for _, publishedHash := range publishedPasswordHashes {
+			if user.PasswordHash == publishedHash {
+				return nil, errors.New("account " + account + " has published sample password hash, set its password with user-tool")
+			}
+		}
+		if err := CheckPasswordHash(user.PasswordHash); err != nil {
+			return nil, errors.New("password hash of account " + account + " is malformed: " + err.Error())
+		}
+	}
+
+	authenticator := NewLocalAuthenticatorWithUsers(users)
+	authenticator.userFilePath = userFilePath
+
+	return authenticator, nil
+}
+
+// NewLocalAuthenticatorWithUsers returns authenticator with given user records
+func NewLocalAuthenticatorWithUsers(users map[string]UserRecord) *LocalAuthenticator {
+	return &LocalAuthenticator{users: users}
+}
+
+// Authenticate checks password with the hash of account and returns user with role of account
+func (a *LocalAuthenticator) Authenticate(account, password string) (User, error) {
+
+	a.mu.RLock()
+	user, ok := a.users[account]
+	a.mu.RUnlock()
+	if !ok {
+		// Still do an argon2id compare, so response time does not tell whether account exists
+		VerifyPassword(dummyPasswordHash, password)
+		return User{}, ErrInvalidCredentials
+	}
+
+	if err := VerifyPassword(user.PasswordHash, password); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+
+	role := user.Role
+	if role == "" {
+		role = DefaultRole
+	}
+
+	return User{Account: account, Role: role}, nil
+}
+
+// Exists checks whether account is in user file
+func (a *LocalAuthenticator) Exists(account string) bool {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	_, ok := a.users[account]
+
+	return ok
+}
+
+// Lookup returns account and role of account without password, e.g. to impersonate it
+func (a *LocalAuthenticator) Lookup(account string) (User, error) {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, ok := a.users[account]
+	if !ok {
+		return User{}, ErrAccountNotFound
+	}
+
+	role := user.Role
+	if role == "" {
+		role = DefaultRole
+	}
+
+	return User{Account: account, Role: role}, nil
+}
+
+// Create adds account with password hash and role, and saves user file
+func (a *LocalAuthenticator) Create(account, passwordHash, role string) error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.users[account]; ok {
+		return ErrAccountExists
+	}
+
+	a.users[account] = UserRecord{PasswordHash: passwordHash, Role: role}
+
+	if err := a.saveLocked(); err != nil {
+		delete(a.users, account)
+		return err
+	}
+
+	return nil
+}
+
+// SetPasswordHash replaces password hash of account, and saves user file
+func (a *LocalAuthenticator) SetPasswordHash(account, passwordHash string) error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	user, ok := a.users[account]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	oldUser := user
+	user.PasswordHash = passwordHash
+	a.users[account] = user
+
+	if err := a.saveLocked(); err != nil {
+		a.users[account] = oldUser
+		return err
+	}
+
+	return nil
+}
+
+func (a *LocalAuthenticator) saveLocked() error {
+
+	if a.userFilePath == "" {
+		return nil
+	}
+
+	if err := utils.WriteJsonFileAtomic(a.userFilePath, a.users); err != nil {
+		return errors.New("write user file failed: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeUserFile(t *testing.T, users map[string]UserRecord) string {
+
+	byteValue, err := json.Marshal(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userFilePath := filepath.Join(t.TempDir(), "users.json")
+	if err := ioutil.WriteFile(userFilePath, byteValue, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return userFilePath
+}
+
+func TestNewLocalAuthenticator(t *testing.T) {
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"own hash", string(bcryptHash), false},
+		{"sample placeholder", SamplePasswordHash, true},
+		{"published bcrypt hash", publishedPasswordHashes[1], true},
+		{"published argon2id hash", publishedPasswordHashes[2], true},
+		{"malformed hash", "password", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userFilePath := writeUserFile(t, map[string]UserRecord{"admin": {PasswordHash: tt.hash, Role: "Admin"}})
+			_, err := NewLocalAuthenticator(userFilePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLocalAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalAuthenticatorAuthenticate(t *testing.T) {
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := NewLocalAuthenticatorWithUsers(map[string]UserRecord{
+		"admin": {PasswordHash: string(bcryptHash), Role: "Admin"},
+		"bob":   {PasswordHash: string(bcryptHash)},
+	})
+
+	tests := []struct {
+		name     string
+		account  string
+		password string
+		wantRole string
+		wantErr  error
+	}{
+		{"correct password", "admin", "correct horse", "Admin", nil},
+		{"default role", "bob", "correct horse", DefaultRole, nil},
+		{"wrong password", "admin", "wrong horse", "", ErrInvalidCredentials},
+		{"unknown account", "carol", "correct horse", "", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := authenticator.Authenticate(tt.account, tt.password)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("Authenticate() role = %q, want %q", user.Role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+)
+
+// AttemptRecord is the failure state of one account or client IP
+type AttemptRecord struct {
+	Failures     int
+	FirstFailure time.Time
+	LockedUntil  time.Time
+}
+
+// AttemptStore keeps login failure state, so it can be shared between servers later
+type AttemptStore interface {
+	Get(key string) AttemptRecord
+	Update(key string, change func(record *AttemptRecord)) AttemptRecord
+	Delete(key string)
+}
+
+// LockoutPolicy sets when and how long to lock after failures
+type LockoutPolicy struct {
+	MaxFailures int           // failures in window before lock, 0: never lock
+	Window      time.Duration // failures older than window are forgotten
+	BaseLockout time.Duration // first lockout, doubled on each more failure
+	MaxLockout  time.Duration
+}
+
+// LoginLimiter tracks login failures per account and per client IP
+type LoginLimiter struct {
+	store         AttemptStore
+	accountPolicy LockoutPolicy
+	ipPolicy      LockoutPolicy
+}
+
+// A function to make login limiter with [LOGIN LOCKOUT] in config, state is kept in memory
+func MakeLoginLimiter(cfg conf.IConf) *LoginLimiter {
+
+	// Fetch config of lockout
+	lockoutConf := cfg.LockoutCfg()
+
+	accountPolicy := LockoutPolicy{
+		MaxFailures: lockoutConf.AccountMaxFailures,
+		Window:      lockoutConf.FailureWindow,
+		BaseLockout: lockoutConf.BaseLockout,
+		MaxLockout:  lockoutConf.MaxLockout,
+	}
+
+	ipPolicy := accountPolicy
+	ipPolicy.MaxFailures = lockoutConf.IPMaxFailures
+
+	// Keep records until both window and longest lockout passed
+	retention := lockoutConf.FailureWindow + lockoutConf.MaxLockout
+
+	return NewLoginLimiter(NewMemoryAttemptStore(retention), accountPolicy, ipPolicy)
+}
+
+// NewLoginLimiter returns limiter with store and policies of account and client IP
+func NewLoginLimiter(store AttemptStore, accountPolicy, ipPolicy LockoutPolicy) *LoginLimiter {
+	return &LoginLimiter{
+		store:         store,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+	}
+}
+
+// Check returns how long the account or client IP is still locked, zero if not locked
+func (l *LoginLimiter) Check(account, ip string, now time.Time) time.Duration {
+
+	retryAfter := time.Duration(0)
+
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		record := l.store.Get(key)
+		if wait := record.LockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter
+}
+
+// Failure records failed login, and returns lockout of account and client IP if they become locked
+func (l *LoginLimiter) Failure(account, ip string, now time.Time) (time.Duration, time.Duration) {
+
+	accountLockout := l.failure(accountKey(account), l.accountPolicy, now)
+	ipLockout := l.failure(ipKey(ip), l.ipPolicy, now)
+
+	return accountLockout, ipLockout
+}
+
+// Success clears failures of account, failures of client IP are kept
+func (l *LoginLimiter) Success(account string) {
+	l.store.Delete(accountKey(account))
+}
+
+func (l *LoginLimiter) failure(key string, policy LockoutPolicy, now time.Time) time.Duration {
+
+	lockout := time.Duration(0)
+
+	// Lockout is disabled
+	if policy.MaxFailures == 0 {
+		return lockout
+	}
+
+	l.store.Update(key, func(record *AttemptRecord) {
+
+		// Forget failures out of window
+		if now.Sub(record.FirstFailure) > policy.Window && now.After(record.LockedUntil) {
+			record.Failures = 0
+		}
+		if record.Failures == 0 {
+			record.FirstFailure = now
+		}
+		record.Failures++
+
+		if record.Failures < policy.MaxFailures {
+			return
+		}
+
+		// Exponential backoff from base lockout
+		lockout = policy.BaseLockout
+		for i := policy.MaxFailures; i < record.Failures && lockout < policy.MaxLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > policy.MaxLockout {
+			lockout = policy.MaxLockout
+		}
+		record.LockedUntil = now.Add(lockout)
+	})
+
+	return lockout
+}
+
+func accountKey(account string) string {
+	return "account:" + account
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MemoryAttemptStore keeps login failure state in memory
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	records   map[string]*AttemptRecord
+	retention time.Duration
+	lastPurge time.Time
+}
+
+// NewMemoryAttemptStore returns store which forgets records idle longer than retention
+func NewMemoryAttemptStore(retention time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		records:   map[string]*AttemptRecord{},
+		retention: retention,
+		lastPurge: time.Now(),
+	}
+}
+
+func (s *MemoryAttemptStore) Get(key string) AttemptRecord {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok {
+		return *record
+	}
+
+	return AttemptRecord{}
+}
+
+func (s *MemoryAttemptStore) Update(key string, change func(record *AttemptRecord)) AttemptRecord {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeLocked(time.Now())
+
+	record, ok := s.records[key]
+	if !ok {
+		record = &AttemptRecord{}
+		s.records[key] = record
+	}
+	change(record)
+
+	return *record
+}
+
+func (s *MemoryAttemptStore) Delete(key string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+}
+
+// purgeLocked removes idle records at most once a minute
+func (s *MemoryAttemptStore) purgeLocked(now time.Time) {
+
+	if now.Sub(s.lastPurge) < time.Minute {
+		return
+	}
+	s.lastPurge = now
+
+	for key, record := range s.records {
+		if now.Sub(record.FirstFailure) > s.retention && now.After(record.LockedUntil) {
+			delete(s.records, key)
+		}
+	}
+}
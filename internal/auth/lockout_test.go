@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterLockout(t *testing.T) {
+
+	policy := LockoutPolicy{MaxFailures: 3, Window: 10 * time.Minute, BaseLockout: time.Minute, MaxLockout: 5 * time.Minute}
+	start := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name        string
+		policy      LockoutPolicy
+		failures    []time.Duration // offsets from start
+		wantLockout []time.Duration // account lockout returned by each failure
+	}{
+		{
+			name:        "locks at max failures",
+			policy:      policy,
+			failures:    []time.Duration{0, time.Second, 2 * time.Second},
+			wantLockout: []time.Duration{0, 0, time.Minute},
+		},
+		{
+			name:        "doubles up to max lockout",
+			policy:      policy,
+			failures:    []time.Duration{0, 0, 0, 0, 0, 0},
+			wantLockout: []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute},
+		},
+		{
+			name:        "failures out of window are forgotten",
+			policy:      policy,
+			failures:    []time.Duration{0, time.Second, 11 * time.Minute, 12 * time.Minute},
+			wantLockout: []time.Duration{0, 0, 0, 0},
+		},
+		{
+			name:        "zero max failures never locks",
+			policy:      LockoutPolicy{MaxFailures: 0, Window: time.Minute, BaseLockout: time.Minute, MaxLockout: time.Minute},
+			failures:    []time.Duration{0, 0, 0, 0, 0},
+			wantLockout: []time.Duration{0, 0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// IP never locks, so only account lockout is checked
+			limiter := NewLoginLimiter(NewMemoryAttemptStore(time.Hour), tt.policy, LockoutPolicy{})
+
+			for i, offset := range tt.failures {
+				accountLockout, ipLockout := limiter.Failure("alice", "192.0.2.1", start.Add(offset))
+				if accountLockout != tt.wantLockout[i] || ipLockout != 0 {
+					t.Errorf("Failure() #%d = (%v, %v), want (%v, 0)", i+1, accountLockout, ipLockout, tt.wantLockout[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLimiterCheck(t *testing.T) {
+
+	accountPolicy := LockoutPolicy{MaxFailures: 2, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ipPolicy := LockoutPolicy{MaxFailures: 3, Window: time.Hour, BaseLockout: 10 * time.Minute, MaxLockout: time.Hour}
+	now := time.Unix(1600000000, 0)
+
+	limiter := NewLoginLimiter(NewMemoryAttemptStore(time.Hour), accountPolicy, ipPolicy)
+	limiter.Failure("alice", "192.0.2.1", now)
+	limiter.Failure("alice", "192.0.2.1", now)
+	limiter.Failure("bob", "192.0.2.1", now)
+
+	tests := []struct {
+		name    string
+		account string
+		ip      string
+		at      time.Time
+		want    time.Duration
+	}{
+		{"locked account and ip, longest wins", "alice", "192.0.2.1", now, 10 * time.Minute},
+		{"locked account from another ip", "alice", "192.0.2.2", now, time.Minute},
+		{"locked ip with another account", "carol", "192.0.2.1", now, 10 * time.Minute},
+		{"not locked", "carol", "192.0.2.2", now, 0},
+		{"lockout passed", "alice", "192.0.2.2", now.Add(2 * time.Minute), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limiter.Check(tt.account, tt.ip, tt.at); got != tt.want {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Success clears the account only, client IP stays locked
+	limiter.Success("alice")
+	if got := limiter.Check("alice", "192.0.2.2", now); got != 0 {
+		t.Errorf("Check() of account after Success() = %v, want 0", got)
+	}
+	if got := limiter.Check("alice", "192.0.2.1", now); got != 10*time.Minute {
+		t.Errorf("Check() of ip after Success() = %v, want %v", got, 10*time.Minute)
+	}
+}
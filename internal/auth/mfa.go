@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("totp is not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("totp is already enabled")
+	ErrMFANotEnabled     = errors.New("totp is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid totp or recovery code")
+)
+
+const (
+	recoveryCodeCount     = 10
+	recoveryCodeByteCount = 5 // 8 base32 chars
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFARecord is the TOTP state of one account
+type MFARecord struct {
+	Secret             string   `json:"secret"`
+	Enabled            bool     `json:"enabled"`              // false until first code confirmed
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"` // sha256 hex, removed once used
+	LastUsedStep       int64    `json:"last_used_step"`       // codes of this step or before are rejected
+}
+
+// MFAStore keeps TOTP state of accounts
+type MFAStore interface {
+	Get(account string) (MFARecord, bool)
+	Put(account string, record MFARecord) error
+	Delete(account string) error
+}
+
+// MFA enrolls and verifies TOTP second factor of accounts
+type MFA struct {
+	mu     sync.Mutex
+	store  MFAStore
+	issuer string
+}
+
+// A function to make MFA with [MFA] in config, state is kept in file
+func MakeMFA(cfg conf.IConf) (*MFA, error) {
+
+	// Fetch config of mfa
+	mfaConf := cfg.MFACfg()
+
+	store, err := NewFileMFAStore(mfaConf.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMFA(store, mfaConf.Issuer), nil
+}
+
+// NewMFA returns MFA with store, issuer is shown in authenticator apps
+func NewMFA(store MFAStore, issuer string) *MFA {
+	return &MFA{store: store, issuer: issuer}
+}
+
+// Enabled checks whether account has confirmed TOTP
+func (m *MFA) Enabled(account string) bool {
+
+	record, ok := m.store.Get(account)
+
+	return ok && record.Enabled
+}
+
+// Enroll creates a new TOTP secret of account, which needs to be confirmed with a code before enabled.
+// It returns secret and otpauth URI.
+func (m *MFA) Enroll(account string) (string, string, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.store.Get(account); ok && record.Enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", errors.New("generate totp secret failed: " + err.Error())
+	}
+
+	if err := m.store.Put(account, MFARecord{Secret: secret}); err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPURI(m.issuer, account, secret), nil
+}
+
+// Confirm enables TOTP of account with first code, and returns recovery codes which are only shown once
+func (m *MFA) Confirm(account, code string, now time.Time) ([]string, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.store.Get(account)
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+	if record.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, valid := ValidateTOTP(record.Secret, code, now, record.LastUsedStep)
+	if !valid {
+		return nil, ErrInvalidMFACode
+	}
+
+	// Generate recovery codes, only hashes are stored
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	recoveryCodeHashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeByteCount)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, errors.New("generate recovery code failed: " + err.Error())
+		}
+
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))
+		recoveryCode := encoded[:4] + "-" + encoded[4:]
+
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		recoveryCodeHashes = append(recoveryCodeHashes, hashRecoveryCode(recoveryCode))
+	}
+
+	record.Enabled = true
+	record.LastUsedStep = step
+	record.RecoveryCodeHashes = recoveryCodeHashes
+
+	if err := m.store.Put(account, record); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// Verify checks TOTP code or recovery code of account, each code can only be used once.
+// It returns whether a recovery code is used.
+func (m *MFA) Verify(account, code string, now time.Time) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.store.Get(account)
+	if !ok || !record.Enabled {
+		return false, ErrMFANotEnabled
+	}
+
+	// Try TOTP code first
+	if step, valid := ValidateTOTP(record.Secret, code, now, record.LastUsedStep); valid {
+		record.LastUsedStep = step
+		return false, m.store.Put(account, record)
+	}
+
+	// Then recovery codes, used one is removed
+	codeHash := hashRecoveryCode(code)
+	for i, recoveryCodeHash := range record.RecoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCodeHash), []byte(codeHash)) == 1 {
+			remaining := make([]string, 0, len(record.RecoveryCodeHashes)-1)
+			remaining = append(remaining, record.RecoveryCodeHashes[:i]...)
+			remaining = append(remaining, record.RecoveryCodeHashes[i+1:]...)
+			record.RecoveryCodeHashes = remaining
+			return true, m.store.Put(account, record)
+		}
+	}
+
+	return false, ErrInvalidMFACode
+}
+
+// Disable removes TOTP of account after code verified
+func (m *MFA) Disable(account, code string, now time.Time) error {
+
+	if _, err := m.Verify(account, code, now); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.store.Delete(account)
+}
+
+// RemainingRecoveryCodes returns count of unused recovery codes of account
+func (m *MFA) RemainingRecoveryCodes(account string) int {
+
+	record, _ := m.store.Get(account)
+
+	return len(record.RecoveryCodeHashes)
+}
+
+// hashRecoveryCode returns sha256 hex of normalized recovery code
+func hashRecoveryCode(code string) string {
+
+	normalized := strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// FileMFAStore keeps TOTP state in memory and persists it to file on each change
+type FileMFAStore struct {
+	mu       sync.RWMutex
+	records  map[string]MFARecord
+	filePath string
+}
+
+// NewFileMFAStore loads TOTP state from file, file will be created if not exists
+func NewFileMFAStore(filePath string) (*FileMFAStore, error) {
+
+	store := &FileMFAStore{
+		records:  map[string]MFARecord{},
+		filePath: filePath,
+	}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.New("read mfa file failed: " + err.Error())
+	}
+
+	if err := json.Unmarshal(byteValue, &store.records); err != nil {
+		return nil, errors.New("parse mfa file failed: " + err.Error())
+	}
+
+	return store, nil
+}
+
+// Get returns TOTP state of account
+func (s *FileMFAStore) Get(account string) (MFARecord, bool) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[account]
+
+	return record, ok
+}
+
+// Put sets TOTP state of account and saves to file
+func (s *FileMFAStore) Put(account string, record MFARecord) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[account] = record
+
+	return s.saveLocked()
+}
+
+// Delete removes TOTP state of account and saves to file
+func (s *FileMFAStore) Delete(account string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, account)
+
+	return s.saveLocked()
+}
+
+func (s *FileMFAStore) saveLocked() error {
+
+	if err := utils.WriteJsonFileAtomic(s.filePath, s.records); err != nil {
+		return errors.New("write mfa file failed: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// Params of argon2id hashes of new passwords
+const (
+	argon2Memory    = 64 * 1024
+	argon2Time      = 3
+	argon2Threads   = 2
+	argon2SaltSize  = 16
+	argon2KeyLength = 32
+)
+
+// Longest password accepted, hashing is slow and should not be used with huge input
+const maxPasswordLength = 256
+
+var (
+	ErrPasswordTooShort    = errors.New("password is too short")
+	ErrPasswordTooLong     = errors.New("password is too long")
+	ErrPasswordNeedsUpper  = errors.New("password needs an upper case letter")
+	ErrPasswordNeedsLower  = errors.New("password needs a lower case letter")
+	ErrPasswordNeedsDigit  = errors.New("password needs a digit")
+	ErrPasswordNeedsSymbol = errors.New("password needs a symbol")
+	ErrPasswordHasAccount  = errors.New("password should not contain account")
+	ErrPasswordNotChanged  = errors.New("new password should not be the same as old password")
+	ErrPasswordHashFailed  = errors.New("hash password failed")
+)
+
+// argon2id hash with params of new passwords, compared when account not exists so it takes as long as
+// an account which registered or changed password. Its zero salt and key are never made by HashPassword
+var dummyPasswordHash = formatArgon2id(make([]byte, argon2SaltSize), make([]byte, argon2KeyLength))
+
+// VerifyPassword checks password with bcrypt or argon2id (PHC string format) hash
+func VerifyPassword(hash, password string) error {
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+	default:
+		return errors.New("unsupported password hash format")
+	}
+}
+
+// HashPassword returns argon2id hash of password in PHC string format
+func HashPassword(password string) (string, error) {
+
+	salt := utils.GenerateRandomBytes(argon2SaltSize)
+	if salt == nil {
+		return "", ErrPasswordHashFailed
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLength)
+
+	return formatArgon2id(salt, key), nil
+}
+
+// formatArgon2id returns argon2id hash of salt and key with params of new passwords in PHC string format
+func formatArgon2id(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// PasswordPolicy is the strength rules of new passwords
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Check checks password of account against policy, the error tells the first rule not met
+func (p PasswordPolicy) Check(account, password string) error {
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if length > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		return ErrPasswordNeedsUpper
+	}
+	if p.RequireLower && !hasLower {
+		return ErrPasswordNeedsLower
+	}
+	if p.RequireDigit && !hasDigit {
+		return ErrPasswordNeedsDigit
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return ErrPasswordNeedsSymbol
+	}
+
+	if account != "" && strings.Contains(strings.ToLower(password), strings.ToLower(account)) {
+		return ErrPasswordHasAccount
+	}
+
+	return nil
+}
+
+// Bounds of argon2id params read from stored hashes, hashes out of them are rejected instead of
+// panicking in argon2 or exhausting memory on a malformed user file
+const (
+	argon2MaxMemory    = 1024 * 1024 // KiB, 1 GiB
+	argon2MaxTime      = 16
+	argon2MinSaltSize  = 8
+	argon2MinKeyLength = 16
+	argon2MaxKeyLength = 64
+)
+
+// Parsed argon2id hash
+type argon2idHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// CheckPasswordHash checks hash is a supported bcrypt or argon2id hash with sane params, used when user file is loaded
+func CheckPasswordHash(hash string) error {
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, err := parseArgon2id(hash)
+		return err
+	default:
+		return errors.New("unsupported password hash format")
+	}
+}
+
+// parseArgon2id parses hash in format $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key> and checks bounds of params
+func parseArgon2id(hash string) (argon2idHash, error) {
+
+	var parsed argon2idHash
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return parsed, errors.New("argon2id hash is malformed")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return parsed, errors.New("argon2id hash version is malformed")
+	}
+	if version != argon2.Version {
+		return parsed, errors.New("argon2id hash version is not supported")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.time, &parsed.threads); err != nil {
+		return parsed, errors.New("argon2id hash params are malformed")
+	}
+	if parsed.time < 1 || parsed.time > argon2MaxTime || parsed.threads < 1 {
+		return parsed, errors.New("argon2id hash params t and p are out of range")
+	}
+	if parsed.memory < 8*uint32(parsed.threads) || parsed.memory > argon2MaxMemory {
+		return parsed, errors.New("argon2id hash param m is out of range")
+	}
+
+	var err error
+	parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(parsed.salt) < argon2MinSaltSize {
+		return parsed, errors.New("argon2id hash salt is malformed")
+	}
+
+	parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(parsed.key) < argon2MinKeyLength || len(parsed.key) > argon2MaxKeyLength {
+		return parsed, errors.New("argon2id hash key is malformed")
+	}
+
+	return parsed, nil
+}
+
+// verifyArgon2id checks password with argon2id hash
+func verifyArgon2id(hash, password string) error {
+
+	parsed, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	// Derive key from password with same params and compare in constant time
+	derivedKey := argon2.IDKey([]byte(password), parsed.salt, parsed.time, parsed.memory, parsed.threads, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(parsed.key, derivedKey) != 1 {
+		return errors.New("argon2id hash and password not met")
+	}
+
+	return nil
+}
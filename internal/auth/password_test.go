@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argon2idHash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		wantErr  bool
+	}{
+		{"bcrypt match", string(bcryptHash), "correct horse", false},
+		{"bcrypt mismatch", string(bcryptHash), "wrong horse", true},
+		{"bcrypt $2y$ prefix", "$2y$" + strings.TrimPrefix(string(bcryptHash), "$2a$"), "correct horse", false},
+		{"argon2id match", argon2idHash, "correct horse", false},
+		{"argon2id mismatch", argon2idHash, "wrong horse", true},
+		{"empty password", argon2idHash, "", true},
+		{"unsupported format", "md5:5f4dcc3b5aa765d61d8327deb882cf99", "password", true},
+		{"empty hash", "", "password", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyPassword(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashPasswordFormat(t *testing.T) {
+
+	first, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(first, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("HashPassword() = %q, want argon2id PHC string", first)
+	}
+	if first == second {
+		t.Error("HashPassword() returned the same hash twice, salt is not random")
+	}
+	if err := CheckPasswordHash(first); err != nil {
+		t.Errorf("CheckPasswordHash() of new hash error = %v", err)
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 16 bytes salt and 32 bytes key, base64 without padding
+	salt := "c29tZXNhbHRzb21lc2FsdA"
+	key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"bcrypt", string(bcryptHash), false},
+		{"bcrypt truncated", string(bcryptHash)[:20], true},
+		{"argon2id", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$" + key, false},
+		{"argon2id missing part", "$argon2id$v=19$m=65536,t=3,p=2$" + salt, true},
+		{"argon2id old version", "$argon2id$v=16$m=65536,t=3,p=2$" + salt + "$" + key, true},
+		{"argon2id malformed params", "$argon2id$v=19$m=x,t=3,p=2$" + salt + "$" + key, true},
+		{"argon2id zero time", "$argon2id$v=19$m=65536,t=0,p=2$" + salt + "$" + key, true},
+		{"argon2id too much time", "$argon2id$v=19$m=65536,t=17,p=2$" + salt + "$" + key, true},
+		{"argon2id zero threads", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key, true},
+		{"argon2id too much memory", "$argon2id$v=19$m=2097152,t=3,p=2$" + salt + "$" + key, true},
+		{"argon2id memory below threads", "$argon2id$v=19$m=8,t=3,p=2$" + salt + "$" + key, true},
+		{"argon2id short salt", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$" + key, true},
+		{"argon2id short key", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$a2V5", true},
+		{"argon2id bad base64", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$!!!", true},
+		{"argon2i", "$argon2i$v=19$m=65536,t=3,p=2$" + salt + "$" + key, true},
+		{"plaintext", "password", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordHash(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckPasswordHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+
+	// Unknown accounts are compared with dummy hash, it should cost as much as a hash of new password
+	if err := CheckPasswordHash(dummyPasswordHash); err != nil {
+		t.Fatalf("CheckPasswordHash() of dummy hash error = %v", err)
+	}
+
+	newHash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dummyParams := strings.Join(strings.Split(dummyPasswordHash, "$")[:4], "$")
+	newParams := strings.Join(strings.Split(newHash, "$")[:4], "$")
+	if dummyParams != newParams {
+		t.Errorf("dummy hash params = %q, want %q", dummyParams, newParams)
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+
+	strict := PasswordPolicy{MinLength: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		account  string
+		password string
+		want     error
+	}{
+		{"meets strict policy", strict, "alice", "Tr0ub4dor&3xyz", nil},
+		{"too short", strict, "alice", "Tr0ub4dor&3", ErrPasswordTooShort},
+		{"length counts runes", PasswordPolicy{MinLength: 5}, "", "密碼密碼", ErrPasswordTooShort},
+		{"too long", PasswordPolicy{}, "", strings.Repeat("a", maxPasswordLength+1), ErrPasswordTooLong},
+		{"needs upper", strict, "alice", "tr0ub4dor&3xyz", ErrPasswordNeedsUpper},
+		{"needs lower", strict, "alice", "TR0UB4DOR&3XYZ", ErrPasswordNeedsLower},
+		{"needs digit", strict, "alice", "Troubador&xyzw", ErrPasswordNeedsDigit},
+		{"needs symbol", strict, "alice", "Tr0ub4dor3xyzw", ErrPasswordNeedsSymbol},
+		{"space is a symbol", strict, "alice", "Tr0ub4dor 3xyz", nil},
+		{"contains account", strict, "alice", "Tr0ub&ALICE3xyz", ErrPasswordHasAccount},
+		{"no account given", strict, "", "Tr0ub4dor&3xyz", nil},
+		{"empty policy", PasswordPolicy{}, "alice", "a", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Check(tt.account, tt.password); err != tt.want {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
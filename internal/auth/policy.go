@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sort"
+)
+
+// Permission which grants all permissions
+const AllPermissions = "*"
+
+// Policy file format, maps role to permissions
+type policyFile struct {
+	Roles map[string][]string `json:"roles"`
+}
+
+// Policy keeps permissions of each role
+type Policy struct {
+	roles map[string]map[string]bool
+}
+
+// LoadPolicy reads policy file and returns policy
+func LoadPolicy(filePath string) (*Policy, error) {
+
+	// Read policy file
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read policy file failed: " + err.Error())
+	}
+
+	var file policyFile
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return nil, errors.New("parse policy file failed: " + err.Error())
+	}
+
+	return NewPolicy(file.Roles), nil
+}
+
+// NewPolicy returns policy with role to permissions map
+func NewPolicy(roles map[string][]string) *Policy {
+
+	policy := &Policy{roles: map[string]map[string]bool{}}
+
+	for role, permissions := range roles {
+		policy.roles[role] = map[string]bool{}
+		for _, permission := range permissions {
+			policy.roles[role][permission] = true
+		}
+	}
+
+	return policy
+}
+
+// HasRole checks whether role is defined in policy
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// HasPermission checks whether role has permission
+func (p *Policy) HasPermission(role, permission string) bool {
+
+	permissions, ok := p.roles[role]
+	if !ok {
+		return false
+	}
+
+	return permissions[AllPermissions] || permissions[permission]
+}
+
+// Permissions returns sorted permissions of role
+func (p *Policy) Permissions(role string) []string {
+
+	permissions := []string{}
+	for permission := range p.roles[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+
+	return permissions
+}
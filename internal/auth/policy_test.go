@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyHasPermission(t *testing.T) {
+
+	policy := NewPolicy(map[string][]string{
+		"Admin":  {AllPermissions},
+		"User":   {"service:read", "me:read"},
+		"Guest":  {},
+		"Broken": nil,
+	})
+
+	tests := []struct {
+		name       string
+		role       string
+		permission string
+		want       bool
+	}{
+		{"wildcard grants any permission", "Admin", "tokens:revoke", true},
+		{"listed permission", "User", "service:read", true},
+		{"unlisted permission", "User", "tokens:revoke", false},
+		{"role without permissions", "Guest", "service:read", false},
+		{"nil permissions", "Broken", "service:read", false},
+		{"unknown role", "Nobody", "service:read", false},
+		{"role is case sensitive", "admin", "service:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.HasPermission(tt.role, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRolesAndPermissions(t *testing.T) {
+
+	policy := NewPolicy(map[string][]string{
+		"User":  {"service:read", "me:read", "service:read"},
+		"Guest": {},
+	})
+
+	tests := []struct {
+		role            string
+		wantRole        bool
+		wantPermissions []string
+	}{
+		{"User", true, []string{"me:read", "service:read"}},
+		{"Guest", true, []string{}},
+		{"Nobody", false, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			if got := policy.HasRole(tt.role); got != tt.wantRole {
+				t.Errorf("HasRole() = %v, want %v", got, tt.wantRole)
+			}
+			if got := policy.Permissions(tt.role); !reflect.DeepEqual(got, tt.wantPermissions) {
+				t.Errorf("Permissions() = %v, want %v", got, tt.wantPermissions)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"roles": {"Admin": ["*"], "User": ["service:read"]}}`, false},
+		{"empty roles", `{}`, false},
+		{"malformed json", `{"roles": `, true},
+		{"wrong type", `{"roles": {"Admin": "*"}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(dir, tt.name+".json")
+			if err := ioutil.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadPolicy(filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadPolicy(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadPolicy() of missing file error = nil, want error")
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret "12345678901234567890" of RFC 6238 appendix B in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+
+	// SHA1 test vectors of RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("TOTPCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOTPCodeSecretFormat(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"upper case", rfc6238Secret, false},
+		{"lower case", strings.ToLower(rfc6238Secret), false},
+		{"padded", "GEZDGNBVGY3TQOJQ====", false},
+		{"not base32", "GEZDGNBVGY3TQOJ1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TOTPCode(tt.secret, 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TOTPCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	current := TOTPStep(now)
+
+	codeAt := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		lastUsedStep int64
+		wantStep     int64
+		wantValid    bool
+	}{
+		{"current step", codeAt(current), 0, current, true},
+		{"previous step within skew", codeAt(current - 1), 0, current - 1, true},
+		{"next step within skew", codeAt(current + 1), 0, current + 1, true},
+		{"two steps ago", codeAt(current - 2), 0, 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, 0, false},
+		{"step already used", codeAt(current), current, 0, false},
+		{"later step after used one", codeAt(current + 1), current, current + 1, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"short code", codeAt(current)[:5], 0, 0, false},
+		{"empty code", "", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, valid := ValidateTOTP(rfc6238Secret, tt.code, now, tt.lastUsedStep)
+			if valid != tt.wantValid || step != tt.wantStep {
+				t.Errorf("ValidateTOTP() = (%d, %v), want (%d, %v)", step, valid, tt.wantStep, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+
+	got := TOTPURI("gin-api-server", "alice@example.com", rfc6238Secret)
+	want := "otpauth://totp/gin-api-server:alice@example.com?algorithm=SHA1&digits=6&issuer=gin-api-server&period=30&secret=" + rfc6238Secret
+
+	if got != want {
+		t.Errorf("TOTPURI() = %s, want %s", got, want)
+	}
+}
+
+// memoryMFAStore keeps MFA records in memory for tests
+type memoryMFAStore map[string]MFARecord
+
+func (s memoryMFAStore) Get(account string) (MFARecord, bool) {
+	record, ok := s[account]
+	return record, ok
+}
+
+func (s memoryMFAStore) Put(account string, record MFARecord) error {
+	s[account] = record
+	return nil
+}
+
+func (s memoryMFAStore) Delete(account string) error {
+	delete(s, account)
+	return nil
+}
+
+func TestMFAFlow(t *testing.T) {
+
+	mfa := NewMFA(memoryMFAStore{}, "gin-api-server")
+	now := time.Unix(1111111111, 0)
+
+	if _, err := mfa.Verify("alice", "000000", now); err != ErrMFANotEnabled {
+		t.Fatalf("Verify() before enroll error = %v, want %v", err, ErrMFANotEnabled)
+	}
+
+	secret, _, err := mfa.Enroll("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := TOTPCode(secret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mfa.Confirm("alice", "000000", now); err != ErrInvalidMFACode {
+		t.Fatalf("Confirm() with wrong code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	recoveryCodes, err := mfa.Confirm("alice", code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount || mfa.RemainingRecoveryCodes("alice") != recoveryCodeCount {
+		t.Fatalf("Confirm() returned %d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+	if _, _, err := mfa.Enroll("alice"); err != ErrMFAAlreadyEnabled {
+		t.Fatalf("Enroll() after confirm error = %v, want %v", err, ErrMFAAlreadyEnabled)
+	}
+
+	nextCode, err := TOTPCode(secret, TOTPStep(now)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		wantRecovery bool
+		wantErr      error
+	}{
+		{"confirm code can not be replayed", code, false, ErrInvalidMFACode},
+		{"next totp code", nextCode, false, nil},
+		{"totp code used once", nextCode, false, ErrInvalidMFACode},
+		{"recovery code", recoveryCodes[0], true, nil},
+		{"recovery code used once", recoveryCodes[0], false, ErrInvalidMFACode},
+		{"recovery code is normalized", " " + strings.ToUpper(recoveryCodes[1]) + " ", true, nil},
+		{"wrong code", "aaaa-bbbb", false, ErrInvalidMFACode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recovery, err := mfa.Verify("alice", tt.code, now)
+			if err != tt.wantErr || recovery != tt.wantRecovery {
+				t.Errorf("Verify() = (%v, %v), want (%v, %v)", recovery, err, tt.wantRecovery, tt.wantErr)
+			}
+		})
+	}
+
+	if got := mfa.RemainingRecoveryCodes("alice"); got != recoveryCodeCount-2 {
+		t.Errorf("RemainingRecoveryCodes() = %d, want %d", got, recoveryCodeCount-2)
+	}
+}
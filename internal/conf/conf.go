@@ -4,6 +4,8 @@ import (
 	"errors"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -11,19 +13,105 @@ import (
 type IConf interface {
 	Load(configFilePath string) error
 	LoggerCfg() LoggerConf
+	TLSCfg() TLSConf
 	APICfg() APIConf
+	AuthCfg() AuthConf
+	TokenCfg() TokenConf
+	LockoutCfg() LockoutConf
+	MFACfg() MFAConf
+	SessionCfg() SessionConf
+	AccountCfg() AccountConf
+	AuditCfg() AuditConf
+	TenantsCfg() []TenantConf
+	CORSCfg() CORSConf
 }
 
 // Conf is a struct to store params of config, which read from config.ini.
 type Conf struct {
 
 	// Params of API server
-	apiServiceName string
-	apiProtocol    string
-	apiHost        string
-	apiPort        string
-	apiMode        string
-	apiKeyFilePath string
+	apiServiceName        string
+	apiProtocol           string
+	apiHost               string
+	apiPort               string
+	apiMode               string
+	apiKeyFilePath        string
+	apiKeyPollInterval    time.Duration
+	apiKeyHMACKeyFilePath string
+	trustedProxies        []string
+	signatureMaxSkew      time.Duration
+	signedBodyMaxBytes    int64
+
+	// Params of TLS and client certificate auth
+	tlsCertFilePath   string
+	tlsKeyFilePath    string
+	clientAuth        string
+	clientCAFilePath  string
+	clientMapFilePath string
+
+	// Params of account authentication
+	authBackend      string
+	authUserFilePath string
+	policyFilePath   string
+
+	// Params of token
+	accessTokenTTL          time.Duration
+	tokenIssuer             string
+	tokenAudience           string
+	tokenLeeway             time.Duration
+	tokenAlgorithms         []string
+	tokenRequiredClaims     []string
+	refreshTokenTTL         time.Duration
+	impersonationTokenTTL   time.Duration
+	revocationBackend       string
+	revocationFilePath      string
+	tokenFormat             string
+	sessionBackend          string
+	sessionFilePath         string
+	tokenBindToClient       bool
+	keysetFilePath          string
+	externalIssuersFilePath string
+
+	// Params of login lockout
+	lockoutAccountMaxFailures int
+	lockoutIPMaxFailures      int
+	lockoutFailureWindow      time.Duration
+	lockoutBaseLockout        time.Duration
+	lockoutMaxLockout         time.Duration
+
+	// Params of two-factor authentication
+	mfaIssuer          string
+	mfaFilePath        string
+	mfaRequiredByAdmin bool
+
+	// Params of browser session
+	sessionCookieMode     bool
+	sessionCookieName     string
+	sessionCSRFCookieName string
+	sessionSameSite       string
+	sessionCookieDomain   string
+
+	// Params of cors
+	corsAllowedOrigins []string
+
+	// Params of self-service accounts
+	registrationEnabled   bool
+	resetTokenTTL         time.Duration
+	notifier              string
+	notifierFilePath      string
+	passwordMinLength     int
+	passwordRequireUpper  bool
+	passwordRequireLower  bool
+	passwordRequireDigit  bool
+	passwordRequireSymbol bool
+
+	// Params of tenants, one [TENANT <name>] section for each tenant
+	tenants []TenantConf
+
+	// Params of audit log
+	auditLogPath      string
+	auditRotationTime time.Duration
+	auditRetention    time.Duration
 
 	// Params of log file stored path
 	infoDebugLogPath string
@@ -37,12 +125,102 @@ type LoggerConf struct {
 }
 
 type APIConf struct {
-	APIServiceName string
-	APIMode        string
-	APIProtocol    string
-	APIHost        string
-	APIPort        string
-	APIKeyFilePath string
+	APIServiceName        string
+	APIMode               string
+	APIProtocol           string
+	APIHost               string
+	APIPort               string
+	APIKeyFilePath        string
+	APIKeyPollInterval    time.Duration
+	APIKeyHMACKeyFilePath string
+	TrustedProxies        []string
+	SignatureMaxSkew      time.Duration
+	SignedBodyMaxBytes    int64
+}
+
+type TLSConf struct {
+	CertFilePath      string
+	KeyFilePath       string
+	ClientAuth        string
+	ClientCAFilePath  string
+	ClientMapFilePath string
+}
+
+type AuthConf struct {
+	Backend        string
+	UserFilePath   string
+	PolicyFilePath string
+}
+
+type TokenConf struct {
+	AccessTokenTTL          time.Duration
+	Issuer                  string
+	Audience                string
+	Leeway                  time.Duration
+	AllowedAlgorithms       []string
+	RequiredClaims          []string
+	RefreshTokenTTL         time.Duration
+	ImpersonationTokenTTL   time.Duration
+	RevocationBackend       string
+	RevocationFilePath      string
+	Format                  string // jwt or opaque
+	SessionBackend          string
+	SessionFilePath         string
+	BindToClient            bool
+	KeysetFilePath          string
+	ExternalIssuersFilePath string
+}
+
+type LockoutConf struct {
+	AccountMaxFailures int
+	IPMaxFailures      int
+	FailureWindow      time.Duration
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+}
+
+type MFAConf struct {
+	Issuer          string
+	FilePath        string
+	RequiredByAdmin bool
+}
+
+type SessionConf struct {
+	CookieMode     bool
+	CookieName     string
+	CSRFCookieName string
+	SameSite       string
+	CookieDomain   string
+}
+
+type CORSConf struct {
+	AllowedOrigins []string
+}
+
+type AccountConf struct {
+	RegistrationEnabled   bool
+	ResetTokenTTL         time.Duration
+	Notifier              string
+	NotifierFilePath      string
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+}
+
+type AuditConf struct {
+	LogPath      string
+	RotationTime time.Duration
+	Retention    time.Duration
+}
+
+type TenantConf struct {
+	Name              string
+	ServiceName       string        // empty: Service_Name of [API SERVER]
+	AccessTokenTTL    time.Duration // 0: Access_Token_TTL_Minutes of [TOKEN]
+	RequestsPerMinute int           // 0: no limit
+	AllowedRoles      []string      // empty: all roles
 }
 
 // Load is used to load config.ini and set fileds of Conf
@@ -98,6 +276,416 @@ func (conf *Conf) Load(configFilePath string) error {
 	}
 	conf.apiKeyFilePath = path.Join(rootPath, apiKeyFilePath)
 
+	// Poll interval is optional, polling is only the fallback of inotify
+	apiKeyPollIntervalSeconds, err := conf.GetOptionalIntDefault(confReader, "API SERVER", "APIKey_Poll_Interval_Seconds", 5)
+	if err == nil && apiKeyPollIntervalSeconds <= 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [API SERVER] APIKey_Poll_Interval_Seconds failed: " + err.Error())
+	}
+	conf.apiKeyPollInterval = time.Duration(apiKeyPollIntervalSeconds) * time.Second
+
+	// HMAC key is optional, only needed when API key file has hmac-sha256 hashes
+	if apiKeyHMACKeyFilePath := conf.GetOptionalString(confReader, "API SERVER", "APIKey_HMAC_Key_File_Path"); apiKeyHMACKeyFilePath != "" {
+		conf.apiKeyHMACKeyFilePath = path.Join(rootPath, apiKeyHMACKeyFilePath)
+	}
+
+	// Trusted proxies are optional, separated by comma
+	conf.trustedProxies = splitList(conf.GetOptionalString(confReader, "API SERVER", "Trusted_Proxies"))
+
+	// Params of signed requests are optional
+	signatureMaxSkewSeconds, err := conf.GetOptionalIntDefault(confReader, "API SERVER", "Signature_Max_Skew_Seconds", 300)
+	if err == nil && signatureMaxSkewSeconds <= 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [API SERVER] Signature_Max_Skew_Seconds failed: " + err.Error())
+	}
+	conf.signatureMaxSkew = time.Duration(signatureMaxSkewSeconds) * time.Second
+
+	// Body of signed request is read before signature verified, so it is limited
+	signedBodyMaxBytes, err := conf.GetOptionalIntDefault(confReader, "API SERVER", "Signed_Body_Max_Bytes", 1048576)
+	if err == nil && signedBodyMaxBytes <= 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [API SERVER] Signed_Body_Max_Bytes failed: " + err.Error())
+	}
+	conf.signedBodyMaxBytes = int64(signedBodyMaxBytes)
+
+	// Params of TLS and client certificate auth
+
+	// Server certificate is only needed by https
+	if conf.apiProtocol == "https" {
+		tlsCertFilePath, err := conf.GetString(confReader, "TLS", "Cert_File_Path")
+		if err != nil {
+			return errors.New("read [TLS] Cert_File_Path failed: " + err.Error())
+		}
+		conf.tlsCertFilePath = path.Join(rootPath, tlsCertFilePath)
+
+		tlsKeyFilePath, err := conf.GetString(confReader, "TLS", "Key_File_Path")
+		if err != nil {
+			return errors.New("read [TLS] Key_File_Path failed: " + err.Error())
+		}
+		conf.tlsKeyFilePath = path.Join(rootPath, tlsKeyFilePath)
+	}
+
+	// Client auth is apikey if not set
+	conf.clientAuth = conf.GetOptionalString(confReader, "TLS", "Client_Auth")
+	if conf.clientAuth == "" {
+		conf.clientAuth = "apikey"
+	}
+
+	// Client CA and client map are only needed by client certificate auth, which needs https
+	if conf.clientAuth != "apikey" {
+		if conf.apiProtocol != "https" {
+			return errors.New("read [TLS] Client_Auth failed: " + conf.clientAuth + " needs https protocol")
+		}
+
+		clientCAFilePath, err := conf.GetString(confReader, "TLS", "Client_CA_File_Path")
+		if err != nil {
+			return errors.New("read [TLS] Client_CA_File_Path failed: " + err.Error())
+		}
+		conf.clientCAFilePath = path.Join(rootPath, clientCAFilePath)
+
+		clientMapFilePath, err := conf.GetString(confReader, "TLS", "Client_Map_File_Path")
+		if err != nil {
+			return errors.New("read [TLS] Client_Map_File_Path failed: " + err.Error())
+		}
+		conf.clientMapFilePath = path.Join(rootPath, clientMapFilePath)
+	}
+
+	// Params of account authentication
+
+	authBackend, err := conf.GetString(confReader, "AUTH", "Backend")
+	if err != nil {
+		return errors.New("read [AUTH] Backend failed: " + err.Error())
+	}
+	conf.authBackend = authBackend
+
+	authUserFilePath, err := conf.GetString(confReader, "AUTH", "User_File_Path")
+	if err != nil {
+		return errors.New("read [AUTH] User_File_Path failed: " + err.Error())
+	}
+	conf.authUserFilePath = path.Join(rootPath, authUserFilePath)
+
+	policyFilePath, err := conf.GetString(confReader, "AUTH", "Policy_File_Path")
+	if err != nil {
+		return errors.New("read [AUTH] Policy_File_Path failed: " + err.Error())
+	}
+	conf.policyFilePath = path.Join(rootPath, policyFilePath)
+
+	// Params of token
+
+	keysetFilePath, err := conf.GetString(confReader, "TOKEN", "Keyset_File_Path")
+	if err != nil {
+		return errors.New("read [TOKEN] Keyset_File_Path failed: " + err.Error())
+	}
+	conf.keysetFilePath = path.Join(rootPath, keysetFilePath)
+
+	accessTokenTTLMinutes, err := conf.GetInt(confReader, "TOKEN", "Access_Token_TTL_Minutes")
+	if err == nil && accessTokenTTLMinutes < 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [TOKEN] Access_Token_TTL_Minutes failed: " + err.Error())
+	}
+	conf.accessTokenTTL = time.Duration(accessTokenTTLMinutes) * time.Minute
+
+	tokenIssuer, err := conf.GetString(confReader, "TOKEN", "Issuer")
+	if err != nil {
+		return errors.New("read [TOKEN] Issuer failed: " + err.Error())
+	}
+	conf.tokenIssuer = tokenIssuer
+
+	// Audience is optional, token of empty audience has its subject as aud
+	conf.tokenAudience = conf.GetOptionalString(confReader, "TOKEN", "Audience")
+
+	// Leeway is optional and can be 0
+	tokenLeewaySeconds, err := conf.GetOptionalIntDefault(confReader, "TOKEN", "Leeway_Seconds", 0)
+	if err == nil && tokenLeewaySeconds < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [TOKEN] Leeway_Seconds failed: " + err.Error())
+	}
+	conf.tokenLeeway = time.Duration(tokenLeewaySeconds) * time.Second
+
+	// Allowed algorithms and required claims are optional, empty means default
+	conf.tokenAlgorithms = splitList(conf.GetOptionalString(confReader, "TOKEN", "Allowed_Algorithms"))
+	conf.tokenRequiredClaims = splitList(conf.GetOptionalString(confReader, "TOKEN", "Required_Claims"))
+
+	refreshTokenTTLHours, err := conf.GetInt(confReader, "TOKEN", "Refresh_Token_TTL_Hours")
+	if err == nil && refreshTokenTTLHours < 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [TOKEN] Refresh_Token_TTL_Hours failed: " + err.Error())
+	}
+	conf.refreshTokenTTL = time.Duration(refreshTokenTTLHours) * time.Hour
+
+	impersonationTokenTTLMinutes, err := conf.GetInt(confReader, "TOKEN", "Impersonation_Token_TTL_Minutes")
+	if err == nil && impersonationTokenTTLMinutes < 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [TOKEN] Impersonation_Token_TTL_Minutes failed: " + err.Error())
+	}
+	conf.impersonationTokenTTL = time.Duration(impersonationTokenTTLMinutes) * time.Minute
+
+	revocationBackend, err := conf.GetString(confReader, "TOKEN", "Revocation_Backend")
+	if err != nil {
+		return errors.New("read [TOKEN] Revocation_Backend failed: " + err.Error())
+	}
+	conf.revocationBackend = revocationBackend
+
+	// Revocation file is only needed by file backend
+	if revocationBackend == "file" {
+		revocationFilePath, err := conf.GetString(confReader, "TOKEN", "Revocation_File_Path")
+		if err != nil {
+			return errors.New("read [TOKEN] Revocation_File_Path failed: " + err.Error())
+		}
+		conf.revocationFilePath = path.Join(rootPath, revocationFilePath)
+	}
+
+	// Token format is optional, opaque tokens are resolved with session store
+	conf.tokenFormat = conf.GetOptionalString(confReader, "TOKEN", "Format")
+	if conf.tokenFormat == "" {
+		conf.tokenFormat = "jwt"
+	}
+	if conf.tokenFormat != "jwt" && conf.tokenFormat != "opaque" {
+		return errors.New("read [TOKEN] Format failed: no such token format: " + conf.tokenFormat)
+	}
+
+	// Session store is only needed by opaque format, and session file only by file backend
+	if conf.tokenFormat == "opaque" {
+		sessionBackend, err := conf.GetString(confReader, "TOKEN", "Session_Backend")
+		if err != nil {
+			return errors.New("read [TOKEN] Session_Backend failed: " + err.Error())
+		}
+		conf.sessionBackend = sessionBackend
+
+		if sessionBackend == "file" {
+			sessionFilePath, err := conf.GetString(confReader, "TOKEN", "Session_File_Path")
+			if err != nil {
+				return errors.New("read [TOKEN] Session_File_Path failed: " + err.Error())
+			}
+			conf.sessionFilePath = path.Join(rootPath, sessionFilePath)
+		}
+	}
+
+	// Binding tokens to client is optional
+	conf.tokenBindToClient = conf.GetOptionalBool(confReader, "TOKEN", "Bind_To_Client")
+
+	// External issuers are optional
+	if externalIssuersFilePath := conf.GetOptionalString(confReader, "TOKEN", "External_Issuers_File_Path"); externalIssuersFilePath != "" {
+		conf.externalIssuersFilePath = path.Join(rootPath, externalIssuersFilePath)
+	}
+
+	// Params of login lockout
+
+	// Keys are optional, 0 of max failures disables lockout of account or client IP
+	lockoutAccountMaxFailures, err := conf.GetOptionalIntDefault(confReader, "LOGIN LOCKOUT", "Account_Max_Failures", 5)
+	if err == nil && lockoutAccountMaxFailures < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [LOGIN LOCKOUT] Account_Max_Failures failed: " + err.Error())
+	}
+	conf.lockoutAccountMaxFailures = lockoutAccountMaxFailures
+
+	lockoutIPMaxFailures, err := conf.GetOptionalIntDefault(confReader, "LOGIN LOCKOUT", "IP_Max_Failures", 20)
+	if err == nil && lockoutIPMaxFailures < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [LOGIN LOCKOUT] IP_Max_Failures failed: " + err.Error())
+	}
+	conf.lockoutIPMaxFailures = lockoutIPMaxFailures
+
+	lockoutFailureWindowSeconds, err := conf.GetOptionalIntDefault(confReader, "LOGIN LOCKOUT", "Failure_Window_Seconds", 900)
+	if err == nil && lockoutFailureWindowSeconds < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [LOGIN LOCKOUT] Failure_Window_Seconds failed: " + err.Error())
+	}
+	conf.lockoutFailureWindow = time.Duration(lockoutFailureWindowSeconds) * time.Second
+
+	lockoutBaseLockoutSeconds, err := conf.GetOptionalIntDefault(confReader, "LOGIN LOCKOUT", "Base_Lockout_Seconds", 30)
+	if err == nil && lockoutBaseLockoutSeconds < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [LOGIN LOCKOUT] Base_Lockout_Seconds failed: " + err.Error())
+	}
+	conf.lockoutBaseLockout = time.Duration(lockoutBaseLockoutSeconds) * time.Second
+
+	lockoutMaxLockoutSeconds, err := conf.GetOptionalIntDefault(confReader, "LOGIN LOCKOUT", "Max_Lockout_Seconds", 3600)
+	if err == nil && lockoutMaxLockoutSeconds < 0 {
+		err = errors.New("should not be negative")
+	}
+	if err != nil {
+		return errors.New("read [LOGIN LOCKOUT] Max_Lockout_Seconds failed: " + err.Error())
+	}
+	conf.lockoutMaxLockout = time.Duration(lockoutMaxLockoutSeconds) * time.Second
+
+	// Params of two-factor authentication
+
+	// Issuer and file path are optional
+	conf.mfaIssuer = conf.GetOptionalString(confReader, "MFA", "Issuer")
+	if conf.mfaIssuer == "" {
+		conf.mfaIssuer = "gin-api-server"
+	}
+
+	mfaFilePath := conf.GetOptionalString(confReader, "MFA", "File_Path")
+	if mfaFilePath == "" {
+		mfaFilePath = "configs/api/.secret/mfa.json"
+	}
+	conf.mfaFilePath = path.Join(rootPath, mfaFilePath)
+
+	conf.mfaRequiredByAdmin = conf.GetOptionalBool(confReader, "MFA", "Admin_Require_MFA")
+
+	// Params of browser session
+
+	conf.sessionCookieMode = conf.GetOptionalBool(confReader, "SESSION", "Cookie_Mode")
+
+	// Cookie names and same site are only needed in cookie mode
+	if conf.sessionCookieMode {
+		sessionCookieName, err := conf.GetString(confReader, "SESSION", "Cookie_Name")
+		if err != nil {
+			return errors.New("read [SESSION] Cookie_Name failed: " + err.Error())
+		}
+		conf.sessionCookieName = sessionCookieName
+
+		sessionCSRFCookieName, err := conf.GetString(confReader, "SESSION", "CSRF_Cookie_Name")
+		if err != nil {
+			return errors.New("read [SESSION] CSRF_Cookie_Name failed: " + err.Error())
+		}
+		conf.sessionCSRFCookieName = sessionCSRFCookieName
+
+		sessionSameSite, err := conf.GetString(confReader, "SESSION", "Same_Site")
+		if err != nil {
+			return errors.New("read [SESSION] Same_Site failed: " + err.Error())
+		}
+		if sessionSameSite != "Strict" && sessionSameSite != "Lax" && sessionSameSite != "None" {
+			return errors.New("read [SESSION] Same_Site failed: should be Strict, Lax or None")
+		}
+		conf.sessionSameSite = sessionSameSite
+
+		conf.sessionCookieDomain = conf.GetOptionalString(confReader, "SESSION", "Cookie_Domain")
+	}
+
+	// Params of cors
+
+	// Allowed origins are optional, separated by comma
+	conf.corsAllowedOrigins = splitList(conf.GetOptionalString(confReader, "CORS", "Allowed_Origins"))
+
+	// Params of self-service accounts
+
+	conf.registrationEnabled = conf.GetOptionalBool(confReader, "ACCOUNT", "Registration_Enabled")
+
+	resetTokenTTLMinutes, err := conf.GetOptionalIntDefault(confReader, "ACCOUNT", "Reset_Token_TTL_Minutes", 30)
+	if err == nil && resetTokenTTLMinutes <= 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [ACCOUNT] Reset_Token_TTL_Minutes failed: " + err.Error())
+	}
+	conf.resetTokenTTL = time.Duration(resetTokenTTLMinutes) * time.Minute
+
+	// Notifier is optional, file notifier is the default
+	conf.notifier = conf.GetOptionalString(confReader, "ACCOUNT", "Notifier")
+	if conf.notifier == "" {
+		conf.notifier = "file"
+	}
+
+	// Notifier file is only needed by file notifier
+	if conf.notifier == "file" {
+		notifierFilePath := conf.GetOptionalString(confReader, "ACCOUNT", "Notifier_File_Path")
+		if notifierFilePath == "" {
+			notifierFilePath = "logFiles/Notify/notify.log"
+		}
+		conf.notifierFilePath = path.Join(rootPath, notifierFilePath)
+	}
+
+	passwordMinLength, err := conf.GetOptionalIntDefault(confReader, "ACCOUNT", "Password_Min_Length", 12)
+	if err == nil && passwordMinLength <= 0 {
+		err = errors.New("should be greater than 0")
+	}
+	if err != nil {
+		return errors.New("read [ACCOUNT] Password_Min_Length failed: " + err.Error())
+	}
+	conf.passwordMinLength = passwordMinLength
+
+	conf.passwordRequireUpper = conf.GetOptionalBool(confReader, "ACCOUNT", "Password_Require_Upper")
+	conf.passwordRequireLower = conf.GetOptionalBool(confReader, "ACCOUNT", "Password_Require_Lower")
+	conf.passwordRequireDigit = conf.GetOptionalBool(confReader, "ACCOUNT", "Password_Require_Digit")
+	conf.passwordRequireSymbol = conf.GetOptionalBool(confReader, "ACCOUNT", "Password_Require_Symbol")
+
+	// Params of tenants, all keys of tenant section are optional
+
+	conf.tenants = []TenantConf{}
+	for _, section := range confReader.Sections() {
+		if !strings.HasPrefix(section.Name(), "TENANT ") {
+			continue
+		}
+
+		sectionName := section.Name()
+		tenantName := strings.TrimSpace(strings.TrimPrefix(sectionName, "TENANT "))
+		if tenantName == "" {
+			return errors.New("read [" + sectionName + "] failed: no tenant name")
+		}
+
+		// 0 of access token TTL is the default TTL, 0 of requests per minute is no limit
+		tenantAccessTokenTTLMinutes, err := conf.GetOptionalIntDefault(confReader, sectionName, "Access_Token_TTL_Minutes", 0)
+		if err == nil && tenantAccessTokenTTLMinutes < 0 {
+			err = errors.New("should not be negative")
+		}
+		if err != nil {
+			return errors.New("read [" + sectionName + "] Access_Token_TTL_Minutes failed: " + err.Error())
+		}
+
+		tenantRequestsPerMinute, err := conf.GetOptionalIntDefault(confReader, sectionName, "Requests_Per_Minute", 0)
+		if err == nil && tenantRequestsPerMinute < 0 {
+			err = errors.New("should not be negative")
+		}
+		if err != nil {
+			return errors.New("read [" + sectionName + "] Requests_Per_Minute failed: " + err.Error())
+		}
+
+		tenantConf := TenantConf{
+			Name:              tenantName,
+			ServiceName:       conf.GetOptionalString(confReader, sectionName, "Service_Name"),
+			AccessTokenTTL:    time.Duration(tenantAccessTokenTTLMinutes) * time.Minute,
+			RequestsPerMinute: tenantRequestsPerMinute,
+			AllowedRoles:      splitList(conf.GetOptionalString(confReader, sectionName, "Allowed_Roles")),
+		}
+
+		conf.tenants = append(conf.tenants, tenantConf)
+	}
+
+	// Params of audit log
+
+	auditLogPath, err := conf.GetString(confReader, "AUDIT", "Log_Path")
+	if err != nil {
+		return errors.New("read [AUDIT] Log_Path failed: " + err.Error())
+	}
+	conf.auditLogPath = path.Join(rootPath, auditLogPath)
+
+	auditRotationHours, err := conf.GetInt(confReader, "AUDIT", "Rotation_Hours")
+	if err != nil {
+		return errors.New("read [AUDIT] Rotation_Hours failed: " + err.Error())
+	}
+	conf.auditRotationTime = time.Duration(auditRotationHours) * time.Hour
+
+	auditRetentionDays, err := conf.GetInt(confReader, "AUDIT", "Retention_Days")
+	if err != nil {
+		return errors.New("read [AUDIT] Retention_Days failed: " + err.Error())
+	}
+	conf.auditRetention = time.Duration(auditRetentionDays) * 24 * time.Hour
+
 	// Params of log file stored path
 
 	infoDebugLogPath, err := conf.GetString(confReader, "FILE STORED PATH", "Info_Debug_Log_Path")
@@ -126,16 +714,129 @@ func (conf *Conf) LoggerCfg() LoggerConf {
 
 func (conf *Conf) APICfg() APIConf {
 	apiConf := APIConf{
-		APIServiceName: conf.apiServiceName,
-		APIMode:        conf.apiMode,
-		APIProtocol:    conf.apiProtocol,
-		APIHost:        conf.apiHost,
-		APIPort:        conf.apiPort,
-		APIKeyFilePath: conf.apiKeyFilePath,
+		APIServiceName:        conf.apiServiceName,
+		APIMode:               conf.apiMode,
+		APIProtocol:           conf.apiProtocol,
+		APIHost:               conf.apiHost,
+		APIPort:               conf.apiPort,
+		APIKeyFilePath:        conf.apiKeyFilePath,
+		APIKeyPollInterval:    conf.apiKeyPollInterval,
+		APIKeyHMACKeyFilePath: conf.apiKeyHMACKeyFilePath,
+		TrustedProxies:        conf.trustedProxies,
+		SignatureMaxSkew:      conf.signatureMaxSkew,
+		SignedBodyMaxBytes:    conf.signedBodyMaxBytes,
 	}
 	return apiConf
 }
 
+func (conf *Conf) TLSCfg() TLSConf {
+	tlsConf := TLSConf{
+		CertFilePath:      conf.tlsCertFilePath,
+		KeyFilePath:       conf.tlsKeyFilePath,
+		ClientAuth:        conf.clientAuth,
+		ClientCAFilePath:  conf.clientCAFilePath,
+		ClientMapFilePath: conf.clientMapFilePath,
+	}
+	return tlsConf
+}
+
+func (conf *Conf) AuthCfg() AuthConf {
+	authConf := AuthConf{
+		Backend:        conf.authBackend,
+		UserFilePath:   conf.authUserFilePath,
+		PolicyFilePath: conf.policyFilePath,
+	}
+	return authConf
+}
+
+func (conf *Conf) TokenCfg() TokenConf {
+	tokenConf := TokenConf{
+		AccessTokenTTL:          conf.accessTokenTTL,
+		Issuer:                  conf.tokenIssuer,
+		Audience:                conf.tokenAudience,
+		Leeway:                  conf.tokenLeeway,
+		AllowedAlgorithms:       conf.tokenAlgorithms,
+		RequiredClaims:          conf.tokenRequiredClaims,
+		RefreshTokenTTL:         conf.refreshTokenTTL,
+		ImpersonationTokenTTL:   conf.impersonationTokenTTL,
+		RevocationBackend:       conf.revocationBackend,
+		RevocationFilePath:      conf.revocationFilePath,
+		Format:                  conf.tokenFormat,
+		SessionBackend:          conf.sessionBackend,
+		SessionFilePath:         conf.sessionFilePath,
+		BindToClient:            conf.tokenBindToClient,
+		KeysetFilePath:          conf.keysetFilePath,
+		ExternalIssuersFilePath: conf.externalIssuersFilePath,
+	}
+	return tokenConf
+}
+
+func (conf *Conf) LockoutCfg() LockoutConf {
+	lockoutConf := LockoutConf{
+		AccountMaxFailures: conf.lockoutAccountMaxFailures,
+		IPMaxFailures:      conf.lockoutIPMaxFailures,
+		FailureWindow:      conf.lockoutFailureWindow,
+		BaseLockout:        conf.lockoutBaseLockout,
+		MaxLockout:         conf.lockoutMaxLockout,
+	}
+	return lockoutConf
+}
+
+func (conf *Conf) MFACfg() MFAConf {
+	mfaConf := MFAConf{
+		Issuer:          conf.mfaIssuer,
+		FilePath:        conf.mfaFilePath,
+		RequiredByAdmin: conf.mfaRequiredByAdmin,
+	}
+	return mfaConf
+}
+
+func (conf *Conf) SessionCfg() SessionConf {
+	sessionConf := SessionConf{
+		CookieMode:     conf.sessionCookieMode,
+		CookieName:     conf.sessionCookieName,
+		CSRFCookieName: conf.sessionCSRFCookieName,
+		SameSite:       conf.sessionSameSite,
+		CookieDomain:   conf.sessionCookieDomain,
+	}
+	return sessionConf
+}
+
+func (conf *Conf) AccountCfg() AccountConf {
+	accountConf := AccountConf{
+		RegistrationEnabled:   conf.registrationEnabled,
+		ResetTokenTTL:         conf.resetTokenTTL,
+		Notifier:              conf.notifier,
+		NotifierFilePath:      conf.notifierFilePath,
+		PasswordMinLength:     conf.passwordMinLength,
+		PasswordRequireUpper:  conf.passwordRequireUpper,
+		PasswordRequireLower:  conf.passwordRequireLower,
+		PasswordRequireDigit:  conf.passwordRequireDigit,
+		PasswordRequireSymbol: conf.passwordRequireSymbol,
+	}
+	return accountConf
+}
+
+func (conf *Conf) TenantsCfg() []TenantConf {
+	return conf.tenants
+}
+
+func (conf *Conf) AuditCfg() AuditConf {
+	auditConf := AuditConf{
+		LogPath:      conf.auditLogPath,
+		RotationTime: conf.auditRotationTime,
+		Retention:    conf.auditRetention,
+	}
+	return auditConf
+}
+
+func (conf *Conf) CORSCfg() CORSConf {
+	corsConf := CORSConf{
+		AllowedOrigins: conf.corsAllowedOrigins,
+	}
+	return corsConf
+}
+
 // GetString read string from section with key
 func (conf *Conf) GetString(confReader *ini.File, section string, key string) (string, error) {
 	if confReader == nil {
@@ -155,6 +856,57 @@ func (conf *Conf) GetString(confReader *ini.File, section string, key string) (s
 	return value, nil
 }
 
+// GetOptionalString read string from section with key, and returns empty string if not exists
+func (conf *Conf) GetOptionalString(confReader *ini.File, section string, key string) string {
+	if confReader == nil {
+		return ""
+	}
+
+	return confReader.Section(section).Key(key).String()
+}
+
+// GetOptionalBool read bool from section with key, and returns false if not exists or not a bool
+func (conf *Conf) GetOptionalBool(confReader *ini.File, section string, key string) bool {
+	if confReader == nil {
+		return false
+	}
+
+	value, _ := confReader.Section(section).Key(key).Bool()
+
+	return value
+}
+
+// GetOptionalInt read int from section with key, and returns 0 if not exists or not an int
+func (conf *Conf) GetOptionalInt(confReader *ini.File, section string, key string) int {
+	if confReader == nil {
+		return 0
+	}
+
+	value, _ := confReader.Section(section).Key(key).Int()
+
+	return value
+}
+
+// GetOptionalIntDefault read int from section with key, and returns defaultValue if not exists.
+// Unlike GetInt, 0 is a valid value.
+func (conf *Conf) GetOptionalIntDefault(confReader *ini.File, section string, key string, defaultValue int) (int, error) {
+	if confReader == nil {
+		return defaultValue, nil
+	}
+
+	k := confReader.Section(section).Key(key)
+	if k.String() == "" {
+		return defaultValue, nil
+	}
+
+	value, err := k.Int()
+	if err != nil {
+		return 0, errors.New("not an int")
+	}
+
+	return value, nil
+}
+
 // GetInt read int from section with key
 func (conf *Conf) GetInt(confReader *ini.File, section string, key string) (int, error) {
 	if confReader == nil {
@@ -174,3 +926,16 @@ func (conf *Conf) GetInt(confReader *ini.File, section string, key string) (int,
 
 	return valueInt, nil
 }
+
+// splitList splits comma separated value, and drops empty items
+func splitList(value string) []string {
+
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,91 @@
+package keyset
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadKeySetFile reads keyset file without parsing keys, missing file is an empty keyset
+func ReadKeySetFile(filePath string) (KeySetFile, error) {
+
+	file := KeySetFile{Keys: []KeyEntry{}}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return file, errors.New("read keyset file failed: " + err.Error())
+	}
+
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return file, errors.New("parse keyset file failed: " + err.Error())
+	}
+
+	return file, nil
+}
+
+// GenerateKeyEntry generates a new key of alg.
+// HMAC secret is kept in entry, private key of other algs is written to <kid>.pem in keySetDir, readable by owner only.
+func GenerateKeyEntry(kid, alg, keySetDir string) (KeyEntry, error) {
+
+	entry := KeyEntry{Kid: kid, Alg: alg}
+
+	var privateKey interface{}
+	var err error
+
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return entry, errors.New("generate secret failed: " + err.Error())
+		}
+		entry.Secret = base64.StdEncoding.EncodeToString(secret)
+		return entry, nil
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 3072)
+	case "ES256":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return entry, errors.New("no such alg: " + alg)
+	}
+	if err != nil {
+		return entry, errors.New("generate private key failed: " + err.Error())
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return entry, errors.New("marshal private key failed: " + err.Error())
+	}
+
+	// Never overwrite key file, it may be a trusted key of another kid
+	entry.PrivateKeyFile = kid + ".pem"
+	keyFile, err := os.OpenFile(filepath.Join(keySetDir, entry.PrivateKeyFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return entry, errors.New("create key file failed: " + err.Error())
+	}
+	defer keyFile.Close()
+
+	if err := pem.Encode(keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return entry, errors.New("write key file failed: " + err.Error())
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,153 @@
+package keyset
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty" example:"EC"`
+	Kid string `json:"kid" example:"es-2021-08"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"ES256"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty" example:"P-256"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a set of JWK
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public keys of all asymmetric keys, HMAC keys are never published
+func (ks *KeySet) JWKS() JWKSet {
+
+	jwks := JWKSet{Keys: []JWK{}}
+
+	for _, key := range ks.keys {
+		jwk, ok := publicJWK(key)
+		if ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	// Keep order stable
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func publicJWK(key Key) (JWK, bool) {
+
+	jwk := JWK{
+		Kid: key.Kid,
+		Use: "sig",
+		Alg: key.Method.Alg(),
+	}
+
+	switch publicKey := key.VerifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBigInt(publicKey.N, 0)
+		jwk.E = encodeBigInt(big.NewInt(int64(publicKey.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = encodeBigInt(publicKey.X, size)
+		jwk.Y = encodeBigInt(publicKey.Y, size)
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return jwk, false
+	}
+
+	return jwk, true
+}
+
+// PublicKey returns public key of JWK, which is *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+func (jwk JWK) PublicKey() (interface{}, error) {
+
+	switch jwk.Kty {
+	case "RSA":
+		n, errN := decodeBigInt(jwk.N)
+		e, errE := decodeBigInt(jwk.E)
+		if errN != nil || errE != nil || !e.IsInt64() {
+			return nil, errors.New("jwk " + jwk.Kid + " has malformed rsa key")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.New("jwk " + jwk.Kid + " rsa key should be at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("jwk " + jwk.Kid + " has unsupported curve " + jwk.Crv)
+		}
+		x, errX := decodeBigInt(jwk.X)
+		y, errY := decodeBigInt(jwk.Y)
+		if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("jwk " + jwk.Kid + " has malformed ec key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk " + jwk.Kid + " has malformed or unsupported okp key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, errors.New("jwk " + jwk.Kid + " has unsupported kty " + jwk.Kty)
+	}
+}
+
+// decodeBigInt decodes base64url big int
+func decodeBigInt(s string) (*big.Int, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// encodeBigInt encodes big int in base64url, left padded with zero to size bytes
+func encodeBigInt(n *big.Int, size int) string {
+
+	b := n.Bytes()
+	if len(b) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		b = padded
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
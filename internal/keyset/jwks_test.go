@@ -0,0 +1,164 @@
+package keyset
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+func TestJWKSRoundTrip(t *testing.T) {
+
+	dir := t.TempDir()
+	entries := generateKeyFiles(t, dir, map[string]string{"hs256": "HS256", "es256": "ES256", "es521": "ES512", "eddsa": "EdDSA"})
+
+	filePath := filepath.Join(dir, "keyset.json")
+	file := KeySetFile{ActiveKid: "es256", Keys: []KeyEntry{entries["hs256"], entries["es256"], entries["es521"], entries["eddsa"]}}
+	if err := utils.WriteJsonFileAtomic(filePath, file); err != nil {
+		t.Fatal(err)
+	}
+
+	keySet, err := LoadKeySet(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := keySet.JWKS()
+
+	// HMAC keys are never published, and keys are sorted by kid
+	kids := []string{}
+	for _, jwk := range jwks.Keys {
+		kids = append(kids, jwk.Kid)
+	}
+	if want := []string{"eddsa", "es256", "es521"}; !reflect.DeepEqual(kids, want) {
+		t.Fatalf("JWKS() kids = %v, want %v", kids, want)
+	}
+
+	for _, jwk := range jwks.Keys {
+		t.Run(jwk.Kid, func(t *testing.T) {
+			key, _ := keySet.VerificationKey(jwk.Kid)
+			if jwk.Alg != key.Method.Alg() || jwk.Use != "sig" {
+				t.Errorf("JWK alg = %s use = %s, want alg %s use sig", jwk.Alg, jwk.Use, key.Method.Alg())
+			}
+
+			publicKey, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(publicKey, key.VerifyKey) {
+				t.Errorf("PublicKey() = %v, want %v", publicKey, key.VerifyKey)
+			}
+		})
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaJWK, _ := publicJWK(Key{Kid: "rs", Method: jwt.SigningMethodRS256, VerifyKey: &rsaKey.PublicKey})
+	smallRSAJWK, _ := publicJWK(Key{Kid: "rs-small", Method: jwt.SigningMethodRS256, VerifyKey: &smallRSAKey.PublicKey})
+	ecJWK, _ := publicJWK(Key{Kid: "es", Method: jwt.SigningMethodES256, VerifyKey: &ecKey.PublicKey})
+	edJWK, _ := publicJWK(Key{Kid: "ed", Method: SigningMethodEd25519, VerifyKey: edPublicKey})
+
+	// Point which is not on curve P-256
+	offCurveJWK := ecJWK
+	offCurveJWK.Y = base64.RawURLEncoding.EncodeToString([]byte{1})
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		want    interface{}
+		wantErr bool
+	}{
+		{"rsa", rsaJWK, &rsaKey.PublicKey, false},
+		{"ec", ecJWK, &ecKey.PublicKey, false},
+		{"ed25519", edJWK, edPublicKey, false},
+		{"rsa under 2048 bits", smallRSAJWK, nil, true},
+		{"rsa without exponent", JWK{Kty: "RSA", N: rsaJWK.N}, nil, true},
+		{"rsa malformed modulus", JWK{Kty: "RSA", N: "!!", E: rsaJWK.E}, nil, true},
+		{"ec point not on curve", offCurveJWK, nil, true},
+		{"ec unsupported curve", JWK{Kty: "EC", Crv: "secp256k1", X: ecJWK.X, Y: ecJWK.Y}, nil, true},
+		{"ec curve of other size", JWK{Kty: "EC", Crv: "P-384", X: ecJWK.X, Y: ecJWK.Y}, nil, true},
+		{"okp unsupported curve", JWK{Kty: "OKP", Crv: "X25519", X: edJWK.X}, nil, true},
+		{"okp short key", JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPublicKey[:16])}, nil, true},
+		{"symmetric key", JWK{Kty: "oct"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.jwk.PublicKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSigningMethodEdDSA(t *testing.T) {
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := SigningMethodEd25519.Sign("header.payload", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		signingString string
+		key           interface{}
+		wantErr       error
+	}{
+		{"valid signature", "header.payload", publicKey, nil},
+		{"other signing string", "header.other", publicKey, jwt.ErrSignatureInvalid},
+		{"other key", "header.payload", otherPublicKey, jwt.ErrSignatureInvalid},
+		{"hmac secret as key", "header.payload", []byte("secret"), jwt.ErrInvalidKeyType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SigningMethodEd25519.Verify(tt.signingString, signature, tt.key); err != tt.wantErr {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := SigningMethodEd25519.Sign("header.payload", []byte("secret")); err != jwt.ErrInvalidKeyType {
+		t.Errorf("Sign() with hmac secret error = %v, want %v", err, jwt.ErrInvalidKeyType)
+	}
+}
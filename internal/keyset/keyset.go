@@ -0,0 +1,245 @@
+package keyset
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Key entry format in keyset file.
+// HMAC keys (HS256/HS384/HS512) use Secret.
+// RSA (RS*/PS*), ECDSA (ES256/ES384/ES512) and Ed25519 (EdDSA) keys use PEM files,
+// a key with only PublicKeyFile can verify tokens but can not be active.
+// Relative key file paths are relative to the folder of keyset file.
+type KeyEntry struct {
+	Kid            string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret,omitempty"` // base64 encoded secret of HMAC key
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// Keyset file format.
+// Tokens are signed with the key of ActiveKid, and all keys are trusted in validation.
+// To rotate key, add new key and set it active, then remove old key after its tokens expired.
+type KeySetFile struct {
+	ActiveKid string     `json:"active_kid"`
+	Keys      []KeyEntry `json:"keys"`
+}
+
+// Kid and secret of placeholder key in jwt_keyset.example.json
+const (
+	SampleKid    = "sample-kid"
+	SampleSecret = "REPLACE_WITH_BASE64_OF_32_RANDOM_BYTES"
+)
+
+// Keys which were published with this repository, anyone can sign tokens with them
+var publishedKids = []string{SampleKid, "hs-2021-08", "es-2021-08"}
+var publishedSecrets = []string{SampleSecret, "fut6ncFvCA5pl2F4GgH2JUY3xtUexgYMfdcRHlnoruI="}
+
+// Key is a parsed key used to sign or verify JWT
+type Key struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// KeySet keeps signing key and all trusted keys
+type KeySet struct {
+	activeKid string
+	keys      map[string]Key
+}
+
+// LoadKeySet reads keyset file and returns key set
+func LoadKeySet(filePath string) (*KeySet, error) {
+
+	// Read keyset file
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read keyset file failed: " + err.Error())
+	}
+
+	var file KeySetFile
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return nil, errors.New("parse keyset file failed: " + err.Error())
+	}
+
+	keySet := &KeySet{
+		activeKid: file.ActiveKid,
+		keys:      map[string]Key{},
+	}
+
+	// Parse all key entries
+	for _, entry := range file.Keys {
+		if entry.Kid == "" {
+			return nil, errors.New("keyset has key without kid")
+		}
+		if _, ok := keySet.keys[entry.Kid]; ok {
+			return nil, errors.New("keyset has duplicated kid " + entry.Kid)
+		}
+		if containsString(publishedKids, entry.Kid) || containsString(publishedSecrets, entry.Secret) {
+			return nil, errors.New("keyset has published sample key " + entry.Kid + ", generate your own keys")
+		}
+
+		key, err := parseKeyEntry(entry, filepath.Dir(filePath))
+		if err != nil {
+			return nil, errors.New("parse key " + entry.Kid + " failed: " + err.Error())
+		}
+		keySet.keys[entry.Kid] = key
+	}
+
+	// Check active key exists and can sign
+	activeKey, ok := keySet.keys[file.ActiveKid]
+	if !ok {
+		return nil, errors.New("active kid " + file.ActiveKid + " not in keyset")
+	}
+	if activeKey.SignKey == nil {
+		return nil, errors.New("active kid " + file.ActiveKid + " has no private key")
+	}
+
+	return keySet, nil
+}
+
+// SigningKey returns active key which is used to sign token
+func (ks *KeySet) SigningKey() Key {
+	return ks.keys[ks.activeKid]
+}
+
+// VerificationKey returns trusted key with kid
+func (ks *KeySet) VerificationKey(kid string) (Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Algorithms returns algorithms of trusted keys
+func (ks *KeySet) Algorithms() []string {
+
+	algorithms := []string{}
+	seen := map[string]bool{}
+	for _, key := range ks.keys {
+		alg := key.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	sort.Strings(algorithms)
+
+	return algorithms
+}
+
+// parseKeyEntry parses key material by alg of entry
+func parseKeyEntry(entry KeyEntry, keySetDir string) (Key, error) {
+
+	key := Key{Kid: entry.Kid}
+
+	switch entry.Alg {
+	case "HS256", "HS384", "HS512":
+		secret, err := base64.StdEncoding.DecodeString(entry.Secret)
+		if err != nil {
+			return key, errors.New("secret is not base64 encoded")
+		}
+		if len(secret) < 32 {
+			return key, errors.New("secret should be at least 32 bytes")
+		}
+		key.Method = jwt.GetSigningMethod(entry.Alg)
+		key.SignKey = secret
+		key.VerifyKey = secret
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA":
+		key.Method = jwt.GetSigningMethod(entry.Alg)
+		if err := parseAsymmetricKey(&key, entry, keySetDir); err != nil {
+			return key, err
+		}
+	default:
+		return key, errors.New("no such alg: " + entry.Alg)
+	}
+
+	return key, nil
+}
+
+// parseAsymmetricKey reads key files of entry and checks key type met alg
+func parseAsymmetricKey(key *Key, entry KeyEntry, keySetDir string) error {
+
+	var publicKey crypto.PublicKey
+
+	if entry.PrivateKeyFile != "" {
+		privateKey, err := readPrivateKeyFile(resolvePath(keySetDir, entry.PrivateKeyFile))
+		if err != nil {
+			return err
+		}
+		key.SignKey = privateKey
+		publicKey = privateKey.Public()
+	} else if entry.PublicKeyFile != "" {
+		var err error
+		publicKey, err = readPublicKeyFile(resolvePath(keySetDir, entry.PublicKeyFile))
+		if err != nil {
+			return err
+		}
+	} else {
+		return errors.New("private_key_file or public_key_file is required")
+	}
+
+	if err := checkKeyType(entry.Alg, publicKey); err != nil {
+		return err
+	}
+	key.VerifyKey = publicKey
+
+	return nil
+}
+
+// checkKeyType checks public key type and curve met alg
+func checkKeyType(alg string, publicKey crypto.PublicKey) error {
+
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New(alg + " needs RSA key")
+		}
+		if rsaKey.N.BitLen() < 2048 {
+			return errors.New("RSA key should be at least 2048 bits")
+		}
+	case "ES256", "ES384", "ES512":
+		ecKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New(alg + " needs ECDSA key")
+		}
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		if ecKey.Curve != curves[alg] {
+			return errors.New(alg + " needs curve " + curves[alg].Params().Name)
+		}
+	case "EdDSA":
+		if _, ok := publicKey.(ed25519.PublicKey); !ok {
+			return errors.New(alg + " needs Ed25519 key")
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func resolvePath(dir, filePath string) string {
+	if filepath.IsAbs(filePath) {
+		return filePath
+	}
+	return filepath.Join(dir, filePath)
+}
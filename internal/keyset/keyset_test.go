@@ -0,0 +1,231 @@
+package keyset
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// generateKeyFiles generates keys of algs in dir, and writes public key of the ES256 one to es256.pub.pem
+func generateKeyFiles(t *testing.T, dir string, algs map[string]string) map[string]KeyEntry {
+
+	entries := map[string]KeyEntry{}
+	for kid, alg := range algs {
+		entry, err := GenerateKeyEntry(kid, alg, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[kid] = entry
+	}
+
+	privateKey, err := readPrivateKeyFile(filepath.Join(dir, "es256.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "es256.pub.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return entries
+}
+
+func TestLoadKeySet(t *testing.T) {
+
+	dir := t.TempDir()
+	entries := generateKeyFiles(t, dir, map[string]string{"hs256": "HS256", "es256": "ES256", "eddsa": "EdDSA"})
+
+	shortSecret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	tests := []struct {
+		name    string
+		file    KeySetFile
+		wantErr string
+	}{
+		{
+			name: "hmac, ecdsa and ed25519 keys",
+			file: KeySetFile{ActiveKid: "es256", Keys: []KeyEntry{entries["hs256"], entries["es256"], entries["eddsa"]}},
+		},
+		{
+			name: "public only key is trusted",
+			file: KeySetFile{ActiveKid: "hs256", Keys: []KeyEntry{entries["hs256"], {Kid: "es256-pub", Alg: "ES256", PublicKeyFile: "es256.pub.pem"}}},
+		},
+		{
+			name:    "key without kid",
+			file:    KeySetFile{ActiveKid: "hs256", Keys: []KeyEntry{entries["hs256"], {Alg: "HS256", Secret: entries["hs256"].Secret}}},
+			wantErr: "keyset has key without kid",
+		},
+		{
+			name:    "duplicated kid",
+			file:    KeySetFile{ActiveKid: "hs256", Keys: []KeyEntry{entries["hs256"], entries["hs256"]}},
+			wantErr: "keyset has duplicated kid hs256",
+		},
+		{
+			name:    "published sample kid",
+			file:    KeySetFile{ActiveKid: SampleKid, Keys: []KeyEntry{{Kid: SampleKid, Alg: "HS256", Secret: entries["hs256"].Secret}}},
+			wantErr: "published sample key",
+		},
+		{
+			name:    "published secret",
+			file:    KeySetFile{ActiveKid: "hs", Keys: []KeyEntry{{Kid: "hs", Alg: "HS256", Secret: publishedSecrets[1]}}},
+			wantErr: "published sample key",
+		},
+		{
+			name:    "secret not base64",
+			file:    KeySetFile{ActiveKid: "hs", Keys: []KeyEntry{{Kid: "hs", Alg: "HS256", Secret: "not base64!"}}},
+			wantErr: "secret is not base64 encoded",
+		},
+		{
+			name:    "short secret",
+			file:    KeySetFile{ActiveKid: "hs", Keys: []KeyEntry{{Kid: "hs", Alg: "HS256", Secret: shortSecret}}},
+			wantErr: "secret should be at least 32 bytes",
+		},
+		{
+			name:    "unknown alg",
+			file:    KeySetFile{ActiveKid: "hs", Keys: []KeyEntry{{Kid: "hs", Alg: "none", Secret: entries["hs256"].Secret}}},
+			wantErr: "no such alg: none",
+		},
+		{
+			name:    "asymmetric key without key file",
+			file:    KeySetFile{ActiveKid: "hs256", Keys: []KeyEntry{entries["hs256"], {Kid: "es", Alg: "ES256"}}},
+			wantErr: "private_key_file or public_key_file is required",
+		},
+		{
+			name:    "missing key file",
+			file:    KeySetFile{ActiveKid: "es", Keys: []KeyEntry{{Kid: "es", Alg: "ES256", PrivateKeyFile: "missing.pem"}}},
+			wantErr: "read key file failed",
+		},
+		{
+			name:    "curve does not meet alg",
+			file:    KeySetFile{ActiveKid: "es", Keys: []KeyEntry{{Kid: "es", Alg: "ES384", PrivateKeyFile: "es256.pem"}}},
+			wantErr: "ES384 needs curve P-384",
+		},
+		{
+			name:    "key type does not meet alg",
+			file:    KeySetFile{ActiveKid: "rs", Keys: []KeyEntry{{Kid: "rs", Alg: "RS256", PrivateKeyFile: "es256.pem"}}},
+			wantErr: "RS256 needs RSA key",
+		},
+		{
+			name:    "ed25519 key of ecdsa alg",
+			file:    KeySetFile{ActiveKid: "es", Keys: []KeyEntry{{Kid: "es", Alg: "ES256", PrivateKeyFile: "eddsa.pem"}}},
+			wantErr: "ES256 needs ECDSA key",
+		},
+		{
+			name:    "active kid not in keyset",
+			file:    KeySetFile{ActiveKid: "missing", Keys: []KeyEntry{entries["hs256"]}},
+			wantErr: "active kid missing not in keyset",
+		},
+		{
+			name:    "active key without private key",
+			file:    KeySetFile{ActiveKid: "es256-pub", Keys: []KeyEntry{{Kid: "es256-pub", Alg: "ES256", PublicKeyFile: "es256.pub.pem"}}},
+			wantErr: "active kid es256-pub has no private key",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(dir, "keyset-"+strconv.Itoa(i)+".json")
+			if err := utils.WriteJsonFileAtomic(filePath, tt.file); err != nil {
+				t.Fatal(err)
+			}
+
+			keySet, err := LoadKeySet(filePath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadKeySet() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadKeySet() error = %v", err)
+			}
+
+			if got := keySet.SigningKey().Kid; got != tt.file.ActiveKid {
+				t.Errorf("SigningKey() kid = %s, want %s", got, tt.file.ActiveKid)
+			}
+			for _, entry := range tt.file.Keys {
+				key, ok := keySet.VerificationKey(entry.Kid)
+				if !ok || key.Method.Alg() != entry.Alg {
+					t.Errorf("VerificationKey(%s) = %v, %v, want key of alg %s", entry.Kid, key.Method, ok, entry.Alg)
+				}
+			}
+		})
+	}
+}
+
+func TestKeySetAlgorithms(t *testing.T) {
+
+	dir := t.TempDir()
+	entries := generateKeyFiles(t, dir, map[string]string{"hs256": "HS256", "hs256-2": "HS256", "es256": "ES256"})
+
+	filePath := filepath.Join(dir, "keyset.json")
+	file := KeySetFile{ActiveKid: "es256", Keys: []KeyEntry{entries["hs256"], entries["hs256-2"], entries["es256"]}}
+	if err := utils.WriteJsonFileAtomic(filePath, file); err != nil {
+		t.Fatal(err)
+	}
+
+	keySet, err := LoadKeySet(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := keySet.Algorithms(), []string{"ES256", "HS256"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Algorithms() = %v, want %v", got, want)
+	}
+	if _, ok := keySet.VerificationKey("missing"); ok {
+		t.Error("VerificationKey() of unknown kid is found")
+	}
+}
+
+func TestGenerateKeyEntry(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		kid         string
+		alg         string
+		wantKeyFile bool
+		wantErr     bool
+	}{
+		{"hs512", "HS512", false, false},
+		{"es384", "ES384", true, false},
+		{"es512", "ES512", true, false},
+		{"eddsa", "EdDSA", true, false},
+		{"none", "none", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			entry, err := GenerateKeyEntry(tt.kid, tt.alg, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateKeyEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if (entry.PrivateKeyFile != "") != tt.wantKeyFile || (entry.Secret != "") == tt.wantKeyFile {
+				t.Errorf("GenerateKeyEntry() = %+v, want key file %v", entry, tt.wantKeyFile)
+			}
+			if _, err := parseKeyEntry(entry, dir); err != nil {
+				t.Errorf("parseKeyEntry() of generated entry error = %v", err)
+			}
+		})
+	}
+
+	// Existing key file is never overwritten
+	if _, err := GenerateKeyEntry("es384", "ES384", dir); err == nil {
+		t.Error("GenerateKeyEntry() of existing key file error = nil, want error")
+	}
+}
@@ -0,0 +1,74 @@
+package keyset
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+)
+
+// readPrivateKeyFile reads PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key in PEM file
+func readPrivateKeyFile(filePath string) (crypto.Signer, error) {
+
+	block, err := readPEMFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("unsupported private key type")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("private key is not PKCS#8, PKCS#1 or SEC 1 format")
+}
+
+// readPublicKeyFile reads PKIX public key in PEM file
+func readPublicKeyFile(filePath string) (crypto.PublicKey, error) {
+
+	block, err := readPEMFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("public key is not PKIX format: " + err.Error())
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+}
+
+func readPEMFile(filePath string) (*pem.Block, error) {
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read key file failed: " + err.Error())
+	}
+
+	block, _ := pem.Decode(byteValue)
+	if block == nil {
+		return nil, errors.New("key file is not PEM format")
+	}
+
+	return block, nil
+}
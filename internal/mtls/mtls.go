@@ -0,0 +1,135 @@
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+)
+
+// Client auth modes in config
+const (
+	ClientAuthAPIKey = "apikey" // X-API-Key only
+	ClientAuthMTLS   = "mtls"   // client certificate only
+	ClientAuthBoth   = "both"   // client certificate if presented, otherwise X-API-Key
+)
+
+// ClientRule maps client certificate to client.
+// All non-empty match fields should match, Scopes and Routes restrict the client like fields of API key.
+type ClientRule struct {
+	Client    string   `json:"client"`
+	Tenant    string   `json:"tenant,omitempty"` // tenant of client, empty: no tenant
+	SubjectCN string   `json:"subject_cn,omitempty"`
+	DNSName   string   `json:"dns_san,omitempty"`
+	URI       string   `json:"uri_san,omitempty"` // e.g. spiffe://partner1/service
+	Email     string   `json:"email_san,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Routes    []string `json:"routes,omitempty"`
+}
+
+// Client map file format, first matched rule wins
+type clientMapFile struct {
+	Clients []ClientRule `json:"clients"`
+}
+
+// ClientMap maps verified client certificates to clients
+type ClientMap struct {
+	rules []ClientRule
+}
+
+// LoadClientMap reads client map file and returns client map
+func LoadClientMap(filePath string) (*ClientMap, error) {
+
+	// Read client map file
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read client map file failed: " + err.Error())
+	}
+
+	var file clientMapFile
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return nil, errors.New("parse client map file failed: " + err.Error())
+	}
+
+	for _, rule := range file.Clients {
+		if rule.Client == "" {
+			return nil, errors.New("client map has rule without client")
+		}
+		if rule.SubjectCN == "" && rule.DNSName == "" && rule.URI == "" && rule.Email == "" {
+			return nil, errors.New("client map rule of " + rule.Client + " has nothing to match")
+		}
+	}
+
+	return &ClientMap{rules: file.Clients}, nil
+}
+
+// Match returns rule of certificate, certificate should be verified before
+func (m *ClientMap) Match(cert *x509.Certificate) (ClientRule, bool) {
+
+	for _, rule := range m.rules {
+		if rule.SubjectCN != "" && rule.SubjectCN != cert.Subject.CommonName {
+			continue
+		}
+		if rule.DNSName != "" && !containsString(cert.DNSNames, rule.DNSName) {
+			continue
+		}
+		if rule.URI != "" && !containsURI(cert.URIs, rule.URI) {
+			continue
+		}
+		if rule.Email != "" && !containsString(cert.EmailAddresses, rule.Email) {
+			continue
+		}
+		return rule, true
+	}
+
+	return ClientRule{}, false
+}
+
+// LoadCAPool reads PEM CA bundle which is used to verify client certificates
+func LoadCAPool(filePath string) (*x509.CertPool, error) {
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read client ca file failed: " + err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(byteValue) {
+		return nil, errors.New("client ca file has no certificates")
+	}
+
+	return pool, nil
+}
+
+// Thumbprint returns base64url SHA-256 of certificate DER, the x5t#S256 of RFC 8705
+func Thumbprint(cert *x509.Certificate) string {
+
+	sum := sha256.Sum256(cert.Raw)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func containsString(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsURI(uris []*url.URL, value string) bool {
+
+	for _, uri := range uris {
+		if uri.String() == value {
+			return true
+		}
+	}
+
+	return false
+}
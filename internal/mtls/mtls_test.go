@@ -0,0 +1,164 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert returns self-signed certificate with subject CN and SANs, and its PEM
+func newTestCert(t *testing.T, commonName string, dnsNames []string, uris []string, emails []string) (*x509.Certificate, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              dnsNames,
+		EmailAddresses:        emails,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, rawURI := range uris {
+		uri, err := url.Parse(rawURI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, uri)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func writeTestFile(t *testing.T, name string, content string) string {
+
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
+
+func TestLoadClientMap(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"clients": [{"client": "partner", "subject_cn": "partner.client.local", "scopes": ["login"]}]}`, false},
+		{"no clients", `{"clients": []}`, false},
+		{"rule without client", `{"clients": [{"subject_cn": "partner.client.local"}]}`, true},
+		{"rule without match fields", `{"clients": [{"client": "partner", "scopes": ["login"]}]}`, true},
+		{"malformed json", `{"clients": [`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadClientMap(writeTestFile(t, "client_map.json", tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadClientMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadClientMap(filepath.Join(t.TempDir(), "client_map.json")); err == nil {
+			t.Error("LoadClientMap() of missing file succeeded")
+		}
+	})
+}
+
+func TestClientMapMatch(t *testing.T) {
+
+	clientMap := &ClientMap{rules: []ClientRule{
+		{Client: "spiffe", URI: "spiffe://partner1/service"},
+		{Client: "both", SubjectCN: "both.client.local", DNSName: "both.example.com"},
+		{Client: "cn", SubjectCN: "partner.client.local"},
+		{Client: "dns", DNSName: "partner.example.com"},
+		{Client: "email", Email: "ops@example.com"},
+	}}
+
+	tests := []struct {
+		name       string
+		commonName string
+		dnsNames   []string
+		uris       []string
+		emails     []string
+		wantClient string
+		wantOK     bool
+	}{
+		{"subject cn", "partner.client.local", nil, nil, nil, "cn", true},
+		{"dns san", "unknown", []string{"other.example.com", "partner.example.com"}, nil, nil, "dns", true},
+		{"uri san", "unknown", nil, []string{"spiffe://partner1/service"}, nil, "spiffe", true},
+		{"email san", "unknown", nil, nil, []string{"ops@example.com"}, "email", true},
+		{"all fields of rule match", "both.client.local", []string{"both.example.com"}, nil, nil, "both", true},
+		{"first matched rule wins", "partner.client.local", nil, []string{"spiffe://partner1/service"}, nil, "spiffe", true},
+		{"only some fields of rule match", "both.client.local", []string{"else.example.com"}, nil, nil, "", false},
+		{"no rule matches", "unknown", []string{"unknown.example.com"}, []string{"spiffe://partner2/service"}, nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, _ := newTestCert(t, tt.commonName, tt.dnsNames, tt.uris, tt.emails)
+			rule, ok := clientMap.Match(cert)
+			if ok != tt.wantOK || rule.Client != tt.wantClient {
+				t.Errorf("Match() = %q, %v, want %q, %v", rule.Client, ok, tt.wantClient, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadCAPool(t *testing.T) {
+
+	cert, certPEM := newTestCert(t, "client-ca", nil, nil, nil)
+
+	pool, err := LoadCAPool(writeTestFile(t, "client_ca.pem", string(certPEM)))
+	if err != nil {
+		t.Fatalf("LoadCAPool() error = %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("certificate is not verified with loaded pool: %v", err)
+	}
+
+	if _, err := LoadCAPool(writeTestFile(t, "client_ca.pem", "not a certificate")); err == nil {
+		t.Error("LoadCAPool() of file without certificates succeeded")
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+
+	cert, _ := newTestCert(t, "partner.client.local", nil, nil, nil)
+
+	sum := sha256.Sum256(cert.Raw)
+	if got, want := Thumbprint(cert), base64.RawURLEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("Thumbprint() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+)
+
+// Notifier sends message to account, e.g. password reset token
+type Notifier interface {
+	Notify(recipient, subject, body string) error
+}
+
+// A function to make notifier which selected by [ACCOUNT] Notifier in config
+func MakeNotifier(cfg conf.IConf) (Notifier, error) {
+
+	// Fetch config of account
+	accountConf := cfg.AccountCfg()
+
+	switch accountConf.Notifier {
+	case "file":
+		return NewFileNotifier(accountConf.NotifierFilePath)
+	default:
+		return nil, errors.New("no such notifier: " + accountConf.Notifier)
+	}
+}
+
+// Message line format in notifier file
+type Message struct {
+	Time      time.Time `json:"time"`
+	Recipient string    `json:"recipient"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+}
+
+// FileNotifier appends messages to file as json lines, it is a stand-in of mail for development and tests
+type FileNotifier struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+// NewFileNotifier returns notifier which appends to file, folder of file is created if not exists
+func NewFileNotifier(filePath string) (*FileNotifier, error) {
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return nil, errors.New("create notifier folder failed: " + err.Error())
+	}
+
+	return &FileNotifier{filePath: filePath}, nil
+}
+
+// Notify appends message to file, file is only readable by owner because messages may carry secrets
+func (n *FileNotifier) Notify(recipient, subject, body string) error {
+
+	byteValue, err := json.Marshal(Message{Time: time.Now().UTC(), Recipient: recipient, Subject: subject, Body: body})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New("open notifier file failed: " + err.Error())
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(byteValue, '\n')); err != nil {
+		return errors.New("write notifier file failed: " + err.Error())
+	}
+
+	return nil
+}
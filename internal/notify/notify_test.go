@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileNotifier(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "Notify", "notify.log")
+
+	notifier, err := NewFileNotifier(filePath)
+	if err != nil {
+		t.Fatalf("NewFileNotifier() error = %v", err)
+	}
+
+	messages := []Message{
+		{Recipient: "alice", Subject: "Password reset", Body: "Use this token: token-1"},
+		{Recipient: "bob", Subject: "Password reset", Body: "Use this token: token-2"},
+	}
+	for _, message := range messages {
+		if err := notifier.Notify(message.Recipient, message.Subject, message.Body); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	// Messages may carry secrets, file is only readable by owner
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("notifier file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var got []Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("line %q is not json message: %v", scanner.Text(), err)
+		}
+		got = append(got, message)
+	}
+
+	if len(got) != len(messages) {
+		t.Fatalf("notifier file has %d messages, want %d", len(got), len(messages))
+	}
+	for i, message := range got {
+		if message.Recipient != messages[i].Recipient || message.Subject != messages[i].Subject || message.Body != messages[i].Body {
+			t.Errorf("message %d = %+v, want %+v", i, message, messages[i])
+		}
+		if message.Time.Location() != time.UTC || time.Since(message.Time) > time.Minute {
+			t.Errorf("message %d time = %v, want recent UTC time", i, message.Time)
+		}
+	}
+}
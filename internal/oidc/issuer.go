@@ -0,0 +1,235 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+// Default signing algorithms accepted from external issuers, HMAC is never accepted
+var defaultAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+const (
+	defaultJWKSRefresh = time.Hour
+	minJWKSRefresh     = 30 * time.Second // unknown kid triggers refresh at most once in this interval
+	jwksFetchTimeout   = 10 * time.Second
+)
+
+// ClaimRule maps external claim value to role.
+// Value matches a string claim, or one element of an array claim.
+type ClaimRule struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Role  string `json:"role"`
+}
+
+// IssuerConfig is the entry of an external issuer in issuers file.
+// JWKS is fetched from JWKSURL, or read from JWKSFile which is relative to the folder of issuers file.
+type IssuerConfig struct {
+	Issuer             string      `json:"issuer"`
+	Audiences          []string    `json:"audiences"`                      // aud of token should contain one of them
+	JWKSURL            string      `json:"jwks_url,omitempty"`             // e.g. https://idp/.well-known/jwks.json
+	JWKSFile           string      `json:"jwks_file,omitempty"`            // local JWKS, e.g. for tests
+	JWKSRefreshSeconds int         `json:"jwks_refresh_seconds,omitempty"` // default 3600
+	Algorithms         []string    `json:"algorithms,omitempty"`           // default all asymmetric algorithms
+	AccountClaim       string      `json:"account_claim,omitempty"`        // default sub
+	AccountPrefix      string      `json:"account_prefix,omitempty"`       // e.g. "idp:", keeps external accounts apart from local ones
+	RoleRules          []ClaimRule `json:"role_rules,omitempty"`           // first matched rule wins
+	DefaultRole        string      `json:"default_role,omitempty"`         // role if no rule matched, empty to reject
+}
+
+// Validate checks fields of issuer config
+func (cfg IssuerConfig) Validate() error {
+
+	if cfg.Issuer == "" {
+		return errors.New("issuer is required")
+	}
+
+	if len(cfg.Audiences) == 0 {
+		return errors.New("issuer " + cfg.Issuer + " has no audiences")
+	}
+
+	if (cfg.JWKSURL == "") == (cfg.JWKSFile == "") {
+		return errors.New("issuer " + cfg.Issuer + " should have one of jwks_url and jwks_file")
+	}
+
+	for _, alg := range cfg.Algorithms {
+		if !contains(defaultAlgorithms, alg) {
+			return errors.New("issuer " + cfg.Issuer + " has unsupported algorithm " + alg)
+		}
+	}
+
+	for _, rule := range cfg.RoleRules {
+		if rule.Claim == "" || rule.Role == "" {
+			return errors.New("issuer " + cfg.Issuer + " has role rule without claim or role")
+		}
+	}
+
+	return nil
+}
+
+// Issuer is a trusted external issuer with cached JWKS
+type Issuer struct {
+	config     IssuerConfig
+	baseDir    string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]interface{} // kid => public key
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+}
+
+// NewIssuer returns issuer of config, JWKS is loaded on first use
+func NewIssuer(config IssuerConfig, baseDir string) (*Issuer, error) {
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = defaultAlgorithms
+	}
+	if config.AccountClaim == "" {
+		config.AccountClaim = "sub"
+	}
+
+	return &Issuer{
+		config:     config,
+		baseDir:    baseDir,
+		httpClient: &http.Client{Timeout: jwksFetchTimeout},
+	}, nil
+}
+
+// Key returns public key of kid, JWKS is refreshed when expired or kid is unknown.
+// Empty kid is accepted when JWKS has only one key.
+func (iss *Issuer) Key(kid string, now time.Time) (interface{}, error) {
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	refresh := iss.config.JWKSRefreshSeconds
+	refreshInterval := defaultJWKSRefresh
+	if refresh > 0 {
+		refreshInterval = time.Duration(refresh) * time.Second
+	}
+
+	// Refresh expired JWKS, or JWKS without kid, old keys are kept if refresh failed
+	_, known := iss.lookupLocked(kid)
+	if iss.keys == nil || now.Sub(iss.fetchedAt) >= refreshInterval || !known {
+		if now.Sub(iss.lastAttempt) >= minJWKSRefresh {
+			iss.lastErr = iss.refreshLocked(now)
+		}
+	}
+
+	key, ok := iss.lookupLocked(kid)
+	if !ok {
+		if iss.lastErr != nil {
+			return nil, errors.New("load jwks of issuer " + iss.config.Issuer + " failed: " + iss.lastErr.Error())
+		}
+		return nil, errors.New("no such kid of issuer " + iss.config.Issuer + ": " + kid)
+	}
+
+	return key, nil
+}
+
+func (iss *Issuer) lookupLocked(kid string) (interface{}, bool) {
+
+	if kid == "" && len(iss.keys) == 1 {
+		for _, key := range iss.keys {
+			return key, true
+		}
+	}
+
+	key, ok := iss.keys[kid]
+
+	return key, ok
+}
+
+// refreshLocked fetches JWKS from url or file
+func (iss *Issuer) refreshLocked(now time.Time) error {
+
+	iss.lastAttempt = now
+
+	var byteValue []byte
+	var err error
+	if iss.config.JWKSURL != "" {
+		byteValue, err = iss.fetch(iss.config.JWKSURL)
+	} else {
+		jwksFile := iss.config.JWKSFile
+		if !filepath.IsAbs(jwksFile) {
+			jwksFile = filepath.Join(iss.baseDir, jwksFile)
+		}
+		byteValue, err = ioutil.ReadFile(jwksFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	var jwks keyset.JWKSet
+	if err := json.Unmarshal(byteValue, &jwks); err != nil {
+		return errors.New("parse jwks failed: " + err.Error())
+	}
+
+	// Skip keys which are not for signature or can not be parsed
+	keys := map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks has no usable keys")
+	}
+
+	iss.keys = keys
+	iss.fetchedAt = now
+
+	return nil
+}
+
+func (iss *Issuer) fetch(url string) ([]byte, error) {
+
+	resp, err := iss.httpClient.Get(url)
+	if err != nil {
+		return nil, errors.New("fetch jwks failed: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("fetch jwks failed: status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	// JWKS should be small, limit size to 1MiB
+	byteValue, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.New("read jwks failed: " + err.Error())
+	}
+
+	return byteValue, nil
+}
+
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
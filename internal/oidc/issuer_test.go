@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+// testJWKSServer serves JWKS which can be changed between requests, and counts requests
+type testJWKSServer struct {
+	mu       sync.Mutex
+	jwks     keyset.JWKSet
+	status   int
+	requests int
+}
+
+func (s *testJWKSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	json.NewEncoder(w).Encode(s.jwks)
+}
+
+func (s *testJWKSServer) set(jwks keyset.JWKSet, status int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jwks = jwks
+	s.status = status
+}
+
+func testJWK(t *testing.T, kid, use string) keyset.JWK {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyset.JWK{
+		Kty: "EC",
+		Kid: kid,
+		Use: use,
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func TestIssuerKeyRefresh(t *testing.T) {
+
+	jwksServer := &testJWKSServer{}
+	server := httptest.NewServer(jwksServer)
+	defer server.Close()
+
+	issuer, err := NewIssuer(IssuerConfig{Issuer: "https://idp.example.com", Audiences: []string{"api"}, JWKSURL: server.URL}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1600000000, 0)
+	key1 := testJWK(t, "key-1", "sig")
+	key2 := testJWK(t, "key-2", "")
+	encKey := testJWK(t, "enc-1", "enc")
+
+	// Each step changes JWKS served, then asks key of kid at time
+	tests := []struct {
+		name         string
+		jwks         []keyset.JWK
+		status       int
+		kid          string
+		at           time.Duration
+		wantFound    bool
+		wantRequests int
+	}{
+		{"first use fetches jwks", []keyset.JWK{key1, encKey}, 0, "key-1", 0, true, 1},
+		{"known kid is cached", []keyset.JWK{key1, key2}, 0, "key-1", time.Minute, true, 1},
+		{"encryption key is skipped", []keyset.JWK{key1, encKey}, 0, "enc-1", 2 * time.Minute, false, 2},
+		{"unknown kid refresh is limited", []keyset.JWK{key1, key2}, 0, "key-2", 2*time.Minute + 10*time.Second, false, 2},
+		{"unknown kid refreshes after interval", []keyset.JWK{key1, key2}, 0, "key-2", 3 * time.Minute, true, 3},
+		{"old keys kept when refresh fails", nil, http.StatusInternalServerError, "key-1", 2 * time.Hour, true, 4},
+		{"refresh error is returned for unknown kid", nil, http.StatusInternalServerError, "key-3", 3 * time.Hour, false, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwksServer.set(keyset.JWKSet{Keys: tt.jwks}, tt.status)
+
+			_, err := issuer.Key(tt.kid, start.Add(tt.at))
+			if (err == nil) != tt.wantFound {
+				t.Errorf("Key(%q) error = %v, want found %v", tt.kid, err, tt.wantFound)
+			}
+
+			jwksServer.mu.Lock()
+			requests := jwksServer.requests
+			jwksServer.mu.Unlock()
+			if requests != tt.wantRequests {
+				t.Errorf("jwks requests = %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestIssuerKeyWithoutKid(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		jwks      []keyset.JWK
+		wantFound bool
+	}{
+		{"single key", []keyset.JWK{testJWK(t, "key-1", "sig")}, true},
+		{"several keys", []keyset.JWK{testJWK(t, "key-1", "sig"), testJWK(t, "key-2", "sig")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwksServer := &testJWKSServer{jwks: keyset.JWKSet{Keys: tt.jwks}}
+			server := httptest.NewServer(jwksServer)
+			defer server.Close()
+
+			issuer, err := NewIssuer(IssuerConfig{Issuer: "https://idp.example.com", Audiences: []string{"api"}, JWKSURL: server.URL}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = issuer.Key("", time.Unix(1600000000, 0))
+			if (err == nil) != tt.wantFound {
+				t.Errorf("Key(\"\") error = %v, want found %v", err, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Identity is the local identity mapped from a token of external issuer
+type Identity struct {
+	Issuer    string
+	Subject   string
+	Account   string
+	Role      string
+	ID        string // jti, may be empty
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Issuers file format
+type issuersFile struct {
+	Issuers []IssuerConfig `json:"issuers"`
+}
+
+// Verifier verifies tokens of trusted external issuers
+type Verifier struct {
+	issuers map[string]*Issuer
+}
+
+// LoadVerifier reads issuers file and returns verifier
+func LoadVerifier(filePath string) (*Verifier, error) {
+
+	// Read issuers file
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.New("read issuers file failed: " + err.Error())
+	}
+
+	var file issuersFile
+	if err := json.Unmarshal(byteValue, &file); err != nil {
+		return nil, errors.New("parse issuers file failed: " + err.Error())
+	}
+
+	verifier := &Verifier{issuers: map[string]*Issuer{}}
+
+	for _, config := range file.Issuers {
+		if _, ok := verifier.issuers[config.Issuer]; ok {
+			return nil, errors.New("issuers file has duplicated issuer " + config.Issuer)
+		}
+
+		issuer, err := NewIssuer(config, filepath.Dir(filePath))
+		if err != nil {
+			return nil, err
+		}
+
+		verifier.issuers[config.Issuer] = issuer
+	}
+
+	return verifier, nil
+}
+
+// Trusts checks whether token claims an external issuer in verifier, the token is not verified here.
+// Nil verifier trusts no issuer.
+func (v *Verifier) Trusts(token string) bool {
+
+	if v == nil {
+		return false
+	}
+
+	_, ok := v.issuerOf(token)
+
+	return ok
+}
+
+// Verify checks signature, iss, aud and time claims of token, then maps claims to identity
+func (v *Verifier) Verify(token string, now time.Time) (Identity, error) {
+
+	issuer, ok := v.issuerOf(token)
+	if !ok {
+		return Identity{}, errors.New("token issuer is not trusted")
+	}
+	config := issuer.config
+
+	// Verify signature with JWKS of issuer, only allowed algorithms
+	parser := &jwt.Parser{ValidMethods: config.Algorithms, SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return issuer.Key(kid, now)
+	})
+	if err != nil {
+		return Identity{}, errors.New("token verification failed: " + err.Error())
+	}
+
+	// Check time claims, exp is required
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return Identity{}, errors.New("token has no exp")
+	}
+	if now.Unix() >= exp {
+		return Identity{}, errors.New("token is expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Unix() < nbf {
+		return Identity{}, errors.New("token is not yet valid before sometime")
+	}
+	iat, _ := numericClaim(claims, "iat")
+
+	// Check aud
+	if !matchAudience(claims["aud"], config.Audiences) {
+		return Identity{}, errors.New("token audience is not accepted")
+	}
+
+	// Map account
+	account, _ := claims[config.AccountClaim].(string)
+	if account == "" {
+		return Identity{}, errors.New("token has no account claim " + config.AccountClaim)
+	}
+
+	// Map role with rules
+	role := config.DefaultRole
+	for _, rule := range config.RoleRules {
+		if matchClaim(claims[rule.Claim], rule.Value) {
+			role = rule.Role
+			break
+		}
+	}
+	if role == "" {
+		return Identity{}, errors.New("no role rule matched account " + account)
+	}
+
+	subject, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+
+	return Identity{
+		Issuer:    config.Issuer,
+		Subject:   subject,
+		Account:   config.AccountPrefix + account,
+		Role:      role,
+		ID:        jti,
+		IssuedAt:  time.Unix(iat, 0),
+		ExpiresAt: time.Unix(exp, 0),
+	}, nil
+}
+
+// issuerOf returns trusted issuer of iss claim in token without verification
+func (v *Verifier) issuerOf(token string) (*Issuer, bool) {
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return nil, false
+	}
+
+	iss, _ := claims["iss"].(string)
+	issuer, ok := v.issuers[iss]
+
+	return issuer, ok
+}
+
+// numericClaim returns NumericDate claim in seconds
+func numericClaim(claims jwt.MapClaims, name string) (int64, bool) {
+
+	switch value := claims[name].(type) {
+	case float64:
+		return int64(value), true
+	case json.Number:
+		n, err := value.Int64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// matchAudience checks whether aud, a string or an array, contains one of audiences
+func matchAudience(aud interface{}, audiences []string) bool {
+
+	for _, audience := range audiences {
+		if matchClaim(aud, audience) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchClaim checks whether claim equals value, or contains value if claim is an array
+func matchClaim(claim interface{}, value string) bool {
+
+	switch claimValue := claim.(type) {
+	case []interface{}:
+		for _, element := range claimValue {
+			if fmt.Sprint(element) == value {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	default:
+		return fmt.Sprint(claimValue) == value
+	}
+}
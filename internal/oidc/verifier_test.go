@@ -0,0 +1,267 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/cxweoth/gin-api-server-template/internal/keyset"
+)
+
+// writeJWKS writes JWK of public key with kid to jwks.json in dir
+func writeJWKS(t *testing.T, dir string, kid string, publicKey *ecdsa.PublicKey) {
+
+	jwks := keyset.JWKSet{Keys: []keyset.JWK{{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, 32))),
+	}}}
+
+	byteValue, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "jwks.json"), byteValue, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestVerifier returns verifier of issuer https://idp.example.com, which trusts ES256 key "idp-1"
+func loadTestVerifier(t *testing.T, key *ecdsa.PrivateKey) *Verifier {
+
+	dir := t.TempDir()
+	writeJWKS(t, dir, "idp-1", &key.PublicKey)
+
+	issuers := issuersFile{Issuers: []IssuerConfig{{
+		Issuer:        "https://idp.example.com",
+		Audiences:     []string{"gin-api-server"},
+		JWKSFile:      "jwks.json",
+		Algorithms:    []string{"ES256"},
+		AccountClaim:  "email",
+		AccountPrefix: "idp:",
+		RoleRules: []ClaimRule{
+			{Claim: "groups", Value: "admins", Role: "Admin"},
+			{Claim: "department", Value: "support", Role: "Support"},
+		},
+		DefaultRole: "User",
+	}}}
+
+	byteValue, err := json.Marshal(issuers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, "issuers.json")
+	if err := ioutil.WriteFile(filePath, byteValue, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := LoadVerifier(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return verifier
+}
+
+func TestVerifierVerify(t *testing.T) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := loadTestVerifier(t, key)
+	now := time.Unix(1600000000, 0)
+
+	claimsOf := func(change func(claims jwt.MapClaims)) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":   "https://idp.example.com",
+			"sub":   "00u1",
+			"aud":   "gin-api-server",
+			"email": "alice@example.com",
+			"jti":   "idp-jti",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		if change != nil {
+			change(claims)
+		}
+		return claims
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, signKey interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(signKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantRole string
+		wantErr  string
+	}{
+		{"default role", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(nil)), "User", ""},
+		{"empty kid with single key", sign(jwt.SigningMethodES256, "", key, claimsOf(nil)), "User", ""},
+		{"role rule of array claim", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["groups"] = []string{"users", "admins"} })), "Admin", ""},
+		{"role rule of string claim", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["department"] = "support" })), "Support", ""},
+		{"first matched rule wins", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["groups"] = "admins"; c["department"] = "support" })), "Admin", ""},
+		{"audience in array", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["aud"] = []string{"other", "gin-api-server"} })), "User", ""},
+		{"untrusted issuer", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" })), "", "token issuer is not trusted"},
+		{"unknown kid", sign(jwt.SigningMethodES256, "idp-2", key, claimsOf(nil)), "", "no such kid"},
+		{"signed by other key", sign(jwt.SigningMethodES256, "idp-1", otherKey, claimsOf(nil)), "", "token verification failed"},
+		{"alg not allowed", sign(jwt.SigningMethodHS256, "idp-1", []byte("0123456789abcdef0123456789abcdef"), claimsOf(nil)), "", "token verification failed"},
+		{"alg none", sign(jwt.SigningMethodNone, "idp-1", jwt.UnsafeAllowNoneSignatureType, claimsOf(nil)), "", "token verification failed"},
+		{"no exp", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { delete(c, "exp") })), "", "token has no exp"},
+		{"expired", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["exp"] = now.Unix() })), "", "token is expired"},
+		{"not yet valid", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() })), "", "token is not yet valid"},
+		{"other audience", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { c["aud"] = "other" })), "", "token audience is not accepted"},
+		{"no audience", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { delete(c, "aud") })), "", "token audience is not accepted"},
+		{"no account claim", sign(jwt.SigningMethodES256, "idp-1", key, claimsOf(func(c jwt.MapClaims) { delete(c, "email") })), "", "token has no account claim email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !verifier.Trusts(tt.token) && tt.wantErr != "token issuer is not trusted" {
+				t.Fatal("Trusts() = false, want true")
+			}
+
+			identity, err := verifier.Verify(tt.token, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if identity.Account != "idp:alice@example.com" || identity.Role != tt.wantRole || identity.Subject != "00u1" || identity.ID != "idp-jti" {
+				t.Errorf("Verify() = %+v, want account idp:alice@example.com with role %s", identity, tt.wantRole)
+			}
+			if !identity.ExpiresAt.Equal(now.Add(time.Hour)) || !identity.IssuedAt.Equal(now) {
+				t.Errorf("Verify() times = %v, %v, want %v, %v", identity.IssuedAt, identity.ExpiresAt, now, now.Add(time.Hour))
+			}
+		})
+	}
+}
+
+func TestVerifierNoRoleMatched(t *testing.T) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := loadTestVerifier(t, key)
+	verifier.issuers["https://idp.example.com"].config.DefaultRole = ""
+
+	now := time.Unix(1600000000, 0)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": "https://idp.example.com", "aud": "gin-api-server", "email": "alice@example.com", "exp": now.Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(signed, now); err == nil || !strings.Contains(err.Error(), "no role rule matched") {
+		t.Errorf("Verify() error = %v, want no role rule matched", err)
+	}
+}
+
+func TestVerifierTrusts(t *testing.T) {
+
+	var nilVerifier *Verifier
+	if nilVerifier.Trusts("any.token.here") {
+		t.Error("Trusts() of nil verifier = true, want false")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := loadTestVerifier(t, key)
+
+	if verifier.Trusts("not a token") {
+		t.Error("Trusts() of malformed token = true, want false")
+	}
+}
+
+func TestIssuerConfigValidate(t *testing.T) {
+
+	valid := func(change func(cfg *IssuerConfig)) IssuerConfig {
+		cfg := IssuerConfig{Issuer: "https://idp.example.com", Audiences: []string{"api"}, JWKSURL: "https://idp.example.com/jwks"}
+		if change != nil {
+			change(&cfg)
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		cfg     IssuerConfig
+		wantErr bool
+	}{
+		{"jwks url", valid(nil), false},
+		{"jwks file", valid(func(cfg *IssuerConfig) { cfg.JWKSURL = ""; cfg.JWKSFile = "jwks.json" }), false},
+		{"no issuer", valid(func(cfg *IssuerConfig) { cfg.Issuer = "" }), true},
+		{"no audiences", valid(func(cfg *IssuerConfig) { cfg.Audiences = nil }), true},
+		{"no jwks", valid(func(cfg *IssuerConfig) { cfg.JWKSURL = "" }), true},
+		{"both jwks url and file", valid(func(cfg *IssuerConfig) { cfg.JWKSFile = "jwks.json" }), true},
+		{"asymmetric algorithm", valid(func(cfg *IssuerConfig) { cfg.Algorithms = []string{"RS256", "EdDSA"} }), false},
+		{"hmac algorithm", valid(func(cfg *IssuerConfig) { cfg.Algorithms = []string{"HS256"} }), true},
+		{"role rule without claim", valid(func(cfg *IssuerConfig) { cfg.RoleRules = []ClaimRule{{Value: "admins", Role: "Admin"}} }), true},
+		{"role rule without role", valid(func(cfg *IssuerConfig) { cfg.RoleRules = []ClaimRule{{Claim: "groups", Value: "admins"}} }), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadVerifierDuplicatedIssuer(t *testing.T) {
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "issuers.json")
+	content := `{"issuers": [
+		{"issuer": "https://idp.example.com", "audiences": ["api"], "jwks_file": "jwks.json"},
+		{"issuer": "https://idp.example.com", "audiences": ["api"], "jwks_file": "jwks.json"}
+	]}`
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadVerifier(filePath); err == nil || !strings.Contains(err.Error(), "duplicated issuer") {
+		t.Errorf("LoadVerifier() error = %v, want duplicated issuer", err)
+	}
+}
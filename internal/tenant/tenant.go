@@ -0,0 +1,194 @@
+package tenant
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+)
+
+var (
+	ErrUnknownTenant  = errors.New("no such tenant")
+	ErrRoleNotAllowed = errors.New("role is not allowed in tenant")
+	ErrRateLimited    = errors.New("too many requests of tenant")
+	ErrTenantMismatch = errors.New("cross-tenant use is not allowed")
+)
+
+// Window of request rate limit
+const rateWindow = time.Minute
+
+// Tenant keeps overrides of one tenant, zero values mean no override
+type Tenant struct {
+	Name              string
+	ServiceName       string
+	AccessTokenTTL    time.Duration
+	RequestsPerMinute int
+	AllowedRoles      []string
+}
+
+// Request count of tenant in current window
+type rateWindowCount struct {
+	start time.Time
+	count int
+}
+
+// Tenants keeps configured tenants and counts their requests.
+// The empty tenant is of API key clients without tenant, it always exists and has no overrides.
+type Tenants struct {
+	tenants map[string]Tenant
+
+	mu     sync.Mutex
+	counts map[string]*rateWindowCount
+}
+
+// A function to make tenants with [TENANT <name>] sections in config
+func MakeTenants(cfg conf.IConf) (*Tenants, error) {
+
+	tenants := []Tenant{}
+	for _, tenantConf := range cfg.TenantsCfg() {
+		tenants = append(tenants, Tenant{
+			Name:              tenantConf.Name,
+			ServiceName:       tenantConf.ServiceName,
+			AccessTokenTTL:    tenantConf.AccessTokenTTL,
+			RequestsPerMinute: tenantConf.RequestsPerMinute,
+			AllowedRoles:      tenantConf.AllowedRoles,
+		})
+	}
+
+	return NewTenants(tenants)
+}
+
+// NewTenants returns tenants, names should be unique and not empty
+func NewTenants(tenants []Tenant) (*Tenants, error) {
+
+	t := &Tenants{tenants: map[string]Tenant{}, counts: map[string]*rateWindowCount{}}
+
+	for _, tenant := range tenants {
+		if tenant.Name == "" {
+			return nil, errors.New("tenant name is empty")
+		}
+		if _, ok := t.tenants[tenant.Name]; ok {
+			return nil, errors.New("duplicated tenant: " + tenant.Name)
+		}
+		t.tenants[tenant.Name] = tenant
+	}
+
+	return t, nil
+}
+
+// Exists checks whether tenant is configured, the empty tenant always exists
+func (t *Tenants) Exists(name string) bool {
+
+	if name == "" {
+		return true
+	}
+
+	_, ok := t.tenants[name]
+
+	return ok
+}
+
+// AllowsRole checks whether role can be used in tenant
+func (t *Tenants) AllowsRole(name, role string) bool {
+
+	tenant := t.tenants[name]
+	if len(tenant.AllowedRoles) == 0 {
+		return true
+	}
+
+	for _, allowedRole := range tenant.AllowedRoles {
+		if allowedRole == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServiceName returns service name of tenant, or defaultName if not overridden
+func (t *Tenants) ServiceName(name, defaultName string) string {
+
+	if serviceName := t.tenants[name].ServiceName; serviceName != "" {
+		return serviceName
+	}
+
+	return defaultName
+}
+
+// AccessTokenTTL returns access token lifetime of tenant, or defaultTTL if not overridden
+func (t *Tenants) AccessTokenTTL(name string, defaultTTL time.Duration) time.Duration {
+
+	if ttl := t.tenants[name].AccessTokenTTL; ttl > 0 {
+		return ttl
+	}
+
+	return defaultTTL
+}
+
+// MaxAccessTokenTTL returns the longest access token lifetime of all tenants, revocations should be kept this long
+func (t *Tenants) MaxAccessTokenTTL(defaultTTL time.Duration) time.Duration {
+
+	maxTTL := defaultTTL
+	for _, tenant := range t.tenants {
+		if tenant.AccessTokenTTL > maxTTL {
+			maxTTL = tenant.AccessTokenTTL
+		}
+	}
+
+	return maxTTL
+}
+
+// Allow counts a request of tenant, and returns false if requests of tenant in current minute are over its limit
+func (t *Tenants) Allow(name string, now time.Time) bool {
+
+	limit := t.tenants[name].RequestsPerMinute
+	if limit <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window, ok := t.counts[name]
+	if !ok || !now.Before(window.start.Add(rateWindow)) {
+		window = &rateWindowCount{start: now}
+		t.counts[name] = window
+	}
+
+	if window.count >= limit {
+		return false
+	}
+	window.count++
+
+	return true
+}
+
+// CheckRole checks whether tenant exists and role is allowed in it, without counting a request.
+// Empty role is of client itself and is not checked.
+func (t *Tenants) CheckRole(name, role string) error {
+
+	if !t.Exists(name) {
+		return ErrUnknownTenant
+	}
+
+	if role != "" && !t.AllowsRole(name, role) {
+		return ErrRoleNotAllowed
+	}
+
+	return nil
+}
+
+// Check checks tenant and role with CheckRole, and whether requests of tenant are under limit
+func (t *Tenants) Check(name, role string, now time.Time) error {
+
+	if err := t.CheckRole(name, role); err != nil {
+		return err
+	}
+
+	if !t.Allow(name, now) {
+		return ErrRateLimited
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package tenant
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTenants(t *testing.T) *Tenants {
+
+	tenants, err := NewTenants([]Tenant{
+		{Name: "acme", ServiceName: "Acme API", AccessTokenTTL: 10 * time.Minute, RequestsPerMinute: 2, AllowedRoles: []string{"User"}},
+		{Name: "globex", AccessTokenTTL: 2 * time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tenants
+}
+
+func TestNewTenants(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		tenants []Tenant
+		wantErr bool
+	}{
+		{"no tenants", nil, false},
+		{"unique names", []Tenant{{Name: "acme"}, {Name: "globex"}}, false},
+		{"empty name", []Tenant{{Name: ""}}, true},
+		{"duplicated name", []Tenant{{Name: "acme"}, {Name: "acme"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTenants(tt.tenants)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTenants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTenantsCheck(t *testing.T) {
+
+	now := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name   string
+		tenant string
+		role   string
+		want   error
+	}{
+		{"empty tenant always exists", "", "Admin", nil},
+		{"unknown tenant", "initech", "User", ErrUnknownTenant},
+		{"allowed role", "acme", "User", nil},
+		{"role not allowed", "acme", "Admin", ErrRoleNotAllowed},
+		{"client without role", "acme", "", nil},
+		{"no role restriction", "globex", "Admin", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// New tenants per case, so rate limit of acme is not reached
+			if err := newTestTenants(t).Check(tt.tenant, tt.role, now); err != tt.want {
+				t.Errorf("Check(%q, %q) error = %v, want %v", tt.tenant, tt.role, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantsRateLimit(t *testing.T) {
+
+	tenants := newTestTenants(t)
+	start := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name   string
+		tenant string
+		at     time.Duration
+		want   error
+	}{
+		{"first request", "acme", 0, nil},
+		{"second request", "acme", 10 * time.Second, nil},
+		{"over limit", "acme", 20 * time.Second, ErrRateLimited},
+		{"other tenant is not limited", "globex", 20 * time.Second, nil},
+		{"still over limit at end of window", "acme", 59 * time.Second, ErrRateLimited},
+		{"new window", "acme", time.Minute, nil},
+		{"second request in new window", "acme", time.Minute + time.Second, nil},
+		{"over limit in new window", "acme", time.Minute + 2*time.Second, ErrRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tenants.Check(tt.tenant, "User", start.Add(tt.at)); err != tt.want {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantsCheckRole(t *testing.T) {
+
+	tenants := newTestTenants(t)
+	now := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name   string
+		tenant string
+		role   string
+		want   error
+	}{
+		{"unknown tenant", "initech", "User", ErrUnknownTenant},
+		{"allowed role", "acme", "User", nil},
+		{"role not allowed", "acme", "Admin", ErrRoleNotAllowed},
+		{"allowed role again", "acme", "User", nil},
+		{"allowed role over limit", "acme", "User", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tenants.CheckRole(tt.tenant, tt.role); err != tt.want {
+				t.Errorf("CheckRole(%q, %q) error = %v, want %v", tt.tenant, tt.role, err, tt.want)
+			}
+		})
+	}
+
+	// Requests are not counted by CheckRole, so limit of acme is not reached yet
+	for i := 0; i < 2; i++ {
+		if err := tenants.Check("acme", "User", now); err != nil {
+			t.Fatalf("Check() %d error = %v, want nil", i+1, err)
+		}
+	}
+	if err := tenants.Check("acme", "User", now); err != ErrRateLimited {
+		t.Errorf("Check() over limit error = %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestTenantsOverrides(t *testing.T) {
+
+	tenants := newTestTenants(t)
+
+	tests := []struct {
+		name            string
+		tenant          string
+		wantServiceName string
+		wantTTL         time.Duration
+	}{
+		{"overridden", "acme", "Acme API", 10 * time.Minute},
+		{"service name not overridden", "globex", "gin-api-server", 2 * time.Hour},
+		{"empty tenant", "", "gin-api-server", time.Hour},
+		{"unknown tenant", "initech", "gin-api-server", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tenants.ServiceName(tt.tenant, "gin-api-server"); got != tt.wantServiceName {
+				t.Errorf("ServiceName() = %s, want %s", got, tt.wantServiceName)
+			}
+			if got := tenants.AccessTokenTTL(tt.tenant, time.Hour); got != tt.wantTTL {
+				t.Errorf("AccessTokenTTL() = %v, want %v", got, tt.wantTTL)
+			}
+		})
+	}
+
+	if got := tenants.MaxAccessTokenTTL(time.Hour); got != 2*time.Hour {
+		t.Errorf("MaxAccessTokenTTL() = %v, want %v", got, 2*time.Hour)
+	}
+	if got := tenants.MaxAccessTokenTTL(3 * time.Hour); got != 3*time.Hour {
+		t.Errorf("MaxAccessTokenTTL() = %v, want %v", got, 3*time.Hour)
+	}
+}
@@ -0,0 +1,211 @@
+package tokenstore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	ErrRefreshTokenNotFound       = errors.New("refresh token not found")
+	ErrRefreshTokenExpired        = errors.New("refresh token is expired")
+	ErrRefreshTokenReused         = errors.New("refresh token is reused, token family revoked")
+	ErrRefreshTokenFamilyRevoked  = errors.New("refresh token family is revoked")
+	ErrRefreshTokenClientMismatch = errors.New("refresh token is not issued to this client")
+)
+
+// RefreshRecord is the server side state of a refresh token
+type RefreshRecord struct {
+	FamilyID       string
+	FamilyIssuedAt time.Time // login which started the family, all its tokens expire ttl after it
+	Account        string
+	Role           string
+	AMR            []string
+	Client         string
+	Tenant         string
+	ExpiresAt      time.Time
+	Rotated        bool
+}
+
+// RefreshStore issues and rotates refresh tokens.
+// Tokens issued from one login belong to the same family, and reuse of a
+// rotated token revokes the whole family. Rotation does not extend the family,
+// it can not be refreshed after ttl since the login.
+type RefreshStore interface {
+	Issue(record RefreshRecord) (string, error)
+	Rotate(refreshToken, client string) (string, RefreshRecord, error)
+	RevokeFamily(familyID string)
+	RevokeToken(refreshToken string)
+	RevokeAccount(account string)
+}
+
+// MemoryRefreshStore keeps refresh tokens in memory, tokens are stored by sha256 digest
+type MemoryRefreshStore struct {
+	mu              sync.Mutex
+	ttl             time.Duration
+	records         map[string]*RefreshRecord
+	revokedFamilies map[string]time.Time
+}
+
+// NewMemoryRefreshStore returns refresh store which issue tokens valid for ttl
+func NewMemoryRefreshStore(ttl time.Duration) *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		ttl:             ttl,
+		records:         map[string]*RefreshRecord{},
+		revokedFamilies: map[string]time.Time{},
+	}
+}
+
+// Issue creates a refresh token in a new family, with account, role, amr and client of record
+func (s *MemoryRefreshStore) Issue(record RefreshRecord) (string, error) {
+
+	familyID, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purgeLocked(now)
+
+	record.FamilyID = familyID
+	record.FamilyIssuedAt = now
+
+	return s.issueLocked(record)
+}
+
+// Rotate consumes refresh token and returns a new one in the same family.
+// The returned record is the consumed one, it is filled even when reuse detected.
+func (s *MemoryRefreshStore) Rotate(refreshToken, client string) (string, RefreshRecord, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	record, ok := s.records[digest(refreshToken)]
+	if !ok {
+		return "", RefreshRecord{}, ErrRefreshTokenNotFound
+	}
+
+	if _, revoked := s.revokedFamilies[record.FamilyID]; revoked {
+		return "", *record, ErrRefreshTokenFamilyRevoked
+	}
+
+	if record.Rotated {
+		s.revokeFamilyLocked(record.FamilyID, now)
+		return "", *record, ErrRefreshTokenReused
+	}
+
+	if now.After(record.ExpiresAt) {
+		return "", *record, ErrRefreshTokenExpired
+	}
+
+	if record.Client != client {
+		return "", *record, ErrRefreshTokenClientMismatch
+	}
+
+	// Mark as rotated and keep it to detect reuse
+	record.Rotated = true
+
+	newToken, err := s.issueLocked(*record)
+	if err != nil {
+		return "", *record, err
+	}
+
+	return newToken, *record, nil
+}
+
+// RevokeFamily revokes all refresh tokens in family
+func (s *MemoryRefreshStore) RevokeFamily(familyID string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamilyLocked(familyID, time.Now())
+}
+
+// RevokeToken revokes the family of refresh token
+func (s *MemoryRefreshStore) RevokeToken(refreshToken string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[digest(refreshToken)]; ok {
+		s.revokeFamilyLocked(record.FamilyID, time.Now())
+	}
+}
+
+// RevokeAccount revokes all refresh token families of account
+func (s *MemoryRefreshStore) RevokeAccount(account string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, record := range s.records {
+		if record.Account == account {
+			s.revokeFamilyLocked(record.FamilyID, now)
+		}
+	}
+}
+
+func (s *MemoryRefreshStore) issueLocked(record RefreshRecord) (string, error) {
+
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	record.ExpiresAt = record.FamilyIssuedAt.Add(s.ttl)
+	record.Rotated = false
+	s.records[digest(refreshToken)] = &record
+
+	return refreshToken, nil
+}
+
+func (s *MemoryRefreshStore) revokeFamilyLocked(familyID string, now time.Time) {
+
+	// Keep revoked family until all its tokens expired, so reuse still can be detected
+	s.revokedFamilies[familyID] = now.Add(s.ttl)
+}
+
+// purgeLocked removes expired tokens and revoked families
+func (s *MemoryRefreshStore) purgeLocked(now time.Time) {
+
+	for key, record := range s.records {
+		if now.After(record.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+
+	for familyID, revokedUntil := range s.revokedFamilies {
+		if now.After(revokedUntil) {
+			delete(s.revokedFamilies, familyID)
+		}
+	}
+}
+
+// digest returns sha256 hex of token, so raw tokens are never kept in store
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns url-safe random string of n random bytes
+func randomString(n int) (string, error) {
+
+	b := utils.GenerateRandomBytes(n)
+	if b == nil {
+		return "", errors.New("generate random bytes failed")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
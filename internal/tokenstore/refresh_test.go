@@ -0,0 +1,218 @@
+package tokenstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRefreshStoreRotate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		prepare func(t *testing.T, store *MemoryRefreshStore, first string)
+		token   func(first string) string
+		client  string
+		wantErr error
+	}{
+		{
+			name:    "rotates issued token",
+			ttl:     time.Hour,
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: nil,
+		},
+		{
+			name:    "unknown token",
+			ttl:     time.Hour,
+			token:   func(first string) string { return "no-such-token" },
+			client:  "User1",
+			wantErr: ErrRefreshTokenNotFound,
+		},
+		{
+			name:    "expired token",
+			ttl:     -time.Second,
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: ErrRefreshTokenExpired,
+		},
+		{
+			name:    "token of another client",
+			ttl:     time.Hour,
+			token:   func(first string) string { return first },
+			client:  "User2",
+			wantErr: ErrRefreshTokenClientMismatch,
+		},
+		{
+			name: "rotated token is reused",
+			ttl:  time.Hour,
+			prepare: func(t *testing.T, store *MemoryRefreshStore, first string) {
+				if _, _, err := store.Rotate(first, "User1"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "revoked token",
+			ttl:  time.Hour,
+			prepare: func(t *testing.T, store *MemoryRefreshStore, first string) {
+				store.RevokeToken(first)
+			},
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: ErrRefreshTokenFamilyRevoked,
+		},
+		{
+			name: "revoked account",
+			ttl:  time.Hour,
+			prepare: func(t *testing.T, store *MemoryRefreshStore, first string) {
+				store.RevokeAccount("alice")
+			},
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: ErrRefreshTokenFamilyRevoked,
+		},
+		{
+			name: "revoked other account",
+			ttl:  time.Hour,
+			prepare: func(t *testing.T, store *MemoryRefreshStore, first string) {
+				store.RevokeAccount("bob")
+			},
+			token:   func(first string) string { return first },
+			client:  "User1",
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			store := NewMemoryRefreshStore(tt.ttl)
+			first, err := store.Issue(RefreshRecord{Account: "alice", Role: "User", AMR: []string{"pwd"}, Client: "User1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(t, store, first)
+			}
+
+			newToken, record, err := store.Rotate(tt.token(first), tt.client)
+			if err != tt.wantErr {
+				t.Fatalf("Rotate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if newToken == "" || newToken == first {
+				t.Errorf("Rotate() returned token %q, want a new one", newToken)
+			}
+			if record.Account != "alice" || record.Client != "User1" || record.FamilyID == "" {
+				t.Errorf("Rotate() returned record %+v, want record of issued token", record)
+			}
+		})
+	}
+}
+
+func TestMemoryRefreshStoreReuseRevokesFamily(t *testing.T) {
+
+	store := NewMemoryRefreshStore(time.Hour)
+
+	first, err := store.Issue(RefreshRecord{Account: "alice", Client: "User1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Issue(RefreshRecord{Account: "alice", Client: "User1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, firstRecord, err := store.Rotate(first, "User1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reuse of first token revokes its family, so the token rotated from it can not be used either
+	_, reusedRecord, err := store.Rotate(first, "User1")
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("Rotate() of reused token error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if reusedRecord.FamilyID != firstRecord.FamilyID {
+		t.Errorf("Rotate() of reused token returned family %s, want %s", reusedRecord.FamilyID, firstRecord.FamilyID)
+	}
+
+	if _, _, err := store.Rotate(second, "User1"); err != ErrRefreshTokenFamilyRevoked {
+		t.Errorf("Rotate() of token in revoked family error = %v, want %v", err, ErrRefreshTokenFamilyRevoked)
+	}
+
+	// Family of another login is not touched
+	if _, _, err := store.Rotate(other, "User1"); err != nil {
+		t.Errorf("Rotate() of token in another family error = %v", err)
+	}
+}
+
+func TestMemoryRefreshStorePurge(t *testing.T) {
+
+	store := NewMemoryRefreshStore(-time.Second)
+
+	expired, err := store.Issue(RefreshRecord{Account: "alice", Client: "User1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.RevokeToken(expired)
+
+	// Next issue purges expired tokens and families revoked until their tokens expired
+	if _, err := store.Issue(RefreshRecord{Account: "bob", Client: "User1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.records[digest(expired)]; ok {
+		t.Error("expired refresh token is not purged")
+	}
+	if len(store.revokedFamilies) != 0 {
+		t.Errorf("revoked families = %d, want 0 after purge", len(store.revokedFamilies))
+	}
+}
+
+func TestMemoryRefreshStoreFamilyExpiry(t *testing.T) {
+
+	store := NewMemoryRefreshStore(time.Hour)
+
+	first, err := store.Issue(RefreshRecord{Account: "alice", Client: "User1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, firstRecord, err := store.Rotate(first, "User1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotation does not extend the family, the new token expires ttl after login
+	store.mu.Lock()
+	secondRecord := store.records[digest(second)]
+	store.mu.Unlock()
+
+	if !secondRecord.FamilyIssuedAt.Equal(firstRecord.FamilyIssuedAt) {
+		t.Errorf("rotated token family issued at %v, want %v", secondRecord.FamilyIssuedAt, firstRecord.FamilyIssuedAt)
+	}
+	if want := firstRecord.FamilyIssuedAt.Add(time.Hour); !secondRecord.ExpiresAt.Equal(want) {
+		t.Errorf("rotated token expires at %v, want %v", secondRecord.ExpiresAt, want)
+	}
+
+	// Once the family is older than ttl, its latest token is expired too
+	store.mu.Lock()
+	secondRecord.ExpiresAt = time.Now().Add(-time.Second)
+	store.mu.Unlock()
+
+	if _, _, err := store.Rotate(second, "User1"); err != ErrRefreshTokenExpired {
+		t.Errorf("Rotate() of token in expired family error = %v, want %v", err, ErrRefreshTokenExpired)
+	}
+}
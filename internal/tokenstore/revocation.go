@@ -0,0 +1,214 @@
+package tokenstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+// RevocationStore keeps revoked access tokens until they expire.
+// Tokens can be revoked one by one with jti, or all tokens of an account issued before some time.
+type RevocationStore interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	RevokeAccount(account string, issuedBefore time.Time, expiresAt time.Time) error
+	IsRevoked(jti, account string, issuedAt time.Time) bool
+}
+
+// A function to make revocation store which selected by [TOKEN] Revocation_Backend in config
+func MakeRevocationStore(cfg conf.IConf) (RevocationStore, error) {
+
+	// Fetch config of token
+	tokenConf := cfg.TokenCfg()
+
+	switch tokenConf.RevocationBackend {
+	case "memory":
+		return NewMemoryRevocationStore(), nil
+	case "file":
+		return NewFileRevocationStore(tokenConf.RevocationFilePath)
+	default:
+		return nil, errors.New("no such revocation backend: " + tokenConf.RevocationBackend)
+	}
+}
+
+// Account revocation entry, tokens issued up to IssuedBeforeMs are revoked.
+// Entries written before IssuedBeforeMs was added only have IssuedBefore, and keep tokens issued in that second.
+type AccountRevocation struct {
+	IssuedBefore   int64 `json:"issued_before"`
+	IssuedBeforeMs int64 `json:"issued_before_ms,omitempty"`
+	ExpiresAt      int64 `json:"expires_at"`
+}
+
+// revokedUntilMs returns the last millisecond of issue time which is revoked
+func (r AccountRevocation) revokedUntilMs() int64 {
+
+	if r.IssuedBeforeMs != 0 {
+		return r.IssuedBeforeMs
+	}
+
+	return r.IssuedBefore*1000 - 1
+}
+
+// Revocation entries, which also is the format of revocation file
+type revocationEntries struct {
+	Tokens   map[string]int64             `json:"tokens"`
+	Accounts map[string]AccountRevocation `json:"accounts"`
+}
+
+// MemoryRevocationStore keeps revocation entries in memory
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	entries revocationEntries
+}
+
+// NewMemoryRevocationStore returns empty revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		entries: revocationEntries{
+			Tokens:   map[string]int64{},
+			Accounts: map[string]AccountRevocation{},
+		},
+	}
+}
+
+// RevokeToken revokes token with jti until expiresAt
+func (s *MemoryRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeLocked(time.Now())
+	s.entries.Tokens[jti] = expiresAt.Unix()
+
+	return nil
+}
+
+// RevokeAccount revokes tokens of account which issued up to the millisecond of issuedBefore
+func (s *MemoryRevocationStore) RevokeAccount(account string, issuedBefore time.Time, expiresAt time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeLocked(time.Now())
+	s.entries.Accounts[account] = AccountRevocation{
+		IssuedBefore:   issuedBefore.Unix(),
+		IssuedBeforeMs: issuedBefore.UnixNano() / int64(time.Millisecond),
+		ExpiresAt:      expiresAt.Unix(),
+	}
+
+	return nil
+}
+
+// IsRevoked checks whether token is revoked by jti or by account
+func (s *MemoryRevocationStore) IsRevoked(jti, account string, issuedAt time.Time) bool {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().Unix()
+
+	if expiresAt, ok := s.entries.Tokens[jti]; ok && now <= expiresAt {
+		return true
+	}
+
+	// Issue time has millisecond precision, so a token issued in the same second after revocation is kept,
+	// but not one issued in the second before it. Tokens with only second iat count from the start of that second
+	if revocation, ok := s.entries.Accounts[account]; ok && now <= revocation.ExpiresAt {
+		if issuedAt.UnixNano()/int64(time.Millisecond) <= revocation.revokedUntilMs() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// purgeLocked removes entries which tokens already expired
+func (s *MemoryRevocationStore) purgeLocked(now time.Time) {
+
+	for jti, expiresAt := range s.entries.Tokens {
+		if now.Unix() > expiresAt {
+			delete(s.entries.Tokens, jti)
+		}
+	}
+
+	for account, revocation := range s.entries.Accounts {
+		if now.Unix() > revocation.ExpiresAt {
+			delete(s.entries.Accounts, account)
+		}
+	}
+}
+
+// FileRevocationStore keeps revocation entries in memory and persists them to file on each change
+type FileRevocationStore struct {
+	*MemoryRevocationStore
+	filePath string
+}
+
+// NewFileRevocationStore loads revocation entries from file, file will be created if not exists
+func NewFileRevocationStore(filePath string) (*FileRevocationStore, error) {
+
+	store := &FileRevocationStore{
+		MemoryRevocationStore: NewMemoryRevocationStore(),
+		filePath:              filePath,
+	}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.New("read revocation file failed: " + err.Error())
+	}
+
+	entries := revocationEntries{}
+	if err := json.Unmarshal(byteValue, &entries); err != nil {
+		return nil, errors.New("parse revocation file failed: " + err.Error())
+	}
+
+	if entries.Tokens != nil {
+		store.entries.Tokens = entries.Tokens
+	}
+	if entries.Accounts != nil {
+		store.entries.Accounts = entries.Accounts
+	}
+	store.purgeLocked(time.Now())
+
+	return store, nil
+}
+
+// RevokeToken revokes token with jti and saves to file
+func (s *FileRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+
+	if err := s.MemoryRevocationStore.RevokeToken(jti, expiresAt); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// RevokeAccount revokes tokens of account and saves to file
+func (s *FileRevocationStore) RevokeAccount(account string, issuedBefore time.Time, expiresAt time.Time) error {
+
+	if err := s.MemoryRevocationStore.RevokeAccount(account, issuedBefore, expiresAt); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileRevocationStore) save() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := utils.WriteJsonFileAtomic(s.filePath, s.entries); err != nil {
+		return errors.New("write revocation file failed: " + err.Error())
+	}
+
+	return nil
+}
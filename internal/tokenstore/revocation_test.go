@@ -0,0 +1,172 @@
+package tokenstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocationStoreIsRevoked(t *testing.T) {
+
+	// Middle of a second, so tokens a millisecond before or after are issued in the same second
+	now := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+
+	store := NewMemoryRevocationStore()
+	if err := store.RevokeToken("revoked-jti", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeToken("expired-jti", now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeAccount("alice", now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeAccount("bob", now, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		jti      string
+		account  string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"revoked jti", "revoked-jti", "carol", now, true},
+		{"revocation of expired token", "expired-jti", "carol", now, false},
+		{"other jti", "other-jti", "carol", now, false},
+		{"account token issued before", "other-jti", "alice", now.Add(-time.Minute), true},
+		{"account token issued at revocation", "other-jti", "alice", now, true},
+		{"account token issued earlier in the same second", "other-jti", "alice", now.Add(-time.Millisecond), true},
+		{"account token issued later in the same second", "other-jti", "alice", now.Add(time.Millisecond), false},
+		{"account token issued after", "other-jti", "alice", now.Add(time.Minute), false},
+		{"expired account revocation", "other-jti", "bob", now.Add(-time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.IsRevoked(tt.jti, tt.account, tt.issuedAt); got != tt.want {
+				t.Errorf("IsRevoked(%q, %q) = %v, want %v", tt.jti, tt.account, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStorePurge(t *testing.T) {
+
+	now := time.Now()
+
+	store := NewMemoryRevocationStore()
+	store.RevokeToken("expired-jti", now.Add(-time.Hour))
+	store.RevokeAccount("bob", now, now.Add(-time.Hour))
+
+	// Next revocation purges entries which tokens already expired
+	store.RevokeToken("revoked-jti", now.Add(time.Hour))
+
+	if _, ok := store.entries.Tokens["expired-jti"]; ok {
+		t.Error("revocation of expired token is not purged")
+	}
+	if _, ok := store.entries.Accounts["bob"]; ok {
+		t.Error("expired account revocation is not purged")
+	}
+	if _, ok := store.entries.Tokens["revoked-jti"]; !ok {
+		t.Error("revocation of live token is purged")
+	}
+}
+
+func TestFileRevocationStore(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"missing file", "", false},
+		{"empty entries", `{}`, false},
+		{"entries", `{"tokens": {"jti": 1}, "accounts": {"alice": {"issued_before": 1, "expires_at": 1}}}`, false},
+		{"malformed file", `{"tokens": `, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(dir, tt.name+".json")
+			if tt.content != "" {
+				if err := ioutil.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store, err := NewFileRevocationStore(filePath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileRevocationStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Entries of tokens expired long ago are purged at load
+			if len(store.entries.Tokens) != 0 || len(store.entries.Accounts) != 0 {
+				t.Errorf("NewFileRevocationStore() kept expired entries %+v", store.entries)
+			}
+
+			if err := store.RevokeToken("jti", now.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RevokeAccount("alice", now, now.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded, err := NewFileRevocationStore(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reloaded.IsRevoked("jti", "bob", now) {
+				t.Error("revoked jti is not revoked after reload")
+			}
+			if !reloaded.IsRevoked("other-jti", "alice", now.Add(-time.Minute)) {
+				t.Error("revoked account is not revoked after reload")
+			}
+		})
+	}
+}
+
+func TestFileRevocationStoreLegacyAccountEntry(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "revocation.json")
+	issuedBefore := time.Now().Truncate(time.Second)
+	expiresAt := issuedBefore.Add(time.Hour)
+
+	// Entry written before issued_before_ms, tokens issued in the second of revocation are kept
+	content := fmt.Sprintf(`{"accounts": {"alice": {"issued_before": %d, "expires_at": %d}}}`, issuedBefore.Unix(), expiresAt.Unix())
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileRevocationStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued in the second before", issuedBefore.Add(-time.Millisecond), true},
+		{"issued in the second of revocation", issuedBefore, false},
+		{"issued later in the second of revocation", issuedBefore.Add(500 * time.Millisecond), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.IsRevoked("jti", "alice", tt.issuedAt); got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
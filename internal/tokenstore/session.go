@@ -0,0 +1,367 @@
+package tokenstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cxweoth/gin-api-server-template/internal/conf"
+	"github.com/cxweoth/gin-api-server-template/internal/utils"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session is expired")
+)
+
+// Prefix of opaque session tokens, so they are told apart from jwt
+const SessionTokenPrefix = "st_"
+
+// Session is the server side state of an opaque token, which holds claims of the token
+type Session struct {
+	ID            string    `json:"id"`
+	Subject       string    `json:"sub"`
+	Audience      string    `json:"aud,omitempty"`
+	Issuer        string    `json:"iss"`
+	Account       string    `json:"account,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	AMR           []string  `json:"amr,omitempty"`
+	Client        string    `json:"client,omitempty"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Scope         string    `json:"scope,omitempty"`
+	TokenUse      string    `json:"token_use,omitempty"`
+	Actor         string    `json:"actor,omitempty"`
+	CnfClient     string    `json:"cnf_client,omitempty"`
+	CnfThumbprint string    `json:"cnf_x5t_s256,omitempty"`
+	IssuedAt      time.Time `json:"issued_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// SessionStore creates opaque tokens of sessions, and resolves tokens to sessions until they expire or are deleted
+type SessionStore interface {
+	Create(session Session) (string, error)
+	Lookup(token string) (Session, error)
+	// Delete removes session of id, i.e. jti of token, it is not an error if no such session
+	Delete(id string) error
+	// DeleteAccount removes all sessions of account
+	DeleteAccount(account string) error
+}
+
+// A function to make session store which selected by [TOKEN] Session_Backend in config
+func MakeSessionStore(cfg conf.IConf) (SessionStore, error) {
+
+	// Fetch config of token
+	tokenConf := cfg.TokenCfg()
+
+	switch tokenConf.SessionBackend {
+	case "memory":
+		return NewMemorySessionStore(), nil
+	case "file":
+		return NewFileSessionStore(tokenConf.SessionFilePath)
+	default:
+		return nil, errors.New("no such session backend: " + tokenConf.SessionBackend)
+	}
+}
+
+// IsSessionToken checks whether token is an opaque session token
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, SessionTokenPrefix)
+}
+
+// MemorySessionStore keeps sessions in memory, sessions are stored by sha256 digest of token
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore returns empty session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]Session{},
+	}
+}
+
+// Create stores session and returns its opaque token
+func (s *MemorySessionStore) Create(session Session) (string, error) {
+
+	token, _, err := s.create(session)
+
+	return token, err
+}
+
+// create stores session, and returns its opaque token and key of token
+func (s *MemorySessionStore) create(session Session) (string, string, error) {
+
+	randomPart, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := SessionTokenPrefix + randomPart
+	key := digest(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeLocked(time.Now())
+	s.sessions[key] = session
+
+	return token, key, nil
+}
+
+// Lookup returns session of token, expired session is not returned
+func (s *MemorySessionStore) Lookup(token string) (Session, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[digest(token)]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return Session{}, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+// Delete removes session of id
+func (s *MemorySessionStore) Delete(id string) error {
+
+	s.delete(func(session Session) bool { return session.ID == id })
+
+	return nil
+}
+
+// DeleteAccount removes all sessions of account
+func (s *MemorySessionStore) DeleteAccount(account string) error {
+
+	s.delete(func(session Session) bool { return session.Account == account })
+
+	return nil
+}
+
+// delete removes sessions which match, and returns their keys.
+// Sessions are stored by token digest, so all sessions are scanned.
+func (s *MemorySessionStore) delete(match func(session Session) bool) []string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []string{}
+	for key, session := range s.sessions {
+		if match(session) {
+			delete(s.sessions, key)
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// purgeLocked removes expired sessions
+func (s *MemorySessionStore) purgeLocked(now time.Time) {
+
+	for key, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// Minimum lines of session journal before it is compacted
+const sessionJournalMinCompactLines = 1024
+
+// Line of session journal, session is created when Session is set, otherwise deleted
+type sessionJournalLine struct {
+	Key     string   `json:"key"`
+	Session *Session `json:"session,omitempty"`
+}
+
+// FileSessionStore keeps sessions in memory and appends each change to a journal file, so tokens survive restart.
+// Login only appends one line instead of rewriting all sessions. The journal is compacted at start,
+// and when it has more than twice the lines of live sessions.
+type FileSessionStore struct {
+	*MemorySessionStore
+	filePath     string
+	fileMu       sync.Mutex // serializes changes, so journal file has the same order as memory
+	journalLines int
+}
+
+// NewFileSessionStore loads sessions from journal file, file will be created if not exists
+func NewFileSessionStore(filePath string) (*FileSessionStore, error) {
+
+	store := &FileSessionStore{
+		MemorySessionStore: NewMemorySessionStore(),
+		filePath:           filePath,
+	}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.New("read session file failed: " + err.Error())
+	}
+
+	sessions, err := parseSessionFile(byteValue)
+	if err != nil {
+		return nil, err
+	}
+
+	store.sessions = sessions
+	store.purgeLocked(time.Now())
+
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// parseSessionFile replays journal lines. File of a single json object by token digest, as written before journal, is accepted too
+func parseSessionFile(byteValue []byte) (map[string]Session, error) {
+
+	sessions := map[string]Session{}
+	if err := json.Unmarshal(byteValue, &sessions); err == nil {
+		return sessions, nil
+	}
+
+	sessions = map[string]Session{}
+	decoder := json.NewDecoder(bytes.NewReader(byteValue))
+	for decoder.More() {
+		var line sessionJournalLine
+		if err := decoder.Decode(&line); err != nil {
+			return nil, errors.New("parse session file failed: " + err.Error())
+		}
+		if line.Session != nil {
+			sessions[line.Key] = *line.Session
+		} else {
+			delete(sessions, line.Key)
+		}
+	}
+
+	return sessions, nil
+}
+
+// Create stores session, appends it to file and returns its opaque token.
+// Changes are journaled in the order they are applied, so a deletion is never replayed before its creation.
+func (s *FileSessionStore) Create(session Session) (string, error) {
+
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	token, key, err := s.MemorySessionStore.create(session)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.appendLocked([]sessionJournalLine{{Key: key, Session: &session}}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Delete removes session of id, and appends deletion to file
+func (s *FileSessionStore) Delete(id string) error {
+	return s.deleteAndAppend(func(session Session) bool { return session.ID == id })
+}
+
+// DeleteAccount removes all sessions of account, and appends deletions to file
+func (s *FileSessionStore) DeleteAccount(account string) error {
+	return s.deleteAndAppend(func(session Session) bool { return session.Account == account })
+}
+
+func (s *FileSessionStore) deleteAndAppend(match func(session Session) bool) error {
+
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	lines := []sessionJournalLine{}
+	for _, key := range s.MemorySessionStore.delete(match) {
+		lines = append(lines, sessionJournalLine{Key: key})
+	}
+
+	return s.appendLocked(lines)
+}
+
+// appendLocked writes lines to end of journal file, and compacts it when it grows too long
+func (s *FileSessionStore) appendLocked(lines []sessionJournalLine) error {
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	for _, line := range lines {
+		byteValue, err := json.Marshal(line)
+		if err != nil {
+			return errors.New("write session file failed: " + err.Error())
+		}
+		buffer.Write(append(byteValue, '\n'))
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New("write session file failed: " + err.Error())
+	}
+	_, err = file.Write(buffer.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.New("write session file failed: " + err.Error())
+	}
+	s.journalLines += len(lines)
+
+	s.mu.RLock()
+	liveSessions := len(s.sessions)
+	s.mu.RUnlock()
+
+	if s.journalLines > sessionJournalMinCompactLines && s.journalLines > 2*liveSessions {
+		return s.compactLocked()
+	}
+
+	return nil
+}
+
+// compact rewrites journal file with one line of each live session
+func (s *FileSessionStore) compact() error {
+
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	return s.compactLocked()
+}
+
+func (s *FileSessionStore) compactLocked() error {
+
+	s.mu.Lock()
+	s.purgeLocked(time.Now())
+	var buffer bytes.Buffer
+	for key, session := range s.sessions {
+		session := session
+		byteValue, err := json.Marshal(sessionJournalLine{Key: key, Session: &session})
+		if err != nil {
+			s.mu.Unlock()
+			return errors.New("write session file failed: " + err.Error())
+		}
+		buffer.Write(append(byteValue, '\n'))
+	}
+	liveSessions := len(s.sessions)
+	s.mu.Unlock()
+
+	if err := utils.WriteFileAtomic(s.filePath, buffer.Bytes()); err != nil {
+		return errors.New("write session file failed: " + err.Error())
+	}
+	s.journalLines = liveSessions
+
+	return nil
+}
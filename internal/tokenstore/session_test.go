@@ -0,0 +1,211 @@
+package tokenstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreLookup(t *testing.T) {
+
+	now := time.Now()
+
+	stores := map[string]func(t *testing.T) SessionStore{
+		"memory": func(t *testing.T) SessionStore {
+			return NewMemorySessionStore()
+		},
+		"file": func(t *testing.T) SessionStore {
+			store, err := NewFileSessionStore(filepath.Join(t.TempDir(), "sessions.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+
+	tests := []struct {
+		name    string
+		session Session
+		token   func(token string) string
+		wantErr error
+	}{
+		{"live session", Session{ID: "jti-1", Account: "alice", ExpiresAt: now.Add(time.Hour)}, func(token string) string { return token }, nil},
+		{"expired session", Session{ID: "jti-1", Account: "alice", ExpiresAt: now.Add(-time.Second)}, func(token string) string { return token }, ErrSessionExpired},
+		{"unknown token", Session{ID: "jti-1", Account: "alice", ExpiresAt: now.Add(time.Hour)}, func(token string) string { return token + "x" }, ErrSessionNotFound},
+		{"empty token", Session{ID: "jti-1", Account: "alice", ExpiresAt: now.Add(time.Hour)}, func(token string) string { return "" }, ErrSessionNotFound},
+	}
+
+	for storeName, newStore := range stores {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				store := newStore(t)
+
+				token, err := store.Create(tt.session)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !IsSessionToken(token) {
+					t.Errorf("Create() returned token %q without prefix %s", token, SessionTokenPrefix)
+				}
+
+				session, err := store.Lookup(tt.token(token))
+				if err != tt.wantErr {
+					t.Fatalf("Lookup() error = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && session.ID != tt.session.ID {
+					t.Errorf("Lookup() returned session %s, want %s", session.ID, tt.session.ID)
+				}
+			})
+		}
+	}
+}
+
+func TestSessionStoreDelete(t *testing.T) {
+
+	expiresAt := time.Now().Add(time.Hour)
+	sessions := []Session{
+		{ID: "jti-1", Account: "alice", ExpiresAt: expiresAt},
+		{ID: "jti-2", Account: "alice", ExpiresAt: expiresAt},
+		{ID: "jti-3", Account: "bob", ExpiresAt: expiresAt},
+	}
+
+	tests := []struct {
+		name       string
+		delete     func(store SessionStore) error
+		wantLookup []error
+	}{
+		{"delete by id", func(store SessionStore) error { return store.Delete("jti-1") }, []error{ErrSessionNotFound, nil, nil}},
+		{"delete unknown id", func(store SessionStore) error { return store.Delete("jti-4") }, []error{nil, nil, nil}},
+		{"delete account", func(store SessionStore) error { return store.DeleteAccount("alice") }, []error{ErrSessionNotFound, ErrSessionNotFound, nil}},
+		{"delete unknown account", func(store SessionStore) error { return store.DeleteAccount("carol") }, []error{nil, nil, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			filePath := filepath.Join(t.TempDir(), "sessions.json")
+			store, err := NewFileSessionStore(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens := []string{}
+			for _, session := range sessions {
+				token, err := store.Create(session)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens = append(tokens, token)
+			}
+
+			if err := tt.delete(store); err != nil {
+				t.Fatal(err)
+			}
+
+			// Deletions are replayed from journal after restart as well
+			reloaded, err := NewFileSessionStore(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, token := range tokens {
+				if _, err := store.Lookup(token); err != tt.wantLookup[i] {
+					t.Errorf("Lookup() of %s error = %v, want %v", sessions[i].ID, err, tt.wantLookup[i])
+				}
+				if _, err := reloaded.Lookup(token); err != tt.wantLookup[i] {
+					t.Errorf("Lookup() of %s after reload error = %v, want %v", sessions[i].ID, err, tt.wantLookup[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSessionFile(t *testing.T) {
+
+	session := Session{ID: "jti-1", Account: "alice"}
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		wantKeys []string
+		wantErr  bool
+	}{
+		{"empty file", "", []string{}, false},
+		{"map before journal", `{"k1": ` + string(sessionJSON) + `, "k2": ` + string(sessionJSON) + `}`, []string{"k1", "k2"}, false},
+		{"journal", `{"key": "k1", "session": ` + string(sessionJSON) + "}\n" + `{"key": "k2", "session": ` + string(sessionJSON) + "}\n", []string{"k1", "k2"}, false},
+		{"journal with deletion", `{"key": "k1", "session": ` + string(sessionJSON) + "}\n" + `{"key": "k1"}` + "\n", []string{}, false},
+		{"journal with truncated line", `{"key": "k1", "session": ` + string(sessionJSON) + "}\n" + `{"key": "k2", "sess`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := parseSessionFile([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSessionFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(sessions) != len(tt.wantKeys) {
+				t.Fatalf("parseSessionFile() returned %d sessions, want %d", len(sessions), len(tt.wantKeys))
+			}
+			for _, key := range tt.wantKeys {
+				if sessions[key].ID != session.ID {
+					t.Errorf("parseSessionFile() session of %s = %+v, want %+v", key, sessions[key], session)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSessionStoreCompaction(t *testing.T) {
+
+	filePath := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	kept, err := store.Create(Session{ID: "kept", Account: "bob", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating and deleting sessions grows journal past the compaction threshold
+	for i := 0; i < sessionJournalMinCompactLines; i++ {
+		if _, err := store.Create(Session{ID: "deleted", Account: "alice", ExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete("deleted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(byteValue), "\n"); lines > sessionJournalMinCompactLines+1 {
+		t.Errorf("journal has %d lines, want compacted to at most %d", lines, sessionJournalMinCompactLines+1)
+	}
+
+	reloaded, err := NewFileSessionStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Lookup(kept); err != nil {
+		t.Errorf("Lookup() of kept session after compaction error = %v", err)
+	}
+	if reloaded.journalLines != 1 {
+		t.Errorf("journal lines after reload = %d, want 1", reloaded.journalLines)
+	}
+}
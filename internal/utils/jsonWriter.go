@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A function to write v as json to file atomically.
+// It writes to a temp file in the same folder then renames it, so readers never see half-written file.
+func WriteJsonFileAtomic(filePath string, v interface{}) error {
+
+	// Marshal with indent to keep file readable
+	byteValue, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filePath, byteValue)
+}
+
+// A function to write bytes to file atomically, same as WriteJsonFileAtomic
+func WriteFileAtomic(filePath string, byteValue []byte) error {
+
+	// Write to temp file in the same folder
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpFilePath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(byteValue); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return err
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFilePath)
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFilePath)
+		return err
+	}
+
+	// Rename to replace original file
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		os.Remove(tmpFilePath)
+		return err
+	}
+
+	return nil
+}